@@ -7,5 +7,10 @@ import (
 func SetupRoutes(router *mux.Router) {
 	SetupProductsApiRoutes(router)
 	SetupTrackingsApiRoutes(router)
+	SetupTrackingConditionsApiRoutes(router)
 	SetupUsersApiRoutes(router)
+	SetupNotificationChannelsApiRoutes(router)
+	SetupNotificationsApiRoutes(router)
+	SetupEmailsApiRoutes(router)
+	SetupCrawlApiRoutes(router)
 }
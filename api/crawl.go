@@ -0,0 +1,35 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/common"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/crawl"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/database"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/middleware"
+	"github.com/gorilla/mux"
+)
+
+// getProxiesHandler shows the proxy pools of the running workers, the API
+// does not crawl so its own pool is empty.
+func getProxiesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	proxyStatService := database.NewProxyStatService(database.Repos.ProxyStats)
+	published, err := proxyStatService.FindFresh(ctx)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusInternalServerError, common.InternalServerErrorCode, common.InternalServerMsg))
+		return
+	}
+	json.NewEncoder(w).Encode(common.ReturnApi(crawl.MergeProxyStats(published, time.Now()), "Get proxies success!"))
+}
+
+func SetupCrawlApiRoutes(router *mux.Router) {
+	router.HandleFunc("/api/crawl/proxies", middleware.AuthMiddleware(getProxiesHandler, middleware.ConditionAuth{
+		NeedAdmin: true,
+	})).Methods("GET")
+}
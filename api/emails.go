@@ -0,0 +1,55 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/common"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/database"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/middleware"
+	"github.com/gorilla/mux"
+)
+
+func newEmailService() *database.EmailService {
+	return database.NewEmailService(database.Repos.Emails)
+}
+
+// queueEmail adds the email to the outbox, the worker sends it.
+func queueEmail(ctx context.Context, email database.Email) (database.Email, error) {
+	return newEmailService().Queue(ctx, email)
+}
+
+// getStuckEmailsHandler lists the emails that failed or are late by more than
+// the "late" duration, 15m by default.
+func getStuckEmailsHandler(w http.ResponseWriter, r *http.Request) {
+	late := 15 * time.Minute
+	if value := r.URL.Query().Get("late"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusBadRequest, common.InvalidQueryCode, common.InvalidQueryMsg))
+			return
+		}
+		late = d
+	}
+	limit, page := parsePagination(r, 50)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	emails, err := newEmailService().FindStuck(ctx, time.Now().Add(-late), limit, page)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusInternalServerError, common.InternalServerErrorCode, common.InternalServerMsg))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(common.ReturnApi(emails, "Get stuck emails success!"))
+}
+
+func SetupEmailsApiRoutes(router *mux.Router) {
+	router.HandleFunc("/api/emails/stuck", middleware.AuthMiddleware(getStuckEmailsHandler, middleware.ConditionAuth{
+		NeedAdmin: true,
+	})).Methods("GET")
+}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/common"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/database"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/logs"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/middleware"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/notify"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/templates"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// NotificationChannelRequest is a channel of the user. Target is an email
+// address, a https url on a public host, or the chat id for telegram. An
+// email address other than the one of the account must be confirmed.
+type NotificationChannelRequest struct {
+	Type       string   `json:"type" validate:"required,oneof=email webhook telegram discord slack web_push"`
+	Target     string   `json:"target" validate:"required,max=2048"`
+	Secret     string   `json:"secret" validate:"max=256"`
+	Enabled    bool     `json:"enabled"`
+	Conditions []string `json:"conditions" validate:"dive,oneof=less_than greater_than equal target_price percent_drop any_change percent_drop_window all_time_low back_in_stock discount_above near_target"`
+}
+
+// NotificationChannelsRequest replaces every channel of the user, one per type.
+type NotificationChannelsRequest struct {
+	Channels []NotificationChannelRequest `json:"channels" validate:"max=6,unique=Type,dive"`
+}
+
+// validTarget checks the target against the type of the channel. The urls
+// must be https on a public host.
+func validTarget(ctx context.Context, channel NotificationChannelRequest) bool {
+	switch channel.Type {
+	case database.CHANNEL_EMAIL:
+		return validator.New().Var(channel.Target, "email") == nil
+	case database.CHANNEL_TELEGRAM:
+		return true
+	}
+	return notify.CheckTarget(ctx, channel.Target) == nil
+}
+
+// sendChannelVerification mails a link to the email target of a channel, the
+// channel gets alerts once the link is opened.
+func sendChannelVerification(ctx context.Context, user database.User, target string) error {
+	token, err := utils.GenerateTokenVerifyEmail()
+	if err != nil {
+		return err
+	}
+	tokenService := database.NewTokenService(database.Repos.Tokens)
+	_, err = tokenService.Insert(ctx, database.Token{
+		Token:     token,
+		Type:      database.VerifyChannel,
+		Target:    target,
+		ExpiredAt: time.Now().Add(6 * time.Hour),
+		UserId:    user.ID,
+	})
+	if err != nil {
+		return err
+	}
+	email, err := templates.CreateEmailSendTokenVerifyChannelTemplate(templates.InfoEmailSendTokenVerifyChannel{
+		Locale:   templates.Locale(user.Locale),
+		Email:    target,
+		Owner:    user.Email,
+		UrlToken: fmt.Sprintf("%s/verify-channel/%s", os.Getenv("BASE_URL"), token),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = queueEmail(ctx, database.Email{
+		Kind:    database.EMAIL_VERIFY,
+		To:      target,
+		Subject: email.Subject,
+		HTML:    email.HTML,
+		Text:    email.Text,
+	})
+	return err
+}
+
+// channelsResponse hides the secrets of the channels.
+func channelsResponse(user database.User) map[string]any {
+	channels := user.NotificationChannels()
+	result := make([]database.NotificationChannel, len(channels))
+	for i, channel := range channels {
+		channel.Secret = ""
+		result[i] = channel
+	}
+	response := map[string]any{"channels": result}
+	if webPush, ok := notify.DefaultNotifiers()[database.CHANNEL_WEB_PUSH].(*notify.WebPushNotifier); ok {
+		response["vapid_public_key"] = webPush.PublicKey()
+	}
+	return response
+}
+
+func getNotificationChannelsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	userService := database.NewUserService(database.Repos.Users)
+	user, err := userService.FindById(ctx, r.Context().Value("user_id").(string))
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusUnauthorized, common.UnauthorizedCode, common.UnauthorizedMsg))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(common.ReturnApi(channelsResponse(user), "Get notification channels success!"))
+}
+
+func updateNotificationChannelsHandler(w http.ResponseWriter, r *http.Request) {
+	var payload NotificationChannelsRequest
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err == nil {
+		err = validator.New().Struct(payload)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	valid := err == nil
+	for _, channel := range payload.Channels {
+		valid = valid && validTarget(ctx, channel)
+	}
+	if !valid {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusBadRequest, common.InvalidChannelCode, common.InvalidChannelMsg))
+		return
+	}
+
+	userID := r.Context().Value("user_id").(string)
+	userService := database.NewUserService(database.Repos.Users)
+	user, err := userService.FindById(ctx, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusUnauthorized, common.UnauthorizedCode, common.UnauthorizedMsg))
+		return
+	}
+
+	// an empty secret keeps the one already set on the channel, and an email
+	// address stays confirmed while it is not changed
+	secrets := map[string]string{}
+	confirmed := map[string]bool{}
+	for _, channel := range user.Channels {
+		secrets[channel.Type] = channel.Secret
+		if channel.Type == database.CHANNEL_EMAIL && channel.Verified {
+			confirmed[strings.ToLower(channel.Target)] = true
+		}
+	}
+	channels := []database.NotificationChannel{}
+	for _, channel := range payload.Channels {
+		if channel.Secret == "" {
+			channel.Secret = secrets[channel.Type]
+		}
+		channels = append(channels, database.NotificationChannel{
+			Type:       channel.Type,
+			Target:     channel.Target,
+			Secret:     channel.Secret,
+			Enabled:    channel.Enabled,
+			Verified:   channel.Type == database.CHANNEL_EMAIL && (user.OwnsAddress(channel.Target) || confirmed[strings.ToLower(channel.Target)]),
+			Conditions: channel.Conditions,
+		})
+	}
+	err = userService.Update(ctx, userID, database.UserUpdate{Channels: &channels})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusInternalServerError, common.InternalServerErrorCode, common.InternalServerMsg))
+		return
+	}
+	// any other address gets no alert until its owner opens the link
+	for _, channel := range channels {
+		if channel.Type == database.CHANNEL_EMAIL && !channel.Verified {
+			if err := sendChannelVerification(ctx, user, channel.Target); err != nil {
+				logs.LogWarning(logrus.Fields{
+					"user": userID,
+					"data": err.Error(),
+				}, "queue channel verify email")
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusInternalServerError, common.InternalServerErrorCode, common.InternalServerMsg))
+				return
+			}
+		}
+	}
+	user.Channels = channels
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(common.ReturnApi(channelsResponse(user), "Update notification channels success!"))
+}
+
+func SetupNotificationChannelsApiRoutes(router *mux.Router) {
+	router.HandleFunc("/api/user/channels", middleware.AuthMiddleware(getNotificationChannelsHandler, middleware.ConditionAuth{
+		NeedVerify: true,
+	})).Methods("GET")
+	router.HandleFunc("/api/user/channels", middleware.AuthMiddleware(updateNotificationChannelsHandler, middleware.ConditionAuth{
+		NeedVerify: true,
+	})).Methods("PUT")
+}
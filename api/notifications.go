@@ -0,0 +1,49 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/common"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/database"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/middleware"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// getNotificationsHandler lists the latest notifications of the user, newest
+// first. The service worker shows them when a web push wakes it up.
+func getNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := primitive.ObjectIDFromHex(r.Context().Value("user_id").(string))
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusUnauthorized, common.UnauthorizedCode, common.UnauthorizedMsg))
+		return
+	}
+	limit, page := parsePagination(r, 20)
+
+	notificationService := database.NewNotificationService(database.Repos.Notifications)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	notifications, err := notificationService.FindPageByUserID(ctx, userID, limit, page)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusInternalServerError, common.InternalServerErrorCode, common.InternalServerMsg))
+		return
+	}
+	// the errors of the channels are for the admins
+	for i := range notifications.Data {
+		notifications.Data[i].Error = ""
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(common.ReturnApi(notifications, "Get notifications success!"))
+}
+
+func SetupNotificationsApiRoutes(router *mux.Router) {
+	router.HandleFunc("/api/notifications", middleware.AuthMiddleware(getNotificationsHandler, middleware.ConditionAuth{
+		NeedVerify: true,
+	})).Methods("GET")
+}
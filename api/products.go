@@ -1,15 +1,227 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/common"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/database"
 	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-func getProductionsHandler(w http.ResponseWriter, r *http.Request) {
-	//
+const maxLimit = 1000
+
+// parsePagination reads the page and limit query params, page starts at 1.
+func parsePagination(r *http.Request, defaultLimit int64) (int64, int64) {
+	limit, err := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 64)
+	if err != nil || limit <= 0 {
+		limit = defaultLimit
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	page, err := strconv.ParseInt(r.URL.Query().Get("page"), 10, 64)
+	if err != nil || page <= 0 {
+		page = 1
+	}
+	return limit, page
+}
+
+// parseTime reads a query param as RFC 3339 or as a date.
+func parseTime(value string, fallback time.Time) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
+
+// ProductDetail is a product with its shop and latest price point.
+type ProductDetail struct {
+	Product     database.Product `json:"product"`
+	Shop        *database.Shop   `json:"shop"`
+	LatestPrice *database.Price  `json:"latest_price"`
+}
+
+// getProductsHandler lists the products. min_price and max_price are in the
+// units of Shopee, the price in dong x 100000 like the prices we store, so
+// 129000đ is 12900000000. min_rating is the average stars of the reviews.
+func getProductsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, page := parsePagination(r, 20)
+	productQuery := database.ProductQuery{
+		Search: query.Get("q"),
+		Sort:   query.Get("sort"),
+		Limit:  limit,
+		Page:   page,
+	}
+
+	var err error
+	invalid := false
+	if value := query.Get("min_price"); value != "" {
+		productQuery.MinPrice, err = strconv.ParseInt(value, 10, 64)
+		invalid = invalid || err != nil
+	}
+	if value := query.Get("max_price"); value != "" {
+		productQuery.MaxPrice, err = strconv.ParseInt(value, 10, 64)
+		invalid = invalid || err != nil
+	}
+	if value := query.Get("min_discount"); value != "" {
+		productQuery.MinDiscount, err = strconv.ParseFloat(value, 64)
+		invalid = invalid || err != nil
+	}
+	if value := query.Get("min_rating"); value != "" {
+		productQuery.MinRating, err = strconv.ParseFloat(value, 64)
+		invalid = invalid || err != nil
+	}
+	if _, ok := database.ProductSorts[strings.TrimPrefix(productQuery.Sort, "-")]; productQuery.Sort != "" && !ok {
+		invalid = true
+	}
+	if invalid {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusBadRequest, common.InvalidQueryCode, common.InvalidQueryMsg))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// the shop is the id of our shop or the shop id on shopee
+	if shop := query.Get("shop"); shop != "" {
+		shopID, err := primitive.ObjectIDFromHex(shop)
+		if err != nil {
+			shopService := database.NewShopService(database.Repos.Shops)
+			shopeeID, _ := strconv.ParseInt(shop, 10, 64)
+			shopDB, err := shopService.FindByShopShopeeId(ctx, shopeeID)
+			if err != nil {
+				json.NewEncoder(w).Encode(common.ReturnApi(database.DataWithPagination[database.Product]{
+					Data:        []database.Product{},
+					CurrentPage: int(page),
+					Limit:       int(limit),
+				}, "Get products success!"))
+				return
+			}
+			shopID = shopDB.ID
+		}
+		productQuery.ShopID = shopID
+	}
+
+	productService := database.NewProductService(database.Repos.Products)
+	products, err := productService.Search(ctx, productQuery)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusInternalServerError, common.InternalServerErrorCode, common.InternalServerMsg))
+		return
+	}
+
+	json.NewEncoder(w).Encode(common.ReturnApi(products, "Get products success!"))
+}
+
+func getProductHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusNotFound, common.ProductNotFoundCode, common.ProductNotFoundMessage))
+		return
+	}
+
+	productService := database.NewProductService(database.Repos.Products)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	product, err := productService.FindById(ctx, productID)
+	if errors.Is(err, database.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusNotFound, common.ProductNotFoundCode, common.ProductNotFoundMessage))
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusInternalServerError, common.InternalServerErrorCode, common.InternalServerMsg))
+		return
+	}
+
+	detail := ProductDetail{Product: product}
+
+	if shopID, ok := product.Shop.Map()["$id"].(primitive.ObjectID); ok {
+		shopService := database.NewShopService(database.Repos.Shops)
+		shop, err := shopService.FindById(ctx, shopID.Hex())
+		if err == nil {
+			detail.Shop = &shop
+		}
+	}
+
+	priceService := database.NewPriceService(database.Repos.Prices)
+	price, err := priceService.FindLatest(ctx, product.ID)
+	if err == nil {
+		detail.LatestPrice = &price
+	}
+
+	json.NewEncoder(w).Encode(common.ReturnApi(detail, "Get product success!"))
+}
+
+func getProductPricesHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusBadRequest, common.ProductNotFoundCode, common.ProductNotFoundMessage))
+		return
+	}
+
+	query := r.URL.Query()
+	to, err := parseTime(query.Get("to"), time.Now())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusBadRequest, common.InvalidQueryCode, common.InvalidQueryMsg))
+		return
+	}
+	from, err := parseTime(query.Get("from"), to.AddDate(0, 0, -30))
+	if err != nil || !from.Before(to) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusBadRequest, common.InvalidQueryCode, common.InvalidQueryMsg))
+		return
+	}
+	resolution := query.Get("resolution")
+	switch resolution {
+	case "":
+		resolution = database.RESOLUTION_DAY
+	case database.RESOLUTION_RAW, database.RESOLUTION_HOUR, database.RESOLUTION_DAY:
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusBadRequest, common.InvalidQueryCode, common.InvalidQueryMsg))
+		return
+	}
+	limit, page := parsePagination(r, 100)
+
+	priceService := database.NewPriceService(database.Repos.Prices)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	prices, err := priceService.Rollup(ctx, productID, from, to, resolution, limit, page)
+	if errors.Is(err, database.ErrTooManyBuckets) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusBadRequest, common.InvalidQueryCode, common.InvalidQueryMsg))
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusInternalServerError, common.InternalServerErrorCode, common.InternalServerMsg))
+		return
+	}
+
+	json.NewEncoder(w).Encode(common.ReturnApi(prices, "Get prices success!"))
 }
 
 func SetupProductsApiRoutes(router *mux.Router) {
-	router.HandleFunc("/api/products", getProductionsHandler).Methods("POST")
+	router.HandleFunc("/api/products", getProductsHandler).Methods("GET")
+	router.HandleFunc("/api/products/{id}", getProductHandler).Methods("GET")
+	router.HandleFunc("/api/products/{id}/prices", getProductPricesHandler).Methods("GET")
 }
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/common"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/database"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/middleware"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TrackingConditionRequest is a rule of the user on a tracking. Price and
+// Margin are in the unit of the stored prices, Percent is a drop or a
+// discount in percent.
+type TrackingConditionRequest struct {
+	Condition   string  `json:"condition" validate:"required,oneof=less_than greater_than equal target_price percent_drop any_change percent_drop_window all_time_low back_in_stock discount_above near_target"`
+	Price       int64   `json:"price" validate:"min=0,required_if=Condition target_price,required_if=Condition equal,required_if=Condition near_target"`
+	Percent     float64 `json:"percent" validate:"min=0,max=100,required_if=Condition percent_drop,required_if=Condition percent_drop_window,required_if=Condition discount_above"`
+	Margin      int64   `json:"margin" validate:"min=0"`
+	WindowHours int     `json:"window_hours" validate:"min=0,max=720,required_if=Condition percent_drop_window"`
+	// CooldownMinutes is the least time between two notifications
+	CooldownMinutes int `json:"cooldown_minutes" validate:"min=0,max=10080"`
+}
+
+// conditionScope returns the tracking and user of the request once it is
+// sure the user tracks it, or writes the error response.
+func conditionScope(ctx context.Context, w http.ResponseWriter, r *http.Request) (primitive.ObjectID, primitive.ObjectID, bool) {
+	userIDObj, err := primitive.ObjectIDFromHex(r.Context().Value("user_id").(string))
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusUnauthorized, common.UnauthorizedCode, common.UnauthorizedMsg))
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+	trackingID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusNotFound, common.TrackingNotFoundCode, common.TrackingNotFoundMsg))
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+	if !newTrackingSubscriptionService().Exists(ctx, userIDObj, trackingID) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusNotFound, common.TrackingNotFoundCode, common.TrackingNotFoundMsg))
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+	return trackingID, userIDObj, true
+}
+
+// conditionQuery matches the active conditions of the user on the tracking.
+func conditionQuery(trackingID primitive.ObjectID, userID primitive.ObjectID) database.TrackingConditionQuery {
+	return database.TrackingConditionQuery{
+		TrackingID: trackingID,
+		UserID:     userID,
+		ActiveOnly: true,
+	}
+}
+
+func decodeConditionRequest(w http.ResponseWriter, r *http.Request) (TrackingConditionRequest, bool) {
+	var payload TrackingConditionRequest
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err == nil {
+		err = validator.New().Struct(payload)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusBadRequest, common.InvalidConditionCode, common.InvalidConditionMsg))
+		return payload, false
+	}
+	return payload, true
+}
+
+func getTrackingConditionsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	trackingID, userID, ok := conditionScope(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	conditionService := database.NewTrackingConditionService(database.Repos.TrackingConditions)
+	conditions, err := conditionService.FindAll(ctx, conditionQuery(trackingID, userID))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusInternalServerError, common.InternalServerErrorCode, common.InternalServerMsg))
+		return
+	}
+	if conditions == nil {
+		conditions = []database.TrackingCondition{}
+	}
+
+	json.NewEncoder(w).Encode(common.ReturnApi(conditions, "Get conditions success!"))
+}
+
+func createTrackingConditionHandler(w http.ResponseWriter, r *http.Request) {
+	payload, ok := decodeConditionRequest(w, r)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	trackingID, userID, ok := conditionScope(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	conditionService := database.NewTrackingConditionService(database.Repos.TrackingConditions)
+	condition, err := conditionService.Insert(ctx, database.TrackingCondition{
+		TrackingID:      trackingID,
+		UserID:          userID,
+		Condition:       payload.Condition,
+		Price:           payload.Price,
+		Percent:         payload.Percent,
+		Margin:          payload.Margin,
+		WindowHours:     payload.WindowHours,
+		CooldownMinutes: payload.CooldownMinutes,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusInternalServerError, common.InternalServerErrorCode, common.InternalServerMsg))
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(common.ResponseApi{
+		Status:   http.StatusCreated,
+		Message:  "Create condition success!",
+		Metadata: condition,
+	})
+}
+
+// findUserCondition loads the condition of the url once it is sure it
+// belongs to the user, or writes the error response.
+func findUserCondition(ctx context.Context, w http.ResponseWriter, r *http.Request, conditionService *database.TrackingConditionService) (database.TrackingCondition, bool) {
+	trackingID, userID, ok := conditionScope(ctx, w, r)
+	if !ok {
+		return database.TrackingCondition{}, false
+	}
+	conditionID, err := primitive.ObjectIDFromHex(mux.Vars(r)["conditionId"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusNotFound, common.ConditionNotFoundCode, common.ConditionNotFoundMsg))
+		return database.TrackingCondition{}, false
+	}
+	query := conditionQuery(trackingID, userID)
+	query.ID = conditionID
+	condition, err := conditionService.FindOne(ctx, query)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusNotFound, common.ConditionNotFoundCode, common.ConditionNotFoundMsg))
+		return database.TrackingCondition{}, false
+	}
+	return condition, true
+}
+
+func updateTrackingConditionHandler(w http.ResponseWriter, r *http.Request) {
+	payload, ok := decodeConditionRequest(w, r)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conditionService := database.NewTrackingConditionService(database.Repos.TrackingConditions)
+	condition, ok := findUserCondition(ctx, w, r, conditionService)
+	if !ok {
+		return
+	}
+
+	condition.Condition = payload.Condition
+	condition.Price = payload.Price
+	condition.Percent = payload.Percent
+	condition.Margin = payload.Margin
+	condition.WindowHours = payload.WindowHours
+	condition.CooldownMinutes = payload.CooldownMinutes
+	// an edited condition is re-armed
+	condition.Fired = false
+	condition.UpdatedAt = time.Now()
+	conditionID, _ := primitive.ObjectIDFromHex(condition.ID)
+	_, err := conditionService.Update(ctx, conditionID, condition)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusInternalServerError, common.InternalServerErrorCode, common.InternalServerMsg))
+		return
+	}
+
+	json.NewEncoder(w).Encode(common.ReturnApi(condition, "Update condition success!"))
+}
+
+func deleteTrackingConditionHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conditionService := database.NewTrackingConditionService(database.Repos.TrackingConditions)
+	condition, ok := findUserCondition(ctx, w, r, conditionService)
+	if !ok {
+		return
+	}
+
+	conditionID, _ := primitive.ObjectIDFromHex(condition.ID)
+	_, err := conditionService.Remove(ctx, conditionID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusInternalServerError, common.InternalServerErrorCode, common.InternalServerMsg))
+		return
+	}
+
+	json.NewEncoder(w).Encode(common.ReturnApi(true, "Delete condition success!"))
+}
+
+func SetupTrackingConditionsApiRoutes(router *mux.Router) {
+	auth := middleware.ConditionAuth{
+		NeedVerify: true,
+	}
+	router.HandleFunc("/api/trackings/{id}/conditions", middleware.AuthMiddleware(getTrackingConditionsHandler, auth)).Methods("GET")
+	router.HandleFunc("/api/trackings/{id}/conditions", middleware.AuthMiddleware(createTrackingConditionHandler, auth)).Methods("POST")
+	router.HandleFunc("/api/trackings/{id}/conditions/{conditionId}", middleware.AuthMiddleware(updateTrackingConditionHandler, auth)).Methods("PUT")
+	router.HandleFunc("/api/trackings/{id}/conditions/{conditionId}", middleware.AuthMiddleware(deleteTrackingConditionHandler, auth)).Methods("DELETE")
+}
@@ -3,8 +3,10 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -12,10 +14,10 @@ import (
 	"github.com/bonnguyenitc/shopee-stracks/back-end-go/crawl"
 	"github.com/bonnguyenitc/shopee-stracks/back-end-go/database"
 	"github.com/bonnguyenitc/shopee-stracks/back-end-go/middleware"
+	"github.com/go-playground/validator/v10"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 
-	"github.com/bonnguyenitc/shopee-stracks/back-end-go/utils"
 	"github.com/gorilla/mux"
 )
 
@@ -43,7 +45,15 @@ func trackingHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// check item exist in database
-	productIdShopee, err := strconv.ParseInt(utils.GetProductIDFromUrl(url), 10, 64)
+	shopId, itemId, err := crawl.ParseProductUrl(url)
+
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusBadRequest, common.ProductNotFoundCode, common.ProductNotFoundMessage))
+		return
+	}
+
+	productIdShopee, err := strconv.ParseInt(itemId, 10, 64)
 
 	if productIdShopee == 0 || err != nil {
 		w.WriteHeader(http.StatusBadRequest)
@@ -51,8 +61,7 @@ func trackingHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	// get product from database
-	mongoProductRepo := database.NewMongoProductRepository(database.MongoDB.Collection(database.ProductCollectionName))
-	productService := database.NewProductService(mongoProductRepo)
+	productService := database.NewProductService(database.Repos.Products)
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -60,27 +69,33 @@ func trackingHandler(w http.ResponseWriter, r *http.Request) {
 
 	if productExist.IDShopee == 0 && err != nil {
 		// insert product to database
-		// get products from url
-		var shopId string = utils.GetShopIdFromString(url)
-
-		products, err := crawl.GetProductsByShopID(shopId)
+		// get product from url
+		product, err := crawl.GetProduct(shopId, itemId)
 
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusInternalServerError, common.InternalServerMsg, common.InternalServerMsg))
+		if crawl.IsUnavailable(err) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusServiceUnavailable, common.SourceUnavailableCode, common.SourceUnavailableMsg))
 			return
 		}
 
-		if len(products) == 0 {
+		if errors.Is(err, crawl.ErrProductNotFound) {
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusBadRequest, common.ProductNotFoundCode, common.ProductNotFoundMessage))
 			return
 		}
 
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusInternalServerError, common.InternalServerMsg, common.InternalServerMsg))
+			return
+		}
+
+		products := []database.Product{product}
+
 		// save Shop if not exist
 		var shopIdFromDB primitive.ObjectID
 		if shopId != "" && len(products) > 0 {
-			shopService := database.NewShopService(database.NewMongoShopRepository(database.MongoDB.Collection(database.ShopCollectionName)))
+			shopService := database.NewShopService(database.Repos.Shops)
 			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 			defer cancel()
 			shopId, _ := strconv.ParseInt(shopId, 10, 64)
@@ -105,21 +120,6 @@ func trackingHandler(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 
-		// find productId in product list
-		found := false
-		for _, product := range products {
-			if product.IDShopee == productIdShopee {
-				found = true
-				break
-			}
-		}
-
-		if !found {
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusBadRequest, common.ProductNotFoundCode, common.ProductNotFoundMessage))
-			return
-		}
-
 		// insert product to database
 		done := make(chan bool)
 		go insertProductToDatabase(products, shopIdFromDB, done)
@@ -127,8 +127,8 @@ func trackingHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// insert tracking to database
-	mongoTrackingRepo := database.NewMongoTrackingRepository(database.MongoDB.Collection(database.TrackingCollectionName))
-	trackingService := database.NewTrackingService(mongoTrackingRepo)
+	trackingService := database.NewTrackingService(database.Repos.Trackings)
+	subscriptionService := newTrackingSubscriptionService()
 	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -158,7 +158,6 @@ func trackingHandler(w http.ResponseWriter, r *http.Request) {
 		// insert tracking to database
 		pp := database.Tracking{
 			IDShopee:  productIdShopee,
-			UserID:    userIDObj,
 			Status:    true,
 			ShopeeUrl: url,
 		}
@@ -177,8 +176,17 @@ func trackingHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		_, err = subscriptionService.Subscribe(ctx, userIDObj, trackingID.(primitive.ObjectID))
+
+		if err != nil {
+			trackingService.Remove(ctx, trackingID.(primitive.ObjectID))
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusBadRequest, common.TrackingFailCode, common.TrackingFailMessage))
+			return
+		}
+
 		// insert tracking condition to database
-		trackingConditionService := database.NewTrackingConditionService(database.NewMongoTrackingConditionRepository(database.MongoDB.Collection(database.TrackingConditionCollectionName)))
+		trackingConditionService := database.NewTrackingConditionService(database.Repos.TrackingConditions)
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
@@ -189,6 +197,7 @@ func trackingHandler(w http.ResponseWriter, r *http.Request) {
 		})
 
 		if err != nil {
+			subscriptionService.Unsubscribe(ctx, userIDObj, trackingID.(primitive.ObjectID))
 			trackingService.Remove(ctx, trackingID.(primitive.ObjectID))
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusBadRequest, common.TrackingFailCode, common.TrackingFailMessage))
@@ -206,11 +215,7 @@ func trackingHandler(w http.ResponseWriter, r *http.Request) {
 	if tracking.Product == nil && productExist.IDShopee != 0 {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
-		_, err = trackingService.Update(ctx, tracking.ID, bson.M{
-			"product": bson.D{
-				{Key: "$ref", Value: database.ProductCollectionName}, {Key: "$id", Value: productExist.ID},
-			},
-		})
+		_, err = trackingService.Update(ctx, tracking.ID, database.TrackingUpdate{ProductID: productExist.ID})
 
 		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
@@ -225,53 +230,52 @@ func trackingHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// find user in trackings list of product
-	exist, err := trackingService.CheckUserInTracking(ctx, tracking.ID, userIDObj)
+	// subscribe the user to the tracking of the product
+	subscribed, err := subscriptionService.Subscribe(ctx, userIDObj, tracking.ID)
 
 	if err != nil {
-		// insert user to trackings list of product
-		tracking, err = trackingService.AddNewUserToTracking(ctx, tracking.ID, userIDObj)
-
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusBadRequest, common.TrackingFailCode, common.TrackingFailMessage))
-			return
-		}
-
-		// insert tracking condition to database
-		trackingConditionService := database.NewTrackingConditionService(database.NewMongoTrackingConditionRepository(database.MongoDB.Collection(database.TrackingConditionCollectionName)))
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusBadRequest, common.TrackingFailCode, common.TrackingFailMessage))
+		return
+	}
 
-		_, err = trackingConditionService.Insert(ctx, database.TrackingCondition{
-			TrackingID: tracking.ID,
-			Condition:  database.LESS_THAN,
-			UserID:     userIDObj,
-		})
+	if !subscribed {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusBadRequest, common.TrackingExistCode, common.TrackingExistMessage))
+		return
+	}
 
-		if err != nil {
-			trackingService.UnTracking(ctx, tracking.ID, userIDObj)
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusBadRequest, common.TrackingFailCode, common.TrackingFailMessage))
-			return
-		}
+	// insert tracking condition to database
+	trackingConditionService := database.NewTrackingConditionService(database.Repos.TrackingConditions)
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-		json.NewEncoder(w).Encode(common.ResponseApi{
-			Status:   http.StatusOK,
-			Message:  common.TrackingSuccessMessage,
-			Metadata: true,
-		})
-	}
+	_, err = trackingConditionService.Insert(ctx, database.TrackingCondition{
+		TrackingID: tracking.ID,
+		Condition:  database.LESS_THAN,
+		UserID:     userIDObj,
+	})
 
-	if exist {
+	if err != nil {
+		subscriptionService.Unsubscribe(ctx, userIDObj, tracking.ID)
 		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusBadRequest, common.TrackingExistCode, common.TrackingExistMessage))
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusBadRequest, common.TrackingFailCode, common.TrackingFailMessage))
+		return
 	}
+
+	json.NewEncoder(w).Encode(common.ResponseApi{
+		Status:   http.StatusOK,
+		Message:  common.TrackingSuccessMessage,
+		Metadata: true,
+	})
+}
+
+func newTrackingSubscriptionService() *database.TrackingSubscriptionService {
+	return database.NewTrackingSubscriptionService(database.Repos.TrackingSubscriptions)
 }
 
 func insertProductToDatabase(products []database.Product, shopID primitive.ObjectID, done chan bool) {
-	mongoProductRepo := database.NewMongoProductRepository(database.MongoDB.Collection(database.ProductCollectionName))
-	productService := database.NewProductService(mongoProductRepo)
+	productService := database.NewProductService(database.Repos.Products)
 	var wg sync.WaitGroup
 	for _, product := range products {
 		wg.Add(1)
@@ -297,7 +301,7 @@ func unTrackingHandler(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("user_id").(string)
 	vars := mux.Vars(r)
 	id := vars["id"]
-	trackingService := database.NewTrackingService(database.NewMongoTrackingRepository(database.MongoDB.Collection(database.TrackingCollectionName)))
+	trackingService := database.NewTrackingService(database.Repos.Trackings)
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	idObj, err := primitive.ObjectIDFromHex(id)
@@ -324,30 +328,29 @@ func unTrackingHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	exist, _ := trackingService.CheckUserInTracking(ctx, tracking.ID, userIdObj)
+	// the subscription is archived, the user keeps their nickname and notes
+	unsubscribed, err := newTrackingSubscriptionService().Unsubscribe(ctx, userIdObj, tracking.ID)
 
-	if !exist {
+	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusBadRequest, common.TrackingNotFoundCode, common.TrackingNotFoundMsg))
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusBadRequest, common.UnTrackingFailCode, common.UnTrackingFailMsg))
 		return
 	}
 
-	_, err = trackingService.UnTracking(ctx, tracking.ID, userIdObj)
-
-	if err != nil {
+	if !unsubscribed {
 		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusBadRequest, common.UnTrackingFailCode, common.UnTrackingFailMsg))
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusBadRequest, common.TrackingNotFoundCode, common.TrackingNotFoundMsg))
 		return
 	}
 
 	// remove tracking condition
-	trackingConditionService := database.NewTrackingConditionService(database.NewMongoTrackingConditionRepository(database.MongoDB.Collection(database.TrackingConditionCollectionName)))
+	trackingConditionService := database.NewTrackingConditionService(database.Repos.TrackingConditions)
 	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	removed, err := trackingConditionService.RemoveByFilter(ctx, bson.M{
-		"tracking": bson.D{{Key: "$ref", Value: database.TrackingCollectionName}, {Key: "$id", Value: tracking.ID}},
-		"user":     bson.D{{Key: "$ref", Value: database.UserCollectionName}, {Key: "$id", Value: userIdObj}},
+	removed, err := trackingConditionService.RemoveAll(ctx, database.TrackingConditionQuery{
+		TrackingID: tracking.ID,
+		UserID:     userIdObj,
 	})
 
 	if err != nil {
@@ -368,7 +371,224 @@ func unTrackingHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusBadRequest, common.UnTrackingFailCode, common.UnTrackingFailMsg))
 }
 
+// TrackingSummary is a tracking of the user with the product, its latest
+// prices and how the price moved since the user started tracking it.
+type TrackingSummary struct {
+	Tracking      database.Tracking             `json:"tracking"`
+	Subscription  database.TrackingSubscription `json:"subscription"`
+	Product       *database.Product             `json:"product"`
+	LatestPrices  []database.Price              `json:"latest_prices"`
+	Conditions    []database.TrackingCondition  `json:"conditions"`
+	TrackingSince time.Time                     `json:"tracking_since"`
+	CurrentPrice  int64                         `json:"current_price"`
+	StartPrice    int64                         `json:"start_price"`
+	Change        int64                         `json:"change"`
+	ChangePercent float64                       `json:"change_percent"`
+	AllTimeLow    *database.Price               `json:"all_time_low"`
+}
+
+func getTrackingsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	userIDObj, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusUnauthorized, common.UnauthorizedCode, common.UnauthorizedMsg))
+		return
+	}
+	limit, page := parsePagination(r, 20)
+
+	trackingService := database.NewTrackingService(database.Repos.Trackings)
+	productService := database.NewProductService(database.Repos.Products)
+	priceService := database.NewPriceService(database.Repos.Prices)
+	conditionService := database.NewTrackingConditionService(database.Repos.TrackingConditions)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	subscriptions, err := newTrackingSubscriptionService().FindPageByUserID(ctx, userIDObj, limit, page)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusInternalServerError, common.InternalServerErrorCode, common.InternalServerMsg))
+		return
+	}
+	trackingIDs := make([]primitive.ObjectID, len(subscriptions.Data))
+	for i, subscription := range subscriptions.Data {
+		trackingIDs[i] = subscription.TrackingID
+	}
+	trackings, err := trackingService.FindByIDs(ctx, trackingIDs)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusInternalServerError, common.InternalServerErrorCode, common.InternalServerMsg))
+		return
+	}
+	trackingByID := map[primitive.ObjectID]database.Tracking{}
+	for _, tracking := range trackings {
+		trackingByID[tracking.ID] = tracking
+	}
+
+	// the conditions, products and prices of the page are loaded at once
+	conditions, err := conditionService.FindAll(ctx, database.TrackingConditionQuery{
+		TrackingIDs: trackingIDs,
+		UserID:      userIDObj,
+		ActiveOnly:  true,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusInternalServerError, common.InternalServerErrorCode, common.InternalServerMsg))
+		return
+	}
+	conditionsByTracking := map[primitive.ObjectID][]database.TrackingCondition{}
+	for _, condition := range conditions {
+		trackingID, _ := condition.Tracking.Map()["$id"].(primitive.ObjectID)
+		conditionsByTracking[trackingID] = append(conditionsByTracking[trackingID], condition)
+	}
+
+	productIDs := []primitive.ObjectID{}
+	since := map[primitive.ObjectID]time.Time{}
+	for _, subscription := range subscriptions.Data {
+		tracking, ok := trackingByID[subscription.TrackingID]
+		if !ok {
+			continue
+		}
+		if productID, ok := tracking.Product.Map()["$id"].(primitive.ObjectID); ok {
+			productIDs = append(productIDs, productID)
+			since[productID] = subscription.CreatedAt
+		}
+	}
+	products, err := productService.FindByIDs(ctx, productIDs)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusInternalServerError, common.InternalServerErrorCode, common.InternalServerMsg))
+		return
+	}
+	productByID := map[primitive.ObjectID]database.Product{}
+	for _, product := range products {
+		productByID[product.ID] = product
+	}
+	recent, err := priceService.FindRecentByProducts(ctx, productIDs, 2)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusInternalServerError, common.InternalServerErrorCode, common.InternalServerMsg))
+		return
+	}
+	starts, err := priceService.FindAtByProducts(ctx, since)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusInternalServerError, common.InternalServerErrorCode, common.InternalServerMsg))
+		return
+	}
+	lows, err := priceService.FindLowestByProducts(ctx, productIDs)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusInternalServerError, common.InternalServerErrorCode, common.InternalServerMsg))
+		return
+	}
+
+	summaries := []TrackingSummary{}
+	for _, subscription := range subscriptions.Data {
+		tracking, ok := trackingByID[subscription.TrackingID]
+		if !ok {
+			continue
+		}
+		summary := TrackingSummary{
+			Tracking:      tracking,
+			Subscription:  subscription,
+			LatestPrices:  []database.Price{},
+			Conditions:    []database.TrackingCondition{},
+			TrackingSince: subscription.CreatedAt,
+		}
+		if conditions, ok := conditionsByTracking[tracking.ID]; ok {
+			summary.Conditions = conditions
+		}
+
+		productID, ok := tracking.Product.Map()["$id"].(primitive.ObjectID)
+		if !ok {
+			summaries = append(summaries, summary)
+			continue
+		}
+		if product, ok := productByID[productID]; ok {
+			summary.Product = &product
+		}
+		if prices, ok := recent[productID]; ok {
+			summary.LatestPrices = prices
+		}
+		if len(summary.LatestPrices) > 0 {
+			summary.CurrentPrice = summary.LatestPrices[0].Price
+		}
+		if start, ok := starts[productID]; ok {
+			summary.StartPrice = start.Price
+		}
+		if summary.StartPrice > 0 && summary.CurrentPrice > 0 {
+			summary.Change = summary.CurrentPrice - summary.StartPrice
+			summary.ChangePercent = float64(summary.Change) * 100 / float64(summary.StartPrice)
+		}
+		if low, ok := lows[productID]; ok {
+			summary.AllTimeLow = &low
+		}
+		summaries = append(summaries, summary)
+	}
+
+	json.NewEncoder(w).Encode(common.ReturnApi(database.DataWithPagination[TrackingSummary]{
+		Data:        summaries,
+		TotalItems:  subscriptions.TotalItems,
+		TotalPages:  subscriptions.TotalPages,
+		CurrentPage: subscriptions.CurrentPage,
+		Limit:       subscriptions.Limit,
+	}, "Get trackings success!"))
+}
+
+// TrackingSubscriptionRequest names a tracking of the user and keeps notes
+// on it.
+type TrackingSubscriptionRequest struct {
+	Nickname string `json:"nickname" validate:"max=100"`
+	Notes    string `json:"notes" validate:"max=2000"`
+}
+
+func updateTrackingSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	trackingID, userID, ok := conditionScope(ctx, w, r)
+	if !ok {
+		return
+	}
+	var payload TrackingSubscriptionRequest
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err == nil {
+		err = validator.New().Struct(payload)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusBadRequest, common.InvalidSubscriptionCode, common.InvalidSubscriptionMsg))
+		return
+	}
+
+	subscriptionService := newTrackingSubscriptionService()
+	updated, err := subscriptionService.Update(ctx, userID, trackingID, strings.TrimSpace(payload.Nickname), strings.TrimSpace(payload.Notes))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusInternalServerError, common.InternalServerErrorCode, common.InternalServerMsg))
+		return
+	}
+	if !updated {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusNotFound, common.TrackingNotFoundCode, common.TrackingNotFoundMsg))
+		return
+	}
+	subscription, err := subscriptionService.Find(ctx, userID, trackingID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusInternalServerError, common.InternalServerErrorCode, common.InternalServerMsg))
+		return
+	}
+	json.NewEncoder(w).Encode(common.ReturnApi(subscription, "Update tracking success!"))
+}
+
 func SetupTrackingsApiRoutes(router *mux.Router) {
+	router.HandleFunc("/api/trackings", middleware.AuthMiddleware(getTrackingsHandler, middleware.ConditionAuth{
+		NeedVerify: true,
+	})).Methods("GET")
+	router.HandleFunc("/api/trackings/{id}", middleware.AuthMiddleware(updateTrackingSubscriptionHandler, middleware.ConditionAuth{
+		NeedVerify: true,
+	})).Methods("PUT")
 	router.HandleFunc("/api/tracking-product", middleware.AuthMiddleware(trackingHandler, middleware.ConditionAuth{
 		NeedVerify: true,
 	})).Methods("POST")
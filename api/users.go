@@ -4,20 +4,21 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/bonnguyenitc/shopee-stracks/back-end-go/common"
 	"github.com/bonnguyenitc/shopee-stracks/back-end-go/database"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/logs"
 	"github.com/bonnguyenitc/shopee-stracks/back-end-go/middleware"
 	"github.com/bonnguyenitc/shopee-stracks/back-end-go/templates"
 	"github.com/bonnguyenitc/shopee-stracks/back-end-go/utils"
 	"github.com/go-playground/validator/v10"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/mux"
-	"go.mongodb.org/mongo-driver/bson"
+	"github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -41,6 +42,16 @@ type VerifiedEmailRequest struct {
 	Type  string `json:"type" validate:"required"`
 }
 
+// UserPreferencesRequest sets how the user gets the alerts, the fields left
+// empty are kept. The quiet hours are set together, equal ones turn them off.
+type UserPreferencesRequest struct {
+	Locale     string `json:"locale,omitempty" validate:"omitempty,oneof=en vi"`
+	Digest     string `json:"digest,omitempty" validate:"omitempty,oneof=instant hourly daily"`
+	Timezone   string `json:"timezone,omitempty" validate:"omitempty,timezone"`
+	QuietStart string `json:"quiet_start,omitempty" validate:"required_with=QuietEnd,omitempty,datetime=15:04"`
+	QuietEnd   string `json:"quiet_end,omitempty" validate:"required_with=QuietStart,omitempty,datetime=15:04"`
+}
+
 type ResetPasswordRequest struct {
 	Token    string `json:"token" validate:"required"`
 	Password string `json:"password" validate:"required,min=8"`
@@ -67,9 +78,7 @@ func createUserHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	mongoUserRepo := database.NewMongoUserRepository(database.MongoDB.Collection(database.UserCollectionName))
-
-	userService := database.NewUserService(mongoUserRepo)
+	userService := database.NewUserService(database.Repos.Users)
 
 	user, _ := userService.FindByEmail(ctx, payload.Email)
 
@@ -87,11 +96,14 @@ func createUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// the emails are in the language of the browser until the user picks one
+	locale := templates.Locale(r.Header.Get("Accept-Language"))
 	newUser, err := userService.Insert(ctx, database.User{
 		Email:    payload.Email,
 		Role:     database.USER_ROLE,
 		Verified: false,
 		Password: string(hashedPassword),
+		Locale:   locale,
 	})
 
 	if err != nil {
@@ -105,8 +117,7 @@ func createUserHandler(w http.ResponseWriter, r *http.Request) {
 		token, err := utils.GenerateTokenVerifyEmail()
 		// save token to database
 		if err == nil {
-			mongoTokenRepo := database.NewMongoTokenRepository(database.MongoDB.Collection(database.TokenCollectionName))
-			tokenService := database.NewTokenService(mongoTokenRepo)
+			tokenService := database.NewTokenService(database.Repos.Tokens)
 			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 			defer cancel()
 
@@ -117,11 +128,29 @@ func createUserHandler(w http.ResponseWriter, r *http.Request) {
 				UserId:    newUser.(primitive.ObjectID),
 			})
 
-			log.Println(utils.SendEmail(payload.Email, templates.CreateEmailSendTokenVerifyUserTemplate(templates.InfoEmailSendTokenVerifyUser{
+			email, err := templates.CreateEmailSendTokenVerifyUserTemplate(templates.InfoEmailSendTokenVerifyUser{
+				Locale:   locale,
 				Email:    payload.Email,
 				UrlToken: fmt.Sprintf("%s/verify-email/%s", os.Getenv("BASE_URL"), token),
-				Title:    "Verify your email",
-			})))
+			})
+			if err == nil {
+				_, err = queueEmail(ctx, database.Email{
+					Kind:    database.EMAIL_VERIFY,
+					To:      payload.Email,
+					Subject: email.Subject,
+					HTML:    email.HTML,
+					Text:    email.Text,
+				})
+			}
+			if err != nil {
+				logs.LogWarning(logrus.Fields{
+					"user": newUser.(primitive.ObjectID).Hex(),
+					"data": err.Error(),
+				}, "queue verify email")
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusInternalServerError, common.InternalServerErrorCode, common.InternalServerMsg))
+				return
+			}
 		}
 
 		json.NewEncoder(w).Encode(common.ResponseApi{
@@ -163,9 +192,7 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	mongoUserRepo := database.NewMongoUserRepository(database.MongoDB.Collection(database.UserCollectionName))
-
-	userService := database.NewUserService(mongoUserRepo)
+	userService := database.NewUserService(database.Repos.Users)
 
 	user, _ := userService.FindByEmail(ctx, payload.Email)
 
@@ -233,14 +260,13 @@ func verifyTokenHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// check token exist in database
-	mongoTokenRepo := database.NewMongoTokenRepository(database.MongoDB.Collection(database.TokenCollectionName))
-	tokenService := database.NewTokenService(mongoTokenRepo)
+	tokenService := database.NewTokenService(database.Repos.Tokens)
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	tokenObj, err := tokenService.FindOneByFilter(ctx, bson.M{
-		"token": payload.Token,
-		"type":  payload.Type,
+	tokenObj, err := tokenService.FindOne(ctx, database.TokenQuery{
+		Token: payload.Token,
+		Type:  payload.Type,
 	})
 
 	if err != nil {
@@ -260,13 +286,34 @@ func verifyTokenHandler(w http.ResponseWriter, r *http.Request) {
 
 	// update user to database
 	if payload.Type == database.VerifyEmail {
-		mongoUserRepo := database.NewMongoUserRepository(database.MongoDB.Collection(database.UserCollectionName))
-		userService := database.NewUserService(mongoUserRepo)
+		userService := database.NewUserService(database.Repos.Users)
 		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
-		err = userService.Update(ctx, userID, bson.M{
-			"verified": true,
-		})
+		verified := true
+		err = userService.Update(ctx, userID, database.UserUpdate{Verified: &verified})
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusInternalServerError, common.InternalServerErrorCode, common.InternalServerMsg))
+			return
+		}
+	}
+
+	// the channel of the token is confirmed if it still goes to the address
+	if payload.Type == database.VerifyChannel {
+		userService := database.NewUserService(database.Repos.Users)
+		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		user, err := userService.FindById(ctx, userID)
+		if err == nil {
+			channels := user.Channels
+			for i, channel := range channels {
+				if channel.Type == database.CHANNEL_EMAIL && strings.EqualFold(channel.Target, tokenObj.Target) {
+					channels[i].Verified = true
+				}
+			}
+			err = userService.Update(ctx, userID, database.UserUpdate{Channels: &channels})
+		}
 
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
@@ -276,13 +323,11 @@ func verifyTokenHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// remove token from database
-	if payload.Type == database.VerifyEmail {
+	if payload.Type == database.VerifyEmail || payload.Type == database.VerifyChannel {
 		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		done, err := tokenService.Remove(ctx, bson.M{
-			"token": payload.Token,
-		})
+		done, err := tokenService.Remove(ctx, database.TokenQuery{Token: payload.Token})
 
 		if err != nil || !done {
 			w.WriteHeader(http.StatusInternalServerError)
@@ -295,6 +340,9 @@ func verifyTokenHandler(w http.ResponseWriter, r *http.Request) {
 	if payload.Type == database.ResetPassword {
 		message = "Verify token reset password success!"
 	}
+	if payload.Type == database.VerifyChannel {
+		message = "Verify token verify channel success!"
+	}
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(common.ResponseApi{
@@ -321,14 +369,12 @@ func sendTokenResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	// save token to database
-	mongoTokenRepo := database.NewMongoTokenRepository(database.MongoDB.Collection(database.TokenCollectionName))
-	tokenService := database.NewTokenService(mongoTokenRepo)
+	tokenService := database.NewTokenService(database.Repos.Tokens)
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	// check email exist in database
-	mongoUserRepo := database.NewMongoUserRepository(database.MongoDB.Collection(database.UserCollectionName))
-	userService := database.NewUserService(mongoUserRepo)
+	userService := database.NewUserService(database.Repos.Users)
 	user, _ := userService.FindByEmail(ctx, payload.Email)
 
 	if user.Email == "" {
@@ -350,11 +396,25 @@ func sendTokenResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Println(utils.SendEmail(payload.Email, templates.CreateEmailSendTokenResetPasswordTemplate(templates.InfoEmailSendTokenResetPassword{
+	email, err := templates.CreateEmailSendTokenResetPasswordTemplate(templates.InfoEmailSendTokenResetPassword{
+		Locale:   templates.Locale(user.Locale),
 		Email:    payload.Email,
 		UrlToken: fmt.Sprintf("%s/reset-password/%s", os.Getenv("BASE_URL"), token),
-		Title:    "Reset your password",
-	})))
+	})
+	if err == nil {
+		_, err = queueEmail(ctx, database.Email{
+			Kind:    database.EMAIL_RESET,
+			To:      payload.Email,
+			Subject: email.Subject,
+			HTML:    email.HTML,
+			Text:    email.Text,
+		})
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusInternalServerError, common.InternalServerErrorCode, common.InternalServerMsg))
+		return
+	}
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(common.ResponseApi{
@@ -383,14 +443,13 @@ func resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// check token exist in database
-	mongoTokenRepo := database.NewMongoTokenRepository(database.MongoDB.Collection(database.TokenCollectionName))
-	tokenService := database.NewTokenService(mongoTokenRepo)
+	tokenService := database.NewTokenService(database.Repos.Tokens)
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	tokenObj, err := tokenService.FindOneByFilter(ctx, bson.M{
-		"token": payload.Token,
-		"type":  database.ResetPassword,
+	tokenObj, err := tokenService.FindOne(ctx, database.TokenQuery{
+		Token: payload.Token,
+		Type:  database.ResetPassword,
 	})
 
 	if err != nil {
@@ -409,8 +468,7 @@ func resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// update user to database
-	mongoUserRepo := database.NewMongoUserRepository(database.MongoDB.Collection(database.UserCollectionName))
-	userService := database.NewUserService(mongoUserRepo)
+	userService := database.NewUserService(database.Repos.Users)
 	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -422,10 +480,8 @@ func resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = userService.Update(ctx, userID, bson.M{
-		"password":   string(hashedPassword),
-		"updated_at": time.Now(),
-	})
+	password := string(hashedPassword)
+	err = userService.Update(ctx, userID, database.UserUpdate{Password: &password})
 
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -437,9 +493,7 @@ func resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	done, err := tokenService.Remove(ctx, bson.M{
-		"token": payload.Token,
-	})
+	done, err := tokenService.Remove(ctx, database.TokenQuery{Token: payload.Token})
 
 	if err != nil || !done {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -462,8 +516,7 @@ func getUserHandler(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("user_id").(string)
 
 	// get user from database
-	mongoUserRepo := database.NewMongoUserRepository(database.MongoDB.Collection(database.UserCollectionName))
-	userService := database.NewUserService(mongoUserRepo)
+	userService := database.NewUserService(database.Repos.Users)
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -481,12 +534,56 @@ func getUserHandler(w http.ResponseWriter, r *http.Request) {
 		Message: "Get user success!",
 		Metadata: map[string]any{
 			// "user_id": user.ID,
-			"email": user.Email,
-			"role":  user.Role,
+			"email":       user.Email,
+			"role":        user.Role,
+			"locale":      templates.Locale(user.Locale),
+			"digest":      user.Digest,
+			"timezone":    user.Location().String(),
+			"quiet_start": user.QuietStart,
+			"quiet_end":   user.QuietEnd,
 		},
 	})
 }
 
+func updateUserPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	var payload UserPreferencesRequest
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err == nil {
+		err = validator.New().Struct(payload)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusBadRequest, common.InvalidPreferencesCode, common.InvalidPreferencesMsg))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	userService := database.NewUserService(database.Repos.Users)
+	// an empty preference is left as it is
+	set := func(value string) *string {
+		if value == "" {
+			return nil
+		}
+		return &value
+	}
+	preferences := database.UserUpdate{
+		Locale:     set(payload.Locale),
+		Digest:     set(payload.Digest),
+		Timezone:   set(payload.Timezone),
+		QuietStart: set(payload.QuietStart),
+		QuietEnd:   set(payload.QuietEnd),
+	}
+	err = userService.Update(ctx, r.Context().Value("user_id").(string), preferences)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusInternalServerError, common.InternalServerErrorCode, common.InternalServerMsg))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(common.ReturnApi(payload, "Update preferences success!"))
+}
+
 func SetupUsersApiRoutes(router *mux.Router) {
 	router.HandleFunc("/api/register", createUserHandler).Methods("POST")
 	router.HandleFunc("/api/login", loginHandler).Methods("POST")
@@ -496,4 +593,7 @@ func SetupUsersApiRoutes(router *mux.Router) {
 	router.HandleFunc("/api/user", middleware.AuthMiddleware(getUserHandler, middleware.ConditionAuth{
 		NeedVerify: false,
 	})).Methods("GET")
+	router.HandleFunc("/api/user/preferences", middleware.AuthMiddleware(updateUserPreferencesHandler, middleware.ConditionAuth{
+		NeedVerify: false,
+	})).Methods("PUT")
 }
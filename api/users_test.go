@@ -0,0 +1,42 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/database"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestUpdateUserPreferencesQuietHours(t *testing.T) {
+	database.Repos = database.NewMemoryRepositories()
+	id, _ := database.Repos.Users.Insert(context.Background(), database.User{Email: "a@example.com", Password: "secret"})
+	userID := id.(primitive.ObjectID).Hex()
+
+	for _, test := range []struct {
+		body   string
+		status int
+	}{
+		{`{"quiet_start":"22:00"}`, http.StatusBadRequest},
+		{`{"quiet_end":"07:00"}`, http.StatusBadRequest},
+		{`{"quiet_start":"22:00","quiet_end":"7h"}`, http.StatusBadRequest},
+		{`{"quiet_start":"22:00","quiet_end":"07:00"}`, http.StatusOK},
+		{`{"locale":"vi"}`, http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodPut, "/api/user/preferences", strings.NewReader(test.body))
+		req = req.WithContext(context.WithValue(req.Context(), "user_id", userID))
+		w := httptest.NewRecorder()
+		updateUserPreferencesHandler(w, req)
+		if w.Code != test.status {
+			t.Errorf("%s: status %d, want %d", test.body, w.Code, test.status)
+		}
+	}
+
+	user, _ := database.Repos.Users.FindById(context.Background(), userID)
+	if user.QuietStart != "22:00" || user.QuietEnd != "07:00" || user.Locale != "vi" {
+		t.Errorf("user = %+v", user)
+	}
+}
@@ -0,0 +1,102 @@
+// Command fixture records a live Shopee response into the crawl testdata and
+// shows which parsed fields changed compared to the golden file.
+//
+//	go run ./cmd/fixture -shop 88001
+//	go run ./cmd/fixture -url https://shopee.vn/product/88001/1900000001 -name basic
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/crawl"
+)
+
+func main() {
+	shopID := flag.String("shop", "", "shop id to record the recommend API for")
+	url := flag.String("url", "", "product url to record the page for")
+	name := flag.String("name", "", "fixture name, defaults to the shop id or item id")
+	dir := flag.String("dir", "crawl/testdata", "testdata directory")
+	allocator := flag.String("allocator", os.Getenv("HEADLESS_SHELL_URL"), "headless shell url")
+	updateGolden := flag.Bool("update-golden", false, "also rewrite the golden file")
+	flag.Parse()
+
+	source := crawl.NewChromedpSource(*allocator, crawl.NewProxyPoolFromEnv())
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+	defer cancel()
+
+	var kind, ext string
+	var data []byte
+	switch {
+	case *shopID != "":
+		kind, ext = crawl.FixtureRecommend, ".json"
+		if *name == "" {
+			*name = *shopID
+		}
+		body, err := source.RecommendBody(ctx, *shopID)
+		if err != nil {
+			log.Fatal(err)
+		}
+		data = body
+	case *url != "":
+		kind, ext = crawl.FixtureProduct, ".html"
+		_, itemID, err := crawl.ParseProductUrl(*url)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *name == "" {
+			*name = itemID
+		}
+		html, err := source.ProductHtml(ctx, *url)
+		if err != nil {
+			log.Fatal(err)
+		}
+		data = []byte(html)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	fixtureFile := filepath.Join(*dir, kind, *name+ext)
+	if err := os.WriteFile(fixtureFile, data, 0644); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("recorded", fixtureFile)
+
+	got, err := crawl.ParseFixture(kind, *name, data)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	goldenFile := filepath.Join(*dir, "golden", kind, *name+".json")
+	golden, err := os.ReadFile(goldenFile)
+	if err == nil {
+		var want crawl.FixtureResult
+		if err := json.Unmarshal(golden, &want); err != nil {
+			log.Fatal(err)
+		}
+		diffs := crawl.DiffFixtureResults(want, got)
+		for _, diff := range diffs {
+			fmt.Println("changed:", diff)
+		}
+		if len(diffs) == 0 {
+			fmt.Println("no field changed")
+		}
+	} else {
+		fmt.Println("no golden file yet", goldenFile)
+	}
+
+	if *updateGolden {
+		out, _ := json.MarshalIndent(got, "", "  ")
+		if err := os.WriteFile(goldenFile, append(out, '\n'), 0644); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("updated", goldenFile)
+	}
+}
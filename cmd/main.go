@@ -1,11 +1,13 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
 
 	"github.com/bonnguyenitc/shopee-stracks/back-end-go/api"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/crawl"
 	"github.com/bonnguyenitc/shopee-stracks/back-end-go/database"
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
@@ -33,15 +35,27 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	// setup index
-	database.SetupIndexed()
+	// refuse to run against a database the migrations did not run on
+	err = database.CheckMigrations(context.Background())
+	if err != nil {
+		log.Fatalf("%v, run go run ./cmd/migrate up", err)
+	}
+	// setup product source
+	_, err = crawl.DefaultSource()
+	if err != nil {
+		log.Fatal(err)
+	}
+	// setup selectors of the product page
+	err = crawl.SetupSelectors(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
 	// init router
 	router := mux.NewRouter()
 	// setup api
 	api.SetupRoutes(router)
 	// setup CORS
 	handler := cors.Default().Handler(router)
-	// jobs.RunCronJobs()
 	log.Fatal(http.ListenAndServe(":8000", handler))
 
 }
@@ -0,0 +1,89 @@
+// Command migrate applies or rolls back the migrations of the database. The
+// API and the worker refuse to start until every migration is applied.
+//
+//	go run ./cmd/migrate up          apply every pending migration
+//	go run ./cmd/migrate up 5        apply the pending migrations up to version 5
+//	go run ./cmd/migrate down        roll back the last migration
+//	go run ./cmd/migrate down 2      roll back the last 2 migrations
+//	go run ./cmd/migrate status      list the migrations and whether they were applied
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/database"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	timeout := flag.Duration("timeout", 30*time.Minute, "how long the migrations may run")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: migrate [flags] up [version] | down [steps] | status")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	command := flag.Arg(0)
+	number := 0
+	if flag.NArg() > 1 {
+		n, err := strconv.Atoi(flag.Arg(1))
+		if err != nil || n < 1 {
+			log.Fatalf("invalid number %q", flag.Arg(1))
+		}
+		number = n
+	}
+
+	// the env may come from the environment alone, like in a container
+	_ = godotenv.Load()
+	err := database.NewMongoDB(os.Getenv("DB_NAME"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	switch command {
+	case "up":
+		done, err := database.MigrateUp(ctx, number)
+		for _, migration := range done {
+			fmt.Printf("applied %d %s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(done) == 0 {
+			fmt.Println("nothing to apply")
+		}
+	case "down":
+		if number == 0 {
+			number = 1
+		}
+		done, err := database.MigrateDown(ctx, number)
+		for _, migration := range done {
+			fmt.Printf("rolled back %d %s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "status":
+		statuses, err := database.MigrationsStatus(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.Applied {
+				applied = "applied " + status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%4d  %-40s %s\n", status.Version, status.Name, applied)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
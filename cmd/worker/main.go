@@ -0,0 +1,88 @@
+// Command worker runs the crawl, notification, digest and email jobs apart
+// from the API.
+//
+//	go run ./cmd/worker -concurrency 4 -jobs crawl,notify,digest,email,cleanup -schedule
+//
+// On SIGTERM or SIGINT the worker stops leasing new jobs and exits once the
+// jobs it is running are finished.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/crawl"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/database"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/jobs"
+	"github.com/joho/godotenv"
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	concurrency := flag.Int("concurrency", 4, "number of jobs run at the same time, crawls also wait for a free tab (CRAWL_TABS)")
+	jobNames := flag.String("jobs", "crawl,notify,digest,email,cleanup", "comma separated jobs to run: crawl, notify, digest, email, cleanup")
+	id := flag.String("id", "", "worker id, defaults to hostname-pid")
+	schedule := flag.Bool("schedule", false, "also queue the jobs on every interval")
+	interval := flag.Duration("interval", time.Minute, "how often the scheduler looks for due shops")
+	flag.Parse()
+
+	types, err := jobs.JobTypes(strings.Split(*jobNames, ","))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *concurrency < 1 {
+		log.Fatal("concurrency must be at least 1")
+	}
+
+	file, err := os.OpenFile("storage/worker.log", os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+	logrus.SetOutput(file)
+	logrus.SetFormatter(&logrus.JSONFormatter{})
+	// load env
+	err = godotenv.Load()
+	if err != nil {
+		log.Fatal("Error loading .env file")
+	}
+	// setup database
+	err = database.NewMongoDB(os.Getenv("DB_NAME"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	// refuse to run against a database the migrations did not run on
+	err = database.CheckMigrations(context.Background())
+	if err != nil {
+		log.Fatalf("%v, run go run ./cmd/migrate up", err)
+	}
+	// setup product source
+	_, err = crawl.DefaultSource()
+	if err != nil {
+		log.Fatal(err)
+	}
+	// setup selectors of the product page
+	err = crawl.SetupSelectors(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	if *schedule {
+		go jobs.RunScheduler(ctx, *interval)
+	}
+	workerID := jobs.WorkerID(*id)
+	go jobs.RunProxyStatsPublisher(ctx, workerID, time.Minute)
+
+	log.Println("worker started, jobs:", types, "concurrency:", *concurrency)
+	jobs.RunWorkers(ctx, workerID, types, *concurrency)
+	log.Println("worker stopped")
+}
@@ -52,6 +52,22 @@ var (
 	TokenVerifyExpiredMsg    = "Token verify expired!"
 	UnauthorizedCode         = "UNAUTHORIZED"
 	UnauthorizedMsg          = "Unauthorized!"
+	ForbiddenCode            = "FORBIDDEN"
+	ForbiddenMsg             = "Forbidden!"
+	SourceUnavailableCode    = "SOURCE_UNAVAILABLE"
+	SourceUnavailableMsg     = "Source temporarily unavailable!"
+	ConditionNotFoundCode    = "CONDITION_NOT_FOUND"
+	ConditionNotFoundMsg     = "Condition not found!"
+	InvalidConditionCode     = "INVALID_CONDITION"
+	InvalidConditionMsg      = "Invalid condition!"
+	InvalidQueryCode         = "INVALID_QUERY"
+	InvalidQueryMsg          = "Invalid query!"
+	InvalidChannelCode       = "INVALID_CHANNEL"
+	InvalidChannelMsg        = "Invalid notification channel!"
+	InvalidPreferencesCode   = "INVALID_PREFERENCES"
+	InvalidPreferencesMsg    = "Invalid preferences!"
+	InvalidSubscriptionCode  = "INVALID_SUBSCRIPTION"
+	InvalidSubscriptionMsg   = "Invalid tracking nickname or notes!"
 	EmailOrPasswordWrongCode = "EMAIL_OR_PASSWORD_WRONG"
 	EmailOrPasswordWrongMsg  = "Email or password wrong!"
 )
@@ -0,0 +1,117 @@
+package crawl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+func TestFixturesGolden(t *testing.T) {
+	for _, kind := range []string{FixtureRecommend, FixtureProduct} {
+		files, err := filepath.Glob(filepath.Join("testdata", kind, "*"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range files {
+			name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+			t.Run(kind+"/"+name, func(t *testing.T) {
+				data, err := os.ReadFile(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := ParseFixture(kind, name, data)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				goldenFile := filepath.Join("testdata", "golden", kind, name+".json")
+				if *update {
+					out, _ := json.MarshalIndent(got, "", "  ")
+					if err := os.WriteFile(goldenFile, append(out, '\n'), 0644); err != nil {
+						t.Fatal(err)
+					}
+					return
+				}
+
+				data, err = os.ReadFile(goldenFile)
+				if err != nil {
+					t.Fatalf("missing golden file, run go test ./crawl -update: %v", err)
+				}
+				var golden FixtureResult
+				if err := json.Unmarshal(data, &golden); err != nil {
+					t.Fatal(err)
+				}
+				for _, diff := range DiffFixtureResults(golden, got) {
+					t.Error(diff)
+				}
+			})
+		}
+	}
+}
+
+func TestFixtureSourceMissingShop(t *testing.T) {
+	source := NewFixtureSource("testdata")
+	products, err := source.FetchShopProducts(context.Background(), "88001")
+	if (err != nil && !IsPartial(err)) || len(products) == 0 {
+		t.Fatalf("saved shop: %d products, err %v", len(products), err)
+	}
+	// a typo in a fixture name is not a shop without products
+	if _, err := source.FetchShopProducts(context.Background(), "8800l"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("missing shop: err %v, want os.ErrNotExist", err)
+	}
+}
+
+func TestValidateSelectors(t *testing.T) {
+	html, err := os.ReadFile(filepath.Join("testdata", "product", "basic.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateSelectors(Selectors(), string(html)); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := ParseSelectors(defaultSelectorsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a rotated class name is caught, a fallback fixes it
+	config.Fields["price"] = FieldSelectors{Scope: "product", Required: true, Chain: []Selector{{Query: ".rotated"}}}
+	err = ValidateSelectors(config, string(html))
+	if selectorErr, ok := err.(*SelectorError); !ok || len(selectorErr.Fields) != 1 || selectorErr.Fields[0] != "price" {
+		t.Fatalf("expected price to be reported, got %v", err)
+	}
+	config.Fields["price"] = FieldSelectors{Scope: "product", Required: true, Chain: []Selector{{Query: ".rotated"}, {Query: ".G27FPf"}}}
+	if err := ValidateSelectors(config, string(html)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseCount(t *testing.T) {
+	for _, test := range []struct {
+		text string
+		want int64
+	}{
+		{"1.234.567", 1234567},
+		{"1,234,567 sold", 1234567},
+		{"Đã bán 1,2k", 1200},
+		{"3.5tr", 3500000},
+		{"2M lượt thích", 2000000},
+		{"5 món", 5},
+		{"12 mẫu", 12},
+		{"840", 840},
+	} {
+		if got, ok := parseCount(test.text); !ok || got != test.want {
+			t.Errorf("parseCount(%q) = %d, %v, want %d", test.text, got, ok, test.want)
+		}
+	}
+	if _, ok := parseCount("no number"); ok {
+		t.Error("parseCount of a text without number should fail")
+	}
+}
@@ -0,0 +1,62 @@
+package crawl
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrBadPayload        = errors.New("unexpected recommend payload")
+	ErrInvalidProductUrl = errors.New("invalid product url")
+	ErrMissingField      = errors.New("missing field")
+	ErrNoProxy           = errors.New("all proxies are cooling down")
+	// the source refused to answer
+	ErrBlocked     = errors.New("blocked by source")
+	ErrRateLimited = errors.New("rate limited by source")
+	ErrCaptcha     = errors.New("captcha required by source")
+	// we refused to call the source
+	ErrBackoff     = errors.New("backing off from source")
+	ErrCircuitOpen = errors.New("crawls are paused after repeated blocks")
+)
+
+// isBlockErr reports whether the source refused to answer us.
+func isBlockErr(err error) bool {
+	return errors.Is(err, ErrBlocked) || errors.Is(err, ErrRateLimited) || errors.Is(err, ErrCaptcha)
+}
+
+// IsUnavailable reports whether the source can not be used for now, either
+// because it blocks us or because we back off from it. Callers should answer
+// with a "try again later" instead of "not found".
+func IsUnavailable(err error) bool {
+	return isBlockErr(err) || errors.Is(err, ErrBackoff) || errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrNoProxy)
+}
+
+// SkippedItem is an item of the recommend API that could not be decoded.
+type SkippedItem struct {
+	Index  int    `json:"index"`
+	ItemID int64  `json:"item_id,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// DecodeError is returned next to the products that were decoded when some
+// items of the payload had to be skipped.
+type DecodeError struct {
+	ShopID  string
+	Skipped []SkippedItem
+}
+
+func (e *DecodeError) Error() string {
+	reasons := make([]string, 0, len(e.Skipped))
+	for _, item := range e.Skipped {
+		reasons = append(reasons, fmt.Sprintf("item %d (%d): %s", item.Index, item.ItemID, item.Reason))
+	}
+	return fmt.Sprintf("shop %s: skipped %d items: %s", e.ShopID, len(e.Skipped), strings.Join(reasons, "; "))
+}
+
+// IsPartial reports whether err only says that some items were skipped,
+// in which case the returned products can still be used.
+func IsPartial(err error) bool {
+	var decodeErr *DecodeError
+	return errors.As(err, &decodeErr)
+}
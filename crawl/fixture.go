@@ -0,0 +1,98 @@
+package crawl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/database"
+)
+
+const (
+	FixtureRecommend = "recommend"
+	FixtureProduct   = "product"
+)
+
+// FixtureTime is used as "now" when parsing fixtures so that golden files
+// (flash sale end time) do not depend on when they are parsed.
+var FixtureTime = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// FixtureResult is what a fixture parses into. It is stored as the golden file.
+type FixtureResult struct {
+	Products []database.Product `json:"products"`
+	Skipped  []SkippedItem      `json:"skipped,omitempty"`
+	Error    string             `json:"error,omitempty"`
+}
+
+// ParseFixture parses a saved recommend API body or product page.
+func ParseFixture(kind string, name string, data []byte) (FixtureResult, error) {
+	switch kind {
+	case FixtureRecommend:
+		products, err := parseRecommendBody(name, data)
+		var decodeErr *DecodeError
+		if errors.As(err, &decodeErr) {
+			return FixtureResult{Products: products, Skipped: decodeErr.Skipped}, nil
+		}
+		return newFixtureResult(products, err), nil
+	case FixtureProduct:
+		product, err := parseProductDetail(string(data), FixtureTime)
+		if err != nil {
+			return newFixtureResult(nil, err), nil
+		}
+		return newFixtureResult([]database.Product{product}, nil), nil
+	}
+	return FixtureResult{}, fmt.Errorf("unknown fixture kind %s", kind)
+}
+
+func newFixtureResult(products []database.Product, err error) FixtureResult {
+	result := FixtureResult{Products: products}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// DiffFixtureResults lists the fields that changed between the golden result
+// and a freshly parsed one, e.g. "product 0 (123): price 100 -> 0".
+func DiffFixtureResults(golden FixtureResult, got FixtureResult) []string {
+	diffs := []string{}
+	if golden.Error != got.Error {
+		diffs = append(diffs, fmt.Sprintf("error %q -> %q", golden.Error, got.Error))
+	}
+	if len(golden.Products) != len(got.Products) {
+		diffs = append(diffs, fmt.Sprintf("products %d -> %d", len(golden.Products), len(got.Products)))
+	}
+	if len(golden.Skipped) != len(got.Skipped) {
+		diffs = append(diffs, fmt.Sprintf("skipped %d -> %d", len(golden.Skipped), len(got.Skipped)))
+	}
+	for i := 0; i < len(golden.Products) && i < len(got.Products); i++ {
+		before := productFields(golden.Products[i])
+		after := productFields(got.Products[i])
+		keys := []string{}
+		for key := range before {
+			keys = append(keys, key)
+		}
+		for key := range after {
+			if _, ok := before[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if !reflect.DeepEqual(before[key], after[key]) {
+				diffs = append(diffs, fmt.Sprintf("product %d (%d): %s %v -> %v", i, golden.Products[i].IDShopee, key, before[key], after[key]))
+			}
+		}
+	}
+	return diffs
+}
+
+func productFields(product database.Product) map[string]any {
+	fields := map[string]any{}
+	data, _ := json.Marshal(product)
+	json.Unmarshal(data, &fields)
+	return fields
+}
@@ -0,0 +1,181 @@
+package crawl
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/database"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/logs"
+	"github.com/sirupsen/logrus"
+)
+
+const shopeeHost = "shopee.vn"
+
+// GuardConfig tunes the back-off and the circuit breaker.
+type GuardConfig struct {
+	// first back-off after a block, doubled on every next block
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+	// that many blocks within the window pause every crawl for Pause
+	BreakerThreshold int
+	BreakerWindow    time.Duration
+	BreakerPause     time.Duration
+}
+
+// GuardConfigFromEnv reads CRAWL_BACKOFF_BASE, CRAWL_BACKOFF_MAX,
+// CRAWL_BREAKER_THRESHOLD, CRAWL_BREAKER_WINDOW and CRAWL_BREAKER_PAUSE.
+func GuardConfigFromEnv() GuardConfig {
+	config := GuardConfig{
+		BackoffBase:      30 * time.Second,
+		BackoffMax:       30 * time.Minute,
+		BreakerThreshold: 5,
+		BreakerWindow:    10 * time.Minute,
+		BreakerPause:     30 * time.Minute,
+	}
+	if d, err := time.ParseDuration(os.Getenv("CRAWL_BACKOFF_BASE")); err == nil {
+		config.BackoffBase = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("CRAWL_BACKOFF_MAX")); err == nil {
+		config.BackoffMax = d
+	}
+	if n, err := strconv.Atoi(os.Getenv("CRAWL_BREAKER_THRESHOLD")); err == nil {
+		config.BreakerThreshold = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("CRAWL_BREAKER_WINDOW")); err == nil {
+		config.BreakerWindow = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("CRAWL_BREAKER_PAUSE")); err == nil {
+		config.BreakerPause = d
+	}
+	return config
+}
+
+type hostState struct {
+	blocks int
+	until  time.Time
+}
+
+// Guard keeps an exponential back-off with jitter per host, and a circuit
+// breaker that pauses all crawls after repeated blocks.
+type Guard struct {
+	mu        sync.Mutex
+	config    GuardConfig
+	hosts     map[string]*hostState
+	blocks    []time.Time
+	openUntil time.Time
+	now       func() time.Time
+	jitter    func() float64
+}
+
+func NewGuard(config GuardConfig) *Guard {
+	return &Guard{
+		config: config,
+		hosts:  map[string]*hostState{},
+		now:    time.Now,
+		jitter: rand.Float64,
+	}
+}
+
+// Allow returns an error when the host should not be called right now.
+func (g *Guard) Allow(host string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := g.now()
+	if g.openUntil.After(now) {
+		return fmt.Errorf("%w until %s", ErrCircuitOpen, g.openUntil.Format(time.RFC3339))
+	}
+	if state, ok := g.hosts[host]; ok && state.until.After(now) {
+		return fmt.Errorf("%w: %s until %s", ErrBackoff, host, state.until.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// Record updates the back-off of the host with the result of a call.
+func (g *Guard) Record(host string, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	state, ok := g.hosts[host]
+	if !ok {
+		state = &hostState{}
+		g.hosts[host] = state
+	}
+	if !isBlockErr(err) {
+		state.blocks = 0
+		return
+	}
+
+	now := g.now()
+	state.blocks++
+	backoff := g.config.BackoffBase << (state.blocks - 1)
+	if backoff <= 0 || backoff > g.config.BackoffMax {
+		backoff = g.config.BackoffMax
+	}
+	// jitter between 50% and 150% so workers do not come back all at once
+	backoff = time.Duration(float64(backoff) * (0.5 + g.jitter()))
+	state.until = now.Add(backoff)
+
+	// keep the blocks of the window only
+	recent := []time.Time{}
+	for _, at := range g.blocks {
+		if now.Sub(at) < g.config.BreakerWindow {
+			recent = append(recent, at)
+		}
+	}
+	g.blocks = append(recent, now)
+	if g.config.BreakerThreshold > 0 && len(g.blocks) >= g.config.BreakerThreshold {
+		g.openUntil = now.Add(g.config.BreakerPause)
+		g.blocks = nil
+		logs.LogWarning(logrus.Fields{
+			"host":  host,
+			"until": g.openUntil,
+		}, "crawl circuit breaker opened")
+	}
+}
+
+var (
+	defaultGuard     *Guard
+	defaultGuardOnce sync.Once
+)
+
+// DefaultGuard is the guard shared by the sources made from the env.
+func DefaultGuard() *Guard {
+	defaultGuardOnce.Do(func() {
+		defaultGuard = NewGuard(GuardConfigFromEnv())
+	})
+	return defaultGuard
+}
+
+// GuardedSource checks the guard before calling the source and tells it
+// how the call went.
+type GuardedSource struct {
+	source ProductSource
+	guard  *Guard
+	host   string
+}
+
+func NewGuardedSource(source ProductSource, guard *Guard) *GuardedSource {
+	return &GuardedSource{source, guard, shopeeHost}
+}
+
+func (s *GuardedSource) FetchShopProducts(ctx context.Context, shopID string) ([]database.Product, error) {
+	if err := s.guard.Allow(s.host); err != nil {
+		return nil, err
+	}
+	products, err := s.source.FetchShopProducts(ctx, shopID)
+	s.guard.Record(s.host, err)
+	return products, err
+}
+
+func (s *GuardedSource) FetchProduct(ctx context.Context, shopID string, itemID string) (database.Product, error) {
+	if err := s.guard.Allow(s.host); err != nil {
+		return database.Product{}, err
+	}
+	product, err := s.source.FetchProduct(ctx, shopID, itemID)
+	s.guard.Record(s.host, err)
+	return product, err
+}
@@ -0,0 +1,48 @@
+package crawl
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGuardBackoffAndBreaker(t *testing.T) {
+	now := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	guard := NewGuard(GuardConfig{
+		BackoffBase:      time.Second,
+		BackoffMax:       time.Minute,
+		BreakerThreshold: 3,
+		BreakerWindow:    time.Hour,
+		BreakerPause:     time.Hour,
+	})
+	guard.now = func() time.Time { return now }
+	guard.jitter = func() float64 { return 0.5 }
+
+	guard.Record(shopeeHost, ErrBlocked)
+	if err := guard.Allow(shopeeHost); !errors.Is(err, ErrBackoff) {
+		t.Fatalf("expected back-off, got %v", err)
+	}
+	if err := guard.Allow("other.host"); err != nil {
+		t.Fatalf("back-off is per host, got %v", err)
+	}
+
+	// the second block waits twice as long
+	now = now.Add(time.Second)
+	guard.Record(shopeeHost, ErrRateLimited)
+	now = now.Add(1500 * time.Millisecond)
+	if err := guard.Allow(shopeeHost); !errors.Is(err, ErrBackoff) {
+		t.Fatalf("expected back-off, got %v", err)
+	}
+	now = now.Add(time.Second)
+	if err := guard.Allow(shopeeHost); err != nil {
+		t.Fatalf("back-off should be over, got %v", err)
+	}
+
+	guard.Record(shopeeHost, ErrCaptcha)
+	if err := guard.Allow("other.host"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected the breaker to be open, got %v", err)
+	}
+	if !IsUnavailable(guard.Allow(shopeeHost)) {
+		t.Fatal("an open breaker means unavailable")
+	}
+}
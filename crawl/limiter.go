@@ -0,0 +1,143 @@
+package crawl
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/database"
+)
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter is a token bucket per host. It lets burst calls through at
+// once, then rate calls per second.
+type RateLimiter struct {
+	mu    sync.Mutex
+	rate  float64
+	burst int
+	hosts map[string]*bucket
+	now   func() time.Time
+}
+
+// NewRateLimiter limits every host to rate calls per second. A rate of 0
+// does not limit.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:  rate,
+		burst: burst,
+		hosts: map[string]*bucket{},
+		now:   time.Now,
+	}
+}
+
+// NewRateLimiterFromEnv reads CRAWL_RATE_LIMIT (calls per second per host,
+// 1 by default) and CRAWL_RATE_BURST (3 by default).
+func NewRateLimiterFromEnv() *RateLimiter {
+	rate, burst := 1.0, 3
+	if r, err := strconv.ParseFloat(os.Getenv("CRAWL_RATE_LIMIT"), 64); err == nil {
+		rate = r
+	}
+	if b, err := strconv.Atoi(os.Getenv("CRAWL_RATE_BURST")); err == nil {
+		burst = b
+	}
+	return NewRateLimiter(rate, burst)
+}
+
+// reserve takes a token of the host and returns how long to wait before
+// using it. Tokens go below zero so waiting callers keep their order.
+func (l *RateLimiter) reserve(host string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	b, ok := l.hosts[host]
+	if !ok {
+		b = &bucket{tokens: float64(l.burst), last: now}
+		l.hosts[host] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > float64(l.burst) {
+		b.tokens = float64(l.burst)
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / l.rate * float64(time.Second))
+}
+
+// release gives back a token that was not used.
+func (l *RateLimiter) release(host string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b, ok := l.hosts[host]; ok {
+		b.tokens++
+	}
+}
+
+// Wait blocks until the host can be called or ctx is done.
+func (l *RateLimiter) Wait(ctx context.Context, host string) error {
+	if l.rate <= 0 {
+		return nil
+	}
+	wait := l.reserve(host)
+	if wait == 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.release(host)
+		return ctx.Err()
+	}
+}
+
+var (
+	defaultRateLimiter     *RateLimiter
+	defaultRateLimiterOnce sync.Once
+)
+
+// DefaultRateLimiter is the limiter shared by the sources made from the env.
+func DefaultRateLimiter() *RateLimiter {
+	defaultRateLimiterOnce.Do(func() {
+		defaultRateLimiter = NewRateLimiterFromEnv()
+	})
+	return defaultRateLimiter
+}
+
+// RateLimitedSource waits for the limiter before calling the source.
+type RateLimitedSource struct {
+	source  ProductSource
+	limiter *RateLimiter
+	host    string
+}
+
+func NewRateLimitedSource(source ProductSource, limiter *RateLimiter) *RateLimitedSource {
+	return &RateLimitedSource{source, limiter, shopeeHost}
+}
+
+func (s *RateLimitedSource) FetchShopProducts(ctx context.Context, shopID string) ([]database.Product, error) {
+	if err := s.limiter.Wait(ctx, s.host); err != nil {
+		return nil, err
+	}
+	return s.source.FetchShopProducts(ctx, shopID)
+}
+
+func (s *RateLimitedSource) FetchProduct(ctx context.Context, shopID string, itemID string) (database.Product, error) {
+	if err := s.limiter.Wait(ctx, s.host); err != nil {
+		return database.Product{}, err
+	}
+	return s.source.FetchProduct(ctx, shopID, itemID)
+}
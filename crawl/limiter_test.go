@@ -0,0 +1,34 @@
+package crawl
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterBurstThenRate(t *testing.T) {
+	now := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(2, 2)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if wait := limiter.reserve(shopeeHost); wait != 0 {
+			t.Fatalf("call %d is in the burst, waited %s", i, wait)
+		}
+	}
+	if wait := limiter.reserve(shopeeHost); wait != 500*time.Millisecond {
+		t.Fatalf("expected to wait 500ms, got %s", wait)
+	}
+	// the next caller queues behind the previous one
+	if wait := limiter.reserve(shopeeHost); wait != time.Second {
+		t.Fatalf("expected to wait 1s, got %s", wait)
+	}
+	if wait := limiter.reserve("other.host"); wait != 0 {
+		t.Fatalf("the limit is per host, waited %s", wait)
+	}
+
+	now = now.Add(time.Second)
+	limiter.release(shopeeHost)
+	if wait := limiter.reserve(shopeeHost); wait != 0 {
+		t.Fatalf("tokens should be back, waited %s", wait)
+	}
+}
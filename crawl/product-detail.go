@@ -0,0 +1,303 @@
+package crawl
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/database"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/logs"
+	"github.com/chromedp/cdproto/dom"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+	fakeUseragent "github.com/eddycjy/fake-useragent"
+	"github.com/sirupsen/logrus"
+)
+
+// shopee prices are stored as VND x 100000
+const priceUnit = 100000
+
+var (
+	productUrlRegex  = regexp.MustCompile(`i\.(\d+)\.(\d+)`)
+	productPathRegex = regexp.MustCompile(`/product/(\d+)/(\d+)`)
+	numberRegex      = regexp.MustCompile(`\d+(?:[.,]\d+)*`)
+	// the suffix must end the word, "5 món" is 5 and not 5 million
+	countRegex         = regexp.MustCompile(`(?i)(\d+(?:[.,]\d+)*)\s*(k|tr|m)?(?:[^\p{L}\d]|$)`)
+	countdownPartRegex = regexp.MustCompile(`\d+`)
+)
+
+// ProductUrl builds the url of a product page.
+func ProductUrl(shopID string, itemID string) string {
+	return fmt.Sprintf("https://shopee.vn/product/%s/%s", shopID, itemID)
+}
+
+// ParseProductUrl returns the shop id and item id of a product url, both
+// https://shopee.vn/name-i.<shop>.<item> and https://shopee.vn/product/<shop>/<item>.
+func ParseProductUrl(url string) (string, string, error) {
+	match := productUrlRegex.FindStringSubmatch(url)
+	if match == nil {
+		match = productPathRegex.FindStringSubmatch(url)
+	}
+	if match == nil {
+		return "", "", fmt.Errorf("%w: %s", ErrInvalidProductUrl, url)
+	}
+	return match[1], match[2], nil
+}
+
+// ScrapeProductDetail scrapes a product page using the headless shell from the env.
+func ScrapeProductDetail(ctx context.Context, url string) (database.Product, error) {
+	return DefaultChromedpSource().ScrapeProductDetail(ctx, url)
+}
+
+// ScrapeProductDetail opens the product page and reads every field it can find.
+func (s *ChromedpSource) ScrapeProductDetail(ctx context.Context, url string) (database.Product, error) {
+	_, itemID, err := ParseProductUrl(url)
+	if err != nil {
+		return database.Product{}, err
+	}
+
+	html, err := s.ProductHtml(ctx, url)
+	if err != nil {
+		return database.Product{}, err
+	}
+
+	product, err := parseProductDetail(html, time.Now())
+	if err != nil {
+		logs.LogWarning(logrus.Fields{
+			"url":  url,
+			"data": err.Error(),
+		}, "ScrapeProductDetail parse html")
+		return database.Product{}, err
+	}
+
+	product.IDShopee, _ = strconv.ParseInt(itemID, 10, 64)
+
+	return product, nil
+}
+
+// ProductHtml returns the rendered html of a product page.
+func (s *ChromedpSource) ProductHtml(ctx context.Context, url string) (string, error) {
+	html, err := rotate(s.proxies, func(proxy string) ([]byte, error) {
+		html, err := s.productHtml(ctx, url, proxy)
+		return []byte(html), err
+	}, func(body []byte) bool {
+		return false
+	})
+	return string(html), err
+}
+
+func (s *ChromedpSource) productHtml(ctx context.Context, url string, proxy string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 120*time.Second)
+	defer cancel()
+
+	ctx, cancel, err := s.tabs.Tab(ctx, proxy, fakeUseragent.Random())
+	if err != nil {
+		return "", err
+	}
+	defer cancel()
+
+	if err := chromedp.Run(ctx,
+		network.ClearBrowserCookies(),
+	); err != nil {
+		logs.LogWarning(logrus.Fields{
+			"url":  url,
+			"data": err.Error(),
+		}, "ScrapeProductDetail clear cookies")
+		return "", err
+	}
+
+	// navigate to a page, retrieve the page source
+	var html, location string
+	task := chromedp.Tasks{
+		chromedp.Navigate("https://shopee.vn/mall"),
+		chromedp.Navigate(url),
+		chromedp.Location(&location),
+		chromedp.ActionFunc(func(ctx context.Context) error {
+			return pageError(location)
+		}),
+		chromedp.WaitReady("#main", chromedp.ByID),
+		chromedp.ActionFunc(func(ctx context.Context) error {
+			node, err := dom.GetDocument().Do(ctx)
+			if err != nil {
+				return err
+			}
+			html, err = dom.GetOuterHTML().WithNodeID(node.NodeID).Do(ctx)
+			return err
+		}),
+	}
+
+	err = chromedp.Run(ctx, task)
+	if err != nil {
+		logs.LogWarning(logrus.Fields{
+			"url":   url,
+			"proxy": proxy,
+			"data":  err.Error(),
+		}, "ScrapeProductDetail run chromedp")
+		return "", err
+	}
+
+	return html, nil
+}
+
+// pageError tells from the url we landed on whether shopee sent us away.
+func pageError(location string) error {
+	switch {
+	case strings.Contains(location, "/verify/captcha"), strings.Contains(location, "/verify/traffic"):
+		return fmt.Errorf("%w: %s", ErrCaptcha, location)
+	case strings.Contains(location, "/buyer/login"):
+		return fmt.Errorf("%w: %s", ErrBlocked, location)
+	}
+	return nil
+}
+
+// parseProductDetail reads a product page with the current selectors. now is
+// used to turn the flash sale countdown into an end time.
+func parseProductDetail(html string, now time.Time) (database.Product, error) {
+	return parseProductDetailWith(Selectors(), html, now)
+}
+
+func parseProductDetailWith(config SelectorConfig, html string, now time.Time) (database.Product, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		return database.Product{}, err
+	}
+
+	if config.scope(doc, "product").Length() == 0 {
+		return database.Product{}, ErrProductNotFound
+	}
+
+	product := database.Product{}
+
+	// get name of product
+	name, ok := config.value(doc, "name")
+	if !ok {
+		return database.Product{}, fmt.Errorf("%w: name", ErrMissingField)
+	}
+	product.Name = name
+
+	// get price of product, can be a range
+	price, _ := config.value(doc, "price")
+	priceMin, priceMax, ok := parsePriceRange(price)
+	if !ok {
+		return database.Product{}, fmt.Errorf("%w: price", ErrMissingField)
+	}
+	product.Price = priceMin
+	product.PriceMin = priceMin
+	product.PriceMax = priceMax
+
+	// get old price of product
+	oldPrice, _ := config.value(doc, "old_price")
+	oldMin, oldMax, ok := parsePriceRange(oldPrice)
+	if ok {
+		product.PriceBeforeDiscount = oldMin
+		product.PriceMinBeforeDiscount = oldMin
+		product.PriceMaxBeforeDiscount = oldMax
+	}
+
+	// get discount of product
+	discount, _ := config.value(doc, "discount")
+	rawDiscount, _ := parseCount(discount)
+	product.RawDiscount = float32(rawDiscount)
+
+	// get sold of product
+	soldText, _ := config.value(doc, "sold")
+	sold, _ := parseCount(soldText)
+	product.Sold = int32(sold)
+
+	// the page only shows the recent sales, the total is left unset unless
+	// the selectors know where to find it
+	if historicalText, ok := config.value(doc, "historical_sold"); ok {
+		historicalSold, _ := parseCount(historicalText)
+		product.HistoricalSold = int32(historicalSold)
+	}
+
+	// get stock of product
+	stockText, _ := config.value(doc, "stock")
+	stock, _ := parseCount(stockText)
+	product.Stock = int32(stock)
+
+	// get rating of product
+	rating, _ := config.value(doc, "rating")
+	product.Rating, _ = strconv.ParseFloat(rating, 64)
+
+	// get like of product
+	likeText, _ := config.value(doc, "likes")
+	like, _ := parseCount(likeText)
+	product.LikedCount = int32(like)
+
+	// shop info
+	product.ShopName, _ = config.value(doc, "shop_name")
+	product.ShopImage, _ = config.value(doc, "shop_image")
+
+	// get flash sale
+	flashSale, _ := config.value(doc, "flash_sale")
+	if remaining, ok := parseCountdown(flashSale); ok {
+		product.FlashSaleEndsAt = now.Add(remaining)
+	}
+
+	return product, nil
+}
+
+// parsePriceRange reads "₫129.000" or "₫129.000 - ₫159.000" into shopee units.
+func parsePriceRange(text string) (int64, int64, bool) {
+	numbers := numberRegex.FindAllString(text, -1)
+	if len(numbers) == 0 {
+		return 0, 0, false
+	}
+	prices := []int64{}
+	for _, number := range numbers {
+		value, err := strconv.ParseInt(strings.NewReplacer(".", "", ",", "").Replace(number), 10, 64)
+		if err != nil {
+			return 0, 0, false
+		}
+		prices = append(prices, value*priceUnit)
+	}
+	return prices[0], prices[len(prices)-1], true
+}
+
+// parseCount reads numbers like "1,2k Đã Bán", "3.4tr" or "123 sản phẩm có sẵn".
+func parseCount(text string) (int64, bool) {
+	match := countRegex.FindStringSubmatch(text)
+	if match == nil {
+		return 0, false
+	}
+	number := match[1]
+	multiplier := 1.0
+	switch strings.ToLower(match[2]) {
+	case "k":
+		multiplier = 1000
+	case "tr", "m":
+		multiplier = 1000000
+	}
+	if multiplier == 1 {
+		// without a suffix the separators are thousand separators
+		number = strings.NewReplacer(".", "", ",", "").Replace(number)
+	} else {
+		number = strings.ReplaceAll(number, ",", ".")
+	}
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, false
+	}
+	return int64(value * multiplier), true
+}
+
+// parseCountdown reads the "hh mm ss" parts of the flash sale timer.
+func parseCountdown(text string) (time.Duration, bool) {
+	parts := countdownPartRegex.FindAllString(text, -1)
+	if len(parts) < 3 {
+		return 0, false
+	}
+	parts = parts[len(parts)-3:]
+	units := []time.Duration{time.Hour, time.Minute, time.Second}
+	var remaining time.Duration
+	for i, part := range parts {
+		value, _ := strconv.Atoi(part)
+		remaining += time.Duration(value) * units[i]
+	}
+	return remaining, remaining > 0
+}
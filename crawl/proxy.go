@@ -0,0 +1,279 @@
+package crawl
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/database"
+)
+
+const defaultProxyCooldown = 10 * time.Minute
+
+type proxyState struct {
+	url           string
+	score         float64
+	requests      int64
+	blocks        int64
+	failures      int64
+	cooldownUntil time.Time
+}
+
+// ProxyStats is what the pool knows about one proxy.
+type ProxyStats struct {
+	Url         string    `json:"url"`
+	Score       float64   `json:"score"`
+	Requests    int64     `json:"requests"`
+	Blocks      int64     `json:"blocks"`
+	Failures    int64     `json:"failures"`
+	BlockRate   float64   `json:"block_rate"`
+	CoolingDown bool      `json:"cooling_down"`
+	Until       time.Time `json:"until,omitempty"`
+}
+
+// ProxyPool hands out the healthiest proxy that is not cooling down. Every
+// proxy starts with a score of 1, successes pull it up and blocks or network
+// failures pull it down. A blocked proxy is not used for the cool-down time.
+type ProxyPool struct {
+	mu       sync.Mutex
+	proxies  []*proxyState
+	cooldown time.Duration
+	now      func() time.Time
+}
+
+func NewProxyPool(urls []string, cooldown time.Duration) *ProxyPool {
+	if cooldown <= 0 {
+		cooldown = defaultProxyCooldown
+	}
+	pool := &ProxyPool{cooldown: cooldown, now: time.Now}
+	for _, url := range urls {
+		url = strings.TrimSpace(url)
+		if url != "" {
+			pool.proxies = append(pool.proxies, &proxyState{url: url, score: 1})
+		}
+	}
+	return pool
+}
+
+// NewProxyPoolFromEnv reads a comma separated list from CRAWL_PROXIES and the
+// cool-down from CRAWL_PROXY_COOLDOWN (e.g. 15m).
+func NewProxyPoolFromEnv() *ProxyPool {
+	cooldown, _ := time.ParseDuration(os.Getenv("CRAWL_PROXY_COOLDOWN"))
+	return NewProxyPool(strings.Split(os.Getenv("CRAWL_PROXIES"), ","), cooldown)
+}
+
+var (
+	defaultProxyPool     *ProxyPool
+	defaultProxyPoolOnce sync.Once
+)
+
+// DefaultProxyPool is the pool shared by the sources made from the env.
+func DefaultProxyPool() *ProxyPool {
+	defaultProxyPoolOnce.Do(func() {
+		defaultProxyPool = NewProxyPoolFromEnv()
+	})
+	return defaultProxyPool
+}
+
+// Len returns the number of proxies, zero means crawling without proxy.
+func (p *ProxyPool) Len() int {
+	if p == nil {
+		return 0
+	}
+	return len(p.proxies)
+}
+
+// Next returns the proxy to use. ok is false when every proxy is cooling down.
+func (p *ProxyPool) Next() (string, bool) {
+	if p.Len() == 0 {
+		return "", false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	var best *proxyState
+	for _, proxy := range p.proxies {
+		if proxy.cooldownUntil.After(now) {
+			continue
+		}
+		// prefer the healthiest one, then the least used one
+		if best == nil || proxy.score > best.score || (proxy.score == best.score && proxy.requests < best.requests) {
+			best = proxy
+		}
+	}
+	if best == nil {
+		return "", false
+	}
+	best.requests++
+	return best.url, true
+}
+
+func (p *ProxyPool) ReportSuccess(url string) {
+	p.update(url, func(proxy *proxyState) {
+		proxy.score = proxy.score*0.8 + 0.2
+	})
+}
+
+// ReportBlocked lowers the score of the proxy and puts it in cool-down.
+func (p *ProxyPool) ReportBlocked(url string) {
+	p.update(url, func(proxy *proxyState) {
+		proxy.blocks++
+		proxy.score = proxy.score * 0.5
+		proxy.cooldownUntil = p.now().Add(p.cooldown)
+	})
+}
+
+// ReportFailure is for network errors, the proxy only cools down when its
+// score gets too low.
+func (p *ProxyPool) ReportFailure(url string) {
+	p.update(url, func(proxy *proxyState) {
+		proxy.failures++
+		proxy.score = proxy.score * 0.8
+		if proxy.score < 0.2 {
+			proxy.cooldownUntil = p.now().Add(p.cooldown)
+		}
+	})
+}
+
+func (p *ProxyPool) update(url string, change func(proxy *proxyState)) {
+	if p.Len() == 0 || url == "" {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, proxy := range p.proxies {
+		if proxy.url == url {
+			change(proxy)
+			return
+		}
+	}
+}
+
+// Stats returns the metrics of every proxy, most blocked first.
+func (p *ProxyPool) Stats() []ProxyStats {
+	stats := []ProxyStats{}
+	if p.Len() == 0 {
+		return stats
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	for _, proxy := range p.proxies {
+		stat := ProxyStats{
+			Url:         proxy.url,
+			Score:       proxy.score,
+			Requests:    proxy.requests,
+			Blocks:      proxy.blocks,
+			Failures:    proxy.failures,
+			CoolingDown: proxy.cooldownUntil.After(now),
+		}
+		if stat.CoolingDown {
+			stat.Until = proxy.cooldownUntil
+		}
+		stats = append(stats, stat)
+	}
+	return sortByBlockRate(stats)
+}
+
+// Publish saves the stats of the pool as the ones of the worker. The pool
+// lives in the worker, the API reads what the workers published.
+func (p *ProxyPool) Publish(ctx context.Context, service *database.ProxyStatService, worker string) error {
+	published := []database.ProxyStat{}
+	for _, stat := range p.Stats() {
+		published = append(published, database.ProxyStat{
+			Worker:        worker,
+			Url:           stat.Url,
+			Score:         stat.Score,
+			Requests:      stat.Requests,
+			Blocks:        stat.Blocks,
+			Failures:      stat.Failures,
+			CooldownUntil: stat.Until,
+		})
+	}
+	return service.Save(ctx, published)
+}
+
+// MergeProxyStats adds up the stats the workers published for each proxy.
+// The score is the mean of the workers, and a proxy cools down until the
+// last worker that blocked on it is done waiting.
+func MergeProxyStats(published []database.ProxyStat, now time.Time) []ProxyStats {
+	stats := []ProxyStats{}
+	index := map[string]int{}
+	workers := []int{}
+	for _, worker := range published {
+		i, ok := index[worker.Url]
+		if !ok {
+			i = len(stats)
+			index[worker.Url] = i
+			stats = append(stats, ProxyStats{Url: worker.Url})
+			workers = append(workers, 0)
+		}
+		stat := &stats[i]
+		workers[i]++
+		stat.Score += (worker.Score - stat.Score) / float64(workers[i])
+		stat.Requests += worker.Requests
+		stat.Blocks += worker.Blocks
+		stat.Failures += worker.Failures
+		if worker.CooldownUntil.After(now) && worker.CooldownUntil.After(stat.Until) {
+			stat.CoolingDown = true
+			stat.Until = worker.CooldownUntil
+		}
+	}
+	return sortByBlockRate(stats)
+}
+
+// sortByBlockRate sets the block rates and puts the most blocked first.
+func sortByBlockRate(stats []ProxyStats) []ProxyStats {
+	for i := range stats {
+		if stats[i].Requests > 0 {
+			stats[i].BlockRate = float64(stats[i].Blocks) / float64(stats[i].Requests)
+		}
+	}
+	sort.SliceStable(stats, func(i, j int) bool {
+		return stats[i].BlockRate > stats[j].BlockRate
+	})
+	return stats
+}
+
+// rotate runs fetch through the proxies of the pool until one is neither
+// failing nor blocked. Without proxies fetch is run once with an empty proxy.
+// When every try is blocked the last body is returned so the caller can
+// still read what the source said.
+func rotate(pool *ProxyPool, fetch func(proxy string) ([]byte, error), blocked func(body []byte) bool) ([]byte, error) {
+	if pool.Len() == 0 {
+		return fetch("")
+	}
+	var lastBody []byte
+	lastErr := ErrNoProxy
+	for i := 0; i < pool.Len(); i++ {
+		proxy, ok := pool.Next()
+		if !ok {
+			break
+		}
+		body, err := fetch(proxy)
+		if isBlockErr(err) {
+			pool.ReportBlocked(proxy)
+			lastErr = err
+			continue
+		}
+		if err != nil {
+			pool.ReportFailure(proxy)
+			lastErr = err
+			continue
+		}
+		if blocked(body) {
+			pool.ReportBlocked(proxy)
+			lastBody = body
+			continue
+		}
+		pool.ReportSuccess(proxy)
+		return body, nil
+	}
+	if lastBody != nil {
+		return lastBody, nil
+	}
+	return nil, lastErr
+}
@@ -0,0 +1,124 @@
+package crawl
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/database"
+)
+
+// newFakeProxy forwards requests and tells the upstream which proxy it went through.
+func newFakeProxy(name string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := r.Clone(r.Context())
+		req.RequestURI = ""
+		req.Header.Set("X-Fake-Proxy", name)
+		res, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer res.Body.Close()
+		w.WriteHeader(res.StatusCode)
+		io.Copy(w, res.Body)
+	}))
+}
+
+func TestHTTPSourceRotatesBlockedProxy(t *testing.T) {
+	body, err := os.ReadFile(filepath.Join("testdata", "recommend", "88001.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// fake shopee blocks everything coming through proxy "blocked"
+	shopee := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Fake-Proxy") == "blocked" {
+			w.Write([]byte(`{"error": 90309999, "data": null}`))
+			return
+		}
+		w.Write(body)
+	}))
+	defer shopee.Close()
+	blocked := newFakeProxy("blocked")
+	defer blocked.Close()
+	healthy := newFakeProxy("healthy")
+	defer healthy.Close()
+
+	pool := NewProxyPool([]string{blocked.URL, healthy.URL}, time.Minute)
+	source := NewHTTPSource(nil, pool)
+	source.baseUrl = shopee.URL
+
+	for i := 0; i < 3; i++ {
+		products, err := source.FetchShopProducts(context.Background(), "88001")
+		if err != nil && !IsPartial(err) {
+			t.Fatal(err)
+		}
+		if len(products) != 2 {
+			t.Fatalf("expected 2 products, got %d", len(products))
+		}
+	}
+
+	stats := map[string]ProxyStats{}
+	for _, stat := range pool.Stats() {
+		stats[stat.Url] = stat
+	}
+	if stat := stats[blocked.URL]; stat.Blocks != 1 || stat.Requests != 1 || !stat.CoolingDown {
+		t.Fatalf("blocked proxy should be used once then cool down, got %+v", stat)
+	}
+	if stat := stats[healthy.URL]; stat.Blocks != 0 || stat.Requests != 3 {
+		t.Fatalf("healthy proxy should take every request, got %+v", stat)
+	}
+}
+
+func TestProxyPoolCooldown(t *testing.T) {
+	now := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	pool := NewProxyPool([]string{"http://a", "http://b"}, time.Minute)
+	pool.now = func() time.Time { return now }
+
+	pool.ReportBlocked("http://a")
+	pool.ReportBlocked("http://b")
+	if _, ok := pool.Next(); ok {
+		t.Fatal("every proxy is cooling down")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, ok := pool.Next(); !ok {
+		t.Fatal("proxies should be back after the cool-down")
+	}
+}
+
+func TestPublishedProxyStats(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	service := database.NewProxyStatService(database.NewMemoryProxyStatRepository())
+	for _, worker := range []string{"worker-1", "worker-2"} {
+		pool := NewProxyPool([]string{"http://a", "http://b"}, time.Minute)
+		pool.now = func() time.Time { return now }
+		pool.Next()
+		pool.Next()
+		if worker == "worker-2" {
+			pool.ReportBlocked("http://a")
+		}
+		if err := pool.Publish(ctx, service, worker); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	published, _ := service.FindFresh(ctx)
+	stats := MergeProxyStats(published, now)
+	if len(stats) != 2 {
+		t.Fatalf("got %d proxies, want 2", len(stats))
+	}
+	a := stats[0]
+	if a.Url != "http://a" || a.Requests != 2 || a.Blocks != 1 || a.BlockRate != 0.5 || a.Score != 0.75 || !a.CoolingDown {
+		t.Errorf("merged stats of a = %+v", a)
+	}
+	if b := stats[1]; b.Requests != 2 || b.Score != 1 || b.CoolingDown {
+		t.Errorf("merged stats of b = %+v", b)
+	}
+}
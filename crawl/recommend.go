@@ -0,0 +1,128 @@
+package crawl
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/database"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/utils"
+)
+
+// recommendResponse is the body of recommend?bundle=shop_page_product_tab_main.
+// Items are kept raw so that one bad item does not fail the whole payload.
+type recommendResponse struct {
+	Error    *int    `json:"error"`
+	ErrorMsg *string `json:"error_msg"`
+	Data     *struct {
+		Sections []struct {
+			Data struct {
+				Item []json.RawMessage `json:"item"`
+			} `json:"data"`
+		} `json:"sections"`
+	} `json:"data"`
+}
+
+type recommendItem struct {
+	ItemID                 *int64  `json:"itemid"`
+	ShopID                 int64   `json:"shopid"`
+	Name                   *string `json:"name"`
+	ShopName               string  `json:"shop_name"`
+	ShopRating             float64 `json:"shop_rating"`
+	Stock                  int32   `json:"stock"`
+	Sold                   int32   `json:"sold"`
+	HistoricalSold         int32   `json:"historical_sold"`
+	LikedCount             int32   `json:"liked_count"`
+	CmtCount               int32   `json:"cmt_count"`
+	Price                  *int64  `json:"price"`
+	PriceMin               int64   `json:"price_min"`
+	PriceMax               int64   `json:"price_max"`
+	PriceMinBeforeDiscount int64   `json:"price_min_before_discount"`
+	PriceMaxBeforeDiscount int64   `json:"price_max_before_discount"`
+	PriceBeforeDiscount    int64   `json:"price_before_discount"`
+	RawDiscount            float32 `json:"raw_discount"`
+	ItemRating             struct {
+		RatingStar float64 `json:"rating_star"`
+	} `json:"item_rating"`
+	Images []string `json:"images"`
+}
+
+// decodeRecommendItem decodes and checks the fields we can not do without.
+func decodeRecommendItem(raw json.RawMessage) (recommendItem, error) {
+	var item recommendItem
+	if err := json.Unmarshal(raw, &item); err != nil {
+		return item, err
+	}
+	if item.ItemID == nil {
+		return item, fmt.Errorf("missing itemid")
+	}
+	if item.Name == nil {
+		return item, fmt.Errorf("missing name")
+	}
+	if item.Price == nil {
+		return item, fmt.Errorf("missing price")
+	}
+	return item, nil
+}
+
+func (item recommendItem) toProduct() database.Product {
+	images := []string{}
+	for _, id := range item.Images {
+		if id != "" {
+			images = append(images, utils.CreateUrlFromIdImage(id))
+		}
+	}
+	return database.Product{
+		IDShopee:               *item.ItemID,
+		ShopName:               item.ShopName,
+		ShopRating:             item.ShopRating,
+		Name:                   *item.Name,
+		Stock:                  item.Stock,
+		Sold:                   item.Sold,
+		HistoricalSold:         item.HistoricalSold,
+		LikedCount:             item.LikedCount,
+		CmtCount:               item.CmtCount,
+		Price:                  *item.Price,
+		PriceMin:               item.PriceMin,
+		PriceMax:               item.PriceMax,
+		PriceMinBeforeDiscount: item.PriceMinBeforeDiscount,
+		PriceMaxBeforeDiscount: item.PriceMaxBeforeDiscount,
+		PriceBeforeDiscount:    item.PriceBeforeDiscount,
+		RawDiscount:            item.RawDiscount,
+		Rating:                 item.ItemRating.RatingStar,
+		Images:                 images,
+	}
+}
+
+// itemIDOf reads only the item id, used to tell which item was skipped.
+func itemIDOf(raw json.RawMessage) int64 {
+	var item struct {
+		ItemID int64 `json:"itemid"`
+	}
+	json.Unmarshal(raw, &item)
+	return item.ItemID
+}
+
+// shopee answers with these codes when it wants a captcha solved
+var captchaErrorCodes = map[int]bool{
+	90309999: true,
+	90309998: true,
+}
+
+// recommendError turns the error code of the recommend API into a typed error.
+func recommendError(code int) error {
+	if captchaErrorCodes[code] {
+		return fmt.Errorf("%w: error %d", ErrCaptcha, code)
+	}
+	return fmt.Errorf("%w: error %d", ErrBlocked, code)
+}
+
+// recommendBlocked reports whether the recommend API refused to answer.
+func recommendBlocked(body []byte) bool {
+	var result struct {
+		Error *int `json:"error"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return false
+	}
+	return result.Error != nil && *result.Error != 0
+}
@@ -0,0 +1,243 @@
+package crawl
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/logs"
+	"github.com/sirupsen/logrus"
+)
+
+//go:embed selectors.json
+var defaultSelectorsFile []byte
+
+// Selector is one way to read a field. Attr reads an attribute instead of
+// the text, Last takes the last match instead of the first one.
+type Selector struct {
+	Query string `json:"query"`
+	Attr  string `json:"attr,omitempty"`
+	Last  bool   `json:"last,omitempty"`
+}
+
+// FieldSelectors is a chain of selectors tried in order until one gives a value.
+type FieldSelectors struct {
+	Scope    string     `json:"scope,omitempty"`
+	Required bool       `json:"required,omitempty"`
+	Chain    []Selector `json:"chain"`
+}
+
+// SelectorConfig holds the selectors of the product page. Scopes are fallback
+// chains too, a field with an empty scope is looked up in the whole page.
+type SelectorConfig struct {
+	Scopes map[string][]string       `json:"scopes"`
+	Fields map[string]FieldSelectors `json:"fields"`
+}
+
+// SelectorError lists the fields no selector could read.
+type SelectorError struct {
+	Fields []string
+}
+
+func (e *SelectorError) Error() string {
+	return "selectors do not match fields: " + strings.Join(e.Fields, ", ")
+}
+
+var (
+	selectors   SelectorConfig
+	selectorsMu sync.RWMutex
+)
+
+func init() {
+	config, err := ParseSelectors(defaultSelectorsFile)
+	if err != nil {
+		panic(err)
+	}
+	selectors = config
+}
+
+// Selectors returns the selectors used by the product page parser.
+func Selectors() SelectorConfig {
+	selectorsMu.RLock()
+	defer selectorsMu.RUnlock()
+	return selectors
+}
+
+// SetSelectors replaces the selectors used by the product page parser.
+func SetSelectors(config SelectorConfig) {
+	selectorsMu.Lock()
+	defer selectorsMu.Unlock()
+	selectors = config
+}
+
+// ParseSelectors reads a selector file and checks the required fields are there.
+func ParseSelectors(data []byte) (SelectorConfig, error) {
+	var config SelectorConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return SelectorConfig{}, err
+	}
+	for _, field := range []string{"name", "price"} {
+		if len(config.Fields[field].Chain) == 0 {
+			return SelectorConfig{}, fmt.Errorf("selectors: field %s has no selector", field)
+		}
+	}
+	if len(config.Scopes["product"]) == 0 {
+		return SelectorConfig{}, fmt.Errorf("selectors: scope product has no selector")
+	}
+	for name, field := range config.Fields {
+		if _, ok := config.Scopes[field.Scope]; field.Scope != "" && !ok {
+			return SelectorConfig{}, fmt.Errorf("selectors: field %s uses unknown scope %s", name, field.Scope)
+		}
+	}
+	return config, nil
+}
+
+// LoadSelectors reads a selector file from disk.
+func LoadSelectors(path string) (SelectorConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return SelectorConfig{}, err
+	}
+	return ParseSelectors(data)
+}
+
+// ValidateSelectors checks that every required field can be read from a
+// product page, usually a fixture from testdata/product.
+func ValidateSelectors(config SelectorConfig, html string) error {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		return err
+	}
+	if config.scope(doc, "product").Length() == 0 {
+		return &SelectorError{Fields: []string{"scope product"}}
+	}
+	missing := []string{}
+	for name, field := range config.Fields {
+		if _, ok := config.value(doc, name); field.Required && !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return &SelectorError{Fields: missing}
+	}
+	return nil
+}
+
+// SetupSelectors loads the selector file from CRAWL_SELECTORS_FILE, checks it
+// against the page in CRAWL_SELECTORS_FIXTURE and reloads it when it changes.
+// Without a file the embedded selectors are kept.
+func SetupSelectors(ctx context.Context) error {
+	path := os.Getenv("CRAWL_SELECTORS_FILE")
+	fixture := os.Getenv("CRAWL_SELECTORS_FIXTURE")
+	config := Selectors()
+	if path != "" {
+		loaded, err := LoadSelectors(path)
+		if err != nil {
+			return err
+		}
+		config = loaded
+	}
+	if fixture != "" {
+		html, err := os.ReadFile(fixture)
+		if err != nil {
+			return err
+		}
+		if err := ValidateSelectors(config, string(html)); err != nil {
+			return err
+		}
+	}
+	SetSelectors(config)
+	if path != "" {
+		go WatchSelectors(ctx, path, fixture, 30*time.Second)
+	}
+	return nil
+}
+
+// WatchSelectors reloads the selector file when its modification time changes.
+// A file that does not parse or does not pass the fixture is ignored and the
+// current selectors are kept.
+func WatchSelectors(ctx context.Context, path string, fixture string, interval time.Duration) {
+	var lastMod time.Time
+	if info, err := os.Stat(path); err == nil {
+		lastMod = info.ModTime()
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		info, err := os.Stat(path)
+		if err != nil || !info.ModTime().After(lastMod) {
+			continue
+		}
+		lastMod = info.ModTime()
+		config, err := LoadSelectors(path)
+		if err == nil && fixture != "" {
+			var html []byte
+			html, err = os.ReadFile(fixture)
+			if err == nil {
+				err = ValidateSelectors(config, string(html))
+			}
+		}
+		if err != nil {
+			logs.LogWarning(logrus.Fields{
+				"path": path,
+				"data": err.Error(),
+			}, "WatchSelectors reload")
+			continue
+		}
+		SetSelectors(config)
+		logs.LogInfo(logrus.Fields{
+			"path": path,
+		}, "WatchSelectors reloaded")
+	}
+}
+
+func (c SelectorConfig) scope(doc *goquery.Document, name string) *goquery.Selection {
+	if name == "" {
+		return doc.Selection
+	}
+	for _, query := range c.Scopes[name] {
+		selection := doc.Find(query).First()
+		if selection.Length() > 0 {
+			return selection
+		}
+	}
+	return doc.Selection.Slice(0, 0)
+}
+
+// value reads a field with the first selector of its chain that gives something.
+func (c SelectorConfig) value(doc *goquery.Document, name string) (string, bool) {
+	field, ok := c.Fields[name]
+	if !ok {
+		return "", false
+	}
+	root := c.scope(doc, field.Scope)
+	for _, selector := range field.Chain {
+		nodes := root.Find(selector.Query)
+		if nodes.Length() == 0 {
+			continue
+		}
+		node := nodes.First()
+		if selector.Last {
+			node = nodes.Last()
+		}
+		value := strings.TrimSpace(node.Text())
+		if selector.Attr != "" {
+			value, _ = node.Attr(selector.Attr)
+		}
+		if value != "" {
+			return value, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,102 @@
+package crawl
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/database"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/logs"
+	"github.com/chromedp/chromedp"
+	fakeUseragent "github.com/eddycjy/fake-useragent"
+	"github.com/sirupsen/logrus"
+)
+
+const defaultHeadlessShellUrl = "http://headless-shell:9222"
+
+// ChromedpSource loads the recommend API through a remote headless browser.
+type ChromedpSource struct {
+	tabs    *TabPool
+	proxies *ProxyPool
+}
+
+// NewChromedpSource opens at most CRAWL_TABS tabs at the same time on the
+// headless shell.
+func NewChromedpSource(allocatorUrl string, proxies *ProxyPool) *ChromedpSource {
+	return &ChromedpSource{NewTabPool(allocatorUrl, TabPoolSizeFromEnv()), proxies}
+}
+
+var (
+	defaultChromedpSource     *ChromedpSource
+	defaultChromedpSourceOnce sync.Once
+)
+
+// DefaultChromedpSource is the chromedp source made from the env, its tabs
+// are shared by every crawl of the process.
+func DefaultChromedpSource() *ChromedpSource {
+	defaultChromedpSourceOnce.Do(func() {
+		defaultChromedpSource = NewChromedpSource(os.Getenv("HEADLESS_SHELL_URL"), DefaultProxyPool())
+	})
+	return defaultChromedpSource
+}
+
+func (s *ChromedpSource) FetchShopProducts(ctx context.Context, shopID string) ([]database.Product, error) {
+	body, err := s.RecommendBody(ctx, shopID)
+	if err != nil {
+		return nil, err
+	}
+	return parseRecommendBody(shopID, body)
+}
+
+// RecommendBody returns the raw body of the recommend API for a shop.
+func (s *ChromedpSource) RecommendBody(ctx context.Context, shopID string) ([]byte, error) {
+	return rotate(s.proxies, func(proxy string) ([]byte, error) {
+		return s.recommendBody(ctx, shopID, proxy)
+	}, recommendBlocked)
+}
+
+func (s *ChromedpSource) recommendBody(ctx context.Context, shopID string, proxy string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	ctx, cancel, err := s.tabs.Tab(ctx, proxy, fakeUseragent.Random())
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
+	// navigate to a page, retrieve the page source
+	var html string
+	err = chromedp.Run(ctx,
+		chromedp.Navigate(recommendUrl(shopeeBaseUrl, shopID)),
+		chromedp.OuterHTML("html", &html),
+	)
+	if err != nil {
+		logs.LogWarning(logrus.Fields{
+			"shopID": shopID,
+			"proxy":  proxy,
+			"data":   err.Error(),
+		}, "GetProductsByShopID run chromedp")
+		return nil, err
+	}
+
+	// parse the page HTML with goquery
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		logs.LogWarning(logrus.Fields{
+			"shopID": shopID,
+			"data":   err.Error(),
+		}, "GetProductsByShopID parse html")
+		return nil, err
+	}
+
+	// the browser shows the JSON body inside a <pre>
+	return []byte(doc.Find("pre").First().Text()), nil
+}
+
+func (s *ChromedpSource) FetchProduct(ctx context.Context, shopID string, itemID string) (database.Product, error) {
+	return s.ScrapeProductDetail(ctx, ProductUrl(shopID, itemID))
+}
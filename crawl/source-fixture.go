@@ -0,0 +1,42 @@
+package crawl
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/database"
+)
+
+const defaultFixtureDir = "crawl/testdata"
+
+// FixtureSource reads recommend API bodies saved on disk as
+// <dir>/recommend/<shopID>.json, so the tracker can run offline.
+type FixtureSource struct {
+	dir string
+}
+
+func NewFixtureSource(dir string) *FixtureSource {
+	if dir == "" {
+		dir = defaultFixtureDir
+	}
+	return &FixtureSource{dir}
+}
+
+func (s *FixtureSource) FetchShopProducts(ctx context.Context, shopID string) ([]database.Product, error) {
+	// a missing fixture is an error, not a shop without products
+	body, err := os.ReadFile(filepath.Join(s.dir, "recommend", shopID+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("fixture of shop %s: %w", shopID, err)
+	}
+	return parseRecommendBody(shopID, body)
+}
+
+func (s *FixtureSource) FetchProduct(ctx context.Context, shopID string, itemID string) (database.Product, error) {
+	products, err := s.FetchShopProducts(ctx, shopID)
+	if err != nil && !IsPartial(err) {
+		return database.Product{}, err
+	}
+	return findProduct(products, itemID)
+}
@@ -0,0 +1,116 @@
+package crawl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/database"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/logs"
+	fakeUseragent "github.com/eddycjy/fake-useragent"
+	"github.com/sirupsen/logrus"
+)
+
+// HTTPSource calls the recommend API with a plain http client, no browser needed.
+type HTTPSource struct {
+	client  *http.Client
+	proxies *ProxyPool
+	baseUrl string
+	clients map[string]*http.Client
+	mu      sync.Mutex
+}
+
+func NewHTTPSource(client *http.Client, proxies *ProxyPool) *HTTPSource {
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &HTTPSource{
+		client:  client,
+		proxies: proxies,
+		baseUrl: shopeeBaseUrl,
+		clients: map[string]*http.Client{},
+	}
+}
+
+func (s *HTTPSource) FetchShopProducts(ctx context.Context, shopID string) ([]database.Product, error) {
+	body, err := rotate(s.proxies, func(proxy string) ([]byte, error) {
+		return s.recommendBody(ctx, shopID, proxy)
+	}, recommendBlocked)
+	if err != nil {
+		return nil, err
+	}
+	return parseRecommendBody(shopID, body)
+}
+
+func (s *HTTPSource) recommendBody(ctx context.Context, shopID string, proxy string) ([]byte, error) {
+	client, err := s.clientFor(proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, recommendUrl(s.baseUrl, shopID), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", fakeUseragent.Random())
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Referer", fmt.Sprintf("%s/shop/%s", s.baseUrl, shopID))
+	req.Header.Set("X-Api-Source", "pc")
+
+	res, err := client.Do(req)
+	if err != nil {
+		logs.LogWarning(logrus.Fields{
+			"shopID": shopID,
+			"proxy":  proxy,
+			"data":   err.Error(),
+		}, "GetProductsByShopID http request")
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusTooManyRequests:
+		return nil, fmt.Errorf("%w: status %d", ErrRateLimited, res.StatusCode)
+	case http.StatusForbidden:
+		return nil, fmt.Errorf("%w: status %d", ErrBlocked, res.StatusCode)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("recommend api returned status %d", res.StatusCode)
+	}
+
+	return io.ReadAll(res.Body)
+}
+
+// clientFor returns a client that goes through the proxy, one per proxy so
+// connections are reused.
+func (s *HTTPSource) clientFor(proxy string) (*http.Client, error) {
+	if proxy == "" {
+		return s.client, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if client, ok := s.clients[proxy]; ok {
+		return client, nil
+	}
+	proxyUrl, err := url.Parse(proxy)
+	if err != nil {
+		return nil, err
+	}
+	client := *s.client
+	client.Transport = &http.Transport{Proxy: http.ProxyURL(proxyUrl)}
+	s.clients[proxy] = &client
+	return &client, nil
+}
+
+func (s *HTTPSource) FetchProduct(ctx context.Context, shopID string, itemID string) (database.Product, error) {
+	products, err := s.FetchShopProducts(ctx, shopID)
+	if err != nil && !IsPartial(err) {
+		return database.Product{}, err
+	}
+	return findProduct(products, itemID)
+}
@@ -0,0 +1,84 @@
+package crawl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/database"
+)
+
+const (
+	SourceChromedp = "chromedp"
+	SourceHTTP     = "http"
+	SourceFixture  = "fixture"
+)
+
+var (
+	ErrProductNotFound = errors.New("product not found")
+	ErrUnknownSource   = errors.New("unknown product source")
+)
+
+// ProductSource fetches products from Shopee (or something that looks like it).
+type ProductSource interface {
+	// FetchShopProducts returns every product listed on the shop page.
+	FetchShopProducts(ctx context.Context, shopID string) ([]database.Product, error)
+	// FetchProduct returns a single product of a shop.
+	FetchProduct(ctx context.Context, shopID string, itemID string) (database.Product, error)
+}
+
+// NewProductSource builds the source selected by the CRAWL_SOURCE env
+// (chromedp, http or fixture). chromedp is used when nothing is set. Live
+// sources are wrapped with the default rate limiter and guard.
+func NewProductSource() (ProductSource, error) {
+	name := os.Getenv("CRAWL_SOURCE")
+	switch name {
+	case "", SourceChromedp:
+		return NewGuardedSource(NewRateLimitedSource(DefaultChromedpSource(), DefaultRateLimiter()), DefaultGuard()), nil
+	case SourceHTTP:
+		return NewGuardedSource(NewRateLimitedSource(NewHTTPSource(nil, DefaultProxyPool()), DefaultRateLimiter()), DefaultGuard()), nil
+	case SourceFixture:
+		return NewFixtureSource(os.Getenv("CRAWL_FIXTURE_DIR")), nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownSource, name)
+}
+
+var (
+	defaultSource   ProductSource
+	defaultSourceMu sync.Mutex
+)
+
+// DefaultSource returns the source used by the package level helpers.
+// It is created from the env on first use.
+func DefaultSource() (ProductSource, error) {
+	defaultSourceMu.Lock()
+	defer defaultSourceMu.Unlock()
+	if defaultSource != nil {
+		return defaultSource, nil
+	}
+	source, err := NewProductSource()
+	if err != nil {
+		return nil, err
+	}
+	defaultSource = source
+	return defaultSource, nil
+}
+
+// SetDefaultSource replaces the source used by the package level helpers.
+func SetDefaultSource(source ProductSource) {
+	defaultSourceMu.Lock()
+	defer defaultSourceMu.Unlock()
+	defaultSource = source
+}
+
+// findProduct picks the item out of a shop listing.
+func findProduct(products []database.Product, itemID string) (database.Product, error) {
+	for _, product := range products {
+		if fmt.Sprint(product.IDShopee) == itemID {
+			return product, nil
+		}
+	}
+	return database.Product{}, ErrProductNotFound
+}
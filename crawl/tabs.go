@@ -0,0 +1,132 @@
+package crawl
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/cdproto/target"
+	"github.com/chromedp/chromedp"
+)
+
+// TabPool shares one connection to the headless shell between crawls and
+// bounds how many tabs are open on it at the same time.
+type TabPool struct {
+	allocatorUrl string
+	slots        chan struct{}
+
+	mu            sync.Mutex
+	browserCtx    context.Context
+	cancelBrowser context.CancelFunc
+}
+
+func NewTabPool(allocatorUrl string, size int) *TabPool {
+	if allocatorUrl == "" {
+		allocatorUrl = defaultHeadlessShellUrl
+	}
+	if size < 1 {
+		size = 1
+	}
+	return &TabPool{
+		allocatorUrl: allocatorUrl,
+		slots:        make(chan struct{}, size),
+	}
+}
+
+// TabPoolSizeFromEnv reads CRAWL_TABS, 4 by default.
+func TabPoolSizeFromEnv() int {
+	if n, err := strconv.Atoi(os.Getenv("CRAWL_TABS")); err == nil {
+		return n
+	}
+	return 4
+}
+
+// browser connects to the headless shell once and keeps the connection.
+func (p *TabPool) browser() (context.Context, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.browserCtx != nil && p.browserCtx.Err() == nil {
+		return p.browserCtx, nil
+	}
+	allocCtx, cancelAlloc := chromedp.NewRemoteAllocator(context.Background(), p.allocatorUrl)
+	browserCtx, cancelBrowser := chromedp.NewContext(allocCtx, chromedp.WithLogf(log.Printf))
+	if err := chromedp.Run(browserCtx); err != nil {
+		cancelBrowser()
+		cancelAlloc()
+		return nil, err
+	}
+	p.browserCtx = browserCtx
+	p.cancelBrowser = func() {
+		cancelBrowser()
+		cancelAlloc()
+	}
+	return browserCtx, nil
+}
+
+// reset drops the connection so the next tab connects again, used when
+// the headless shell went away.
+func (p *TabPool) reset(browserCtx context.Context) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.browserCtx == browserCtx && p.cancelBrowser != nil {
+		p.cancelBrowser()
+		p.browserCtx, p.cancelBrowser = nil, nil
+	}
+}
+
+// Tab waits for a free slot and opens a tab in its own browser context, so
+// cookies and the proxy do not leak to other crawls. The tab is closed when
+// ctx is done or cancel is called.
+func (p *TabPool) Tab(ctx context.Context, proxy string, userAgent string) (context.Context, context.CancelFunc, error) {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+	release := func() { <-p.slots }
+
+	browserCtx, err := p.browser()
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+
+	tabCtx, cancelTab := chromedp.NewContext(browserCtx, chromedp.WithNewBrowserContext(func(params *target.CreateBrowserContextParams) *target.CreateBrowserContextParams {
+		if proxy != "" {
+			return params.WithProxyServer(proxy)
+		}
+		return params
+	}))
+	stop := context.AfterFunc(ctx, cancelTab)
+	cancel := func() {
+		stop()
+		cancelTab()
+		release()
+	}
+
+	var actions []chromedp.Action
+	if userAgent != "" {
+		actions = append(actions, emulation.SetUserAgentOverride(userAgent))
+	}
+	if err := chromedp.Run(tabCtx, actions...); err != nil {
+		cancel()
+		if ctx.Err() == nil {
+			p.reset(browserCtx)
+		}
+		return nil, nil, err
+	}
+	return tabCtx, cancel, nil
+}
+
+// Close drops the connection to the headless shell.
+func (p *TabPool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cancelBrowser != nil {
+		p.cancelBrowser()
+		p.browserCtx, p.cancelBrowser = nil, nil
+	}
+}
@@ -0,0 +1,438 @@
+package database
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	CrawlJobCollectionName = "crawl_jobs"
+	JOB_CRAWL_SHOP         = "crawl_shop"
+	JOB_NOTIFY_PRICE       = "notify_price"
+	JOB_CLEANUP            = "cleanup"
+	JOB_SEND_EMAIL         = "send_email"
+	JOB_SEND_DIGEST        = "send_digest"
+	JOB_PENDING            = "pending"
+	JOB_LEASED             = "leased"
+	JOB_DONE               = "done"
+	JOB_DEAD               = "dead"
+	// LEASE_EXPIRED is the error of a job whose lease expired after its last
+	// attempt
+	LEASE_EXPIRED = "lease expired after the last attempt"
+)
+
+// CrawlJob is a unit of work of the job queue. A job is leased by one worker
+// at a time, when the lease expires without the job being completed another
+// worker can lease it again. Active is true while the job is pending or leased
+// so that the same job is only queued once.
+type CrawlJob struct {
+	ID          primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	Type        string             `json:"type" bson:"type"`
+	ShopID      int64              `json:"shop_id,omitempty" bson:"shop_id,omitempty"`
+	Status      string             `json:"status" bson:"status"`
+	Priority    float64            `json:"priority" bson:"priority"`
+	Active      bool               `json:"active" bson:"active"`
+	Attempts    int                `json:"attempts" bson:"attempts"`
+	MaxAttempts int                `json:"max_attempts" bson:"max_attempts"`
+	RunAt       time.Time          `json:"run_at" bson:"run_at"`
+	LeaseOwner  string             `json:"lease_owner,omitempty" bson:"lease_owner,omitempty"`
+	LeasedUntil time.Time          `json:"leased_until,omitempty" bson:"leased_until,omitempty"`
+	LastError   string             `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	CreatedAt   time.Time          `bson:"created_at,omitempty"`
+	UpdatedAt   time.Time          `bson:"updated_at,omitempty"`
+}
+
+type CrawlJobRepository interface {
+	Enqueue(ctx context.Context, job CrawlJob) (bool, error)
+	Lease(ctx context.Context, owner string, types []string, visibility time.Duration) (CrawlJob, error)
+	Complete(ctx context.Context, id primitive.ObjectID, owner string) error
+	Retry(ctx context.Context, id primitive.ObjectID, owner string, lastError string, runAt time.Time) error
+	Defer(ctx context.Context, id primitive.ObjectID, owner string, lastError string, runAt time.Time) error
+	Dead(ctx context.Context, id primitive.ObjectID, owner string, lastError string) error
+	FindByStatus(ctx context.Context, status string, limit int64) ([]CrawlJob, error)
+	DeleteDone(ctx context.Context, before time.Time) (int64, error)
+}
+
+type MongoCrawlJobRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoCrawlJobRepository(collection *mongo.Collection) *MongoCrawlJobRepository {
+	return &MongoCrawlJobRepository{collection}
+}
+
+// Enqueue adds the job unless the same job is already pending or leased.
+// It returns whether a new job was added.
+func (r *MongoCrawlJobRepository) Enqueue(ctx context.Context, job CrawlJob) (bool, error) {
+	if job.RunAt.IsZero() {
+		job.RunAt = time.Now()
+	}
+	result, err := r.collection.UpdateOne(ctx, bson.M{
+		"type":    job.Type,
+		"shop_id": job.ShopID,
+		"active":  true,
+	}, bson.M{
+		"$setOnInsert": bson.M{
+			"status":       JOB_PENDING,
+			"priority":     job.Priority,
+			"attempts":     0,
+			"max_attempts": job.MaxAttempts,
+			"run_at":       job.RunAt,
+			"created_at":   time.Now(),
+			"updated_at":   time.Now(),
+		},
+	}, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return result.UpsertedCount > 0, nil
+}
+
+// Lease takes the due job of the given types with the highest priority, or a
+// leased job whose lease has expired. A job whose lease expired after its
+// last attempt, e.g. because it crashed its worker every time, is moved to
+// the dead state instead. It returns mongo.ErrNoDocuments when there is
+// nothing to do.
+func (r *MongoCrawlJobRepository) Lease(ctx context.Context, owner string, types []string, visibility time.Duration) (CrawlJob, error) {
+	var job CrawlJob
+	now := time.Now()
+	outOfAttempts := bson.M{"$gte": bson.A{"$attempts", "$max_attempts"}}
+	_, err := r.collection.UpdateMany(ctx, bson.M{
+		"type":         bson.M{"$in": types},
+		"status":       JOB_LEASED,
+		"leased_until": bson.M{"$lt": now},
+		"$expr":        outOfAttempts,
+	}, bson.M{
+		"$set": bson.M{
+			"status":     JOB_DEAD,
+			"active":     false,
+			"last_error": LEASE_EXPIRED,
+			"updated_at": now,
+		},
+	})
+	if err != nil {
+		return CrawlJob{}, err
+	}
+	err = r.collection.FindOneAndUpdate(ctx, bson.M{
+		"type": bson.M{"$in": types},
+		"$or": []bson.M{
+			{"status": JOB_PENDING, "run_at": bson.M{"$lte": now}},
+			{"status": JOB_LEASED, "leased_until": bson.M{"$lt": now}, "$expr": bson.M{"$not": outOfAttempts}},
+		},
+	}, bson.M{
+		"$set": bson.M{
+			"status":       JOB_LEASED,
+			"lease_owner":  owner,
+			"leased_until": now.Add(visibility),
+			"updated_at":   now,
+		},
+		"$inc": bson.M{"attempts": 1},
+	}, options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "priority", Value: -1}, {Key: "run_at", Value: 1}}).
+		SetReturnDocument(options.After),
+	).Decode(&job)
+	if err != nil {
+		return CrawlJob{}, err
+	}
+	return job, nil
+}
+
+func (r *MongoCrawlJobRepository) Complete(ctx context.Context, id primitive.ObjectID, owner string) error {
+	return r.finish(ctx, id, owner, bson.M{
+		"status":     JOB_DONE,
+		"active":     false,
+		"updated_at": time.Now(),
+	})
+}
+
+func (r *MongoCrawlJobRepository) Retry(ctx context.Context, id primitive.ObjectID, owner string, lastError string, runAt time.Time) error {
+	return r.finish(ctx, id, owner, bson.M{
+		"status":     JOB_PENDING,
+		"run_at":     runAt,
+		"last_error": lastError,
+		"updated_at": time.Now(),
+	})
+}
+
+// Defer puts the job back for later without using an attempt.
+func (r *MongoCrawlJobRepository) Defer(ctx context.Context, id primitive.ObjectID, owner string, lastError string, runAt time.Time) error {
+	result, err := r.collection.UpdateOne(ctx, bson.M{
+		"_id":         id,
+		"status":      JOB_LEASED,
+		"lease_owner": owner,
+	}, bson.M{
+		"$set": bson.M{
+			"status":     JOB_PENDING,
+			"run_at":     runAt,
+			"last_error": lastError,
+			"updated_at": time.Now(),
+		},
+		"$inc": bson.M{"attempts": -1},
+	})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *MongoCrawlJobRepository) Dead(ctx context.Context, id primitive.ObjectID, owner string, lastError string) error {
+	return r.finish(ctx, id, owner, bson.M{
+		"status":     JOB_DEAD,
+		"active":     false,
+		"last_error": lastError,
+		"updated_at": time.Now(),
+	})
+}
+
+// finish only touches the job while the owner still holds the lease.
+func (r *MongoCrawlJobRepository) finish(ctx context.Context, id primitive.ObjectID, owner string, set bson.M) error {
+	result, err := r.collection.UpdateOne(ctx, bson.M{
+		"_id":         id,
+		"status":      JOB_LEASED,
+		"lease_owner": owner,
+	}, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *MongoCrawlJobRepository) FindByStatus(ctx context.Context, status string, limit int64) ([]CrawlJob, error) {
+	var jobs []CrawlJob
+	cursor, err := r.collection.Find(ctx, bson.M{"status": status}, options.Find().
+		SetSort(bson.D{{Key: "updated_at", Value: -1}}).
+		SetLimit(limit),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// DeleteDone removes the completed jobs last updated before the given time.
+// Dead jobs are kept so they can be looked at.
+func (r *MongoCrawlJobRepository) DeleteDone(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.collection.DeleteMany(ctx, bson.M{
+		"status":     JOB_DONE,
+		"updated_at": bson.M{"$lt": before},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+type MemoryCrawlJobRepository struct {
+	jobs memoryCollection[CrawlJob]
+}
+
+func NewMemoryCrawlJobRepository() *MemoryCrawlJobRepository {
+	return &MemoryCrawlJobRepository{}
+}
+
+func (r *MemoryCrawlJobRepository) Enqueue(ctx context.Context, job CrawlJob) (bool, error) {
+	r.jobs.mu.Lock()
+	defer r.jobs.mu.Unlock()
+	if r.jobs.find(func(j CrawlJob) bool {
+		return j.Type == job.Type && j.ShopID == job.ShopID && j.Active
+	}) >= 0 {
+		return false, nil
+	}
+	now := time.Now()
+	if job.RunAt.IsZero() {
+		job.RunAt = now
+	}
+	r.jobs.docs = append(r.jobs.docs, CrawlJob{
+		ID:          primitive.NewObjectID(),
+		Type:        job.Type,
+		ShopID:      job.ShopID,
+		Status:      JOB_PENDING,
+		Priority:    job.Priority,
+		Active:      true,
+		MaxAttempts: job.MaxAttempts,
+		RunAt:       job.RunAt,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	})
+	return true, nil
+}
+
+func (r *MemoryCrawlJobRepository) Lease(ctx context.Context, owner string, types []string, visibility time.Duration) (CrawlJob, error) {
+	r.jobs.mu.Lock()
+	defer r.jobs.mu.Unlock()
+	now := time.Now()
+	leased := -1
+	for i, job := range r.jobs.docs {
+		if !slices.Contains(types, job.Type) {
+			continue
+		}
+		expired := job.Status == JOB_LEASED && job.LeasedUntil.Before(now)
+		if expired && job.Attempts >= job.MaxAttempts {
+			r.jobs.docs[i].Status = JOB_DEAD
+			r.jobs.docs[i].Active = false
+			r.jobs.docs[i].LastError = LEASE_EXPIRED
+			r.jobs.docs[i].UpdatedAt = now
+			continue
+		}
+		if !expired && (job.Status != JOB_PENDING || job.RunAt.After(now)) {
+			continue
+		}
+		if leased < 0 {
+			leased = i
+			continue
+		}
+		best := r.jobs.docs[leased]
+		if job.Priority > best.Priority || (job.Priority == best.Priority && job.RunAt.Before(best.RunAt)) {
+			leased = i
+		}
+	}
+	if leased < 0 {
+		return CrawlJob{}, ErrNotFound
+	}
+	job := &r.jobs.docs[leased]
+	job.Status = JOB_LEASED
+	job.LeaseOwner = owner
+	job.LeasedUntil = now.Add(visibility)
+	job.UpdatedAt = now
+	job.Attempts++
+	return *job, nil
+}
+
+func (r *MemoryCrawlJobRepository) Complete(ctx context.Context, id primitive.ObjectID, owner string) error {
+	return r.finish(id, owner, func(job *CrawlJob) {
+		job.Status = JOB_DONE
+		job.Active = false
+	})
+}
+
+func (r *MemoryCrawlJobRepository) Retry(ctx context.Context, id primitive.ObjectID, owner string, lastError string, runAt time.Time) error {
+	return r.finish(id, owner, func(job *CrawlJob) {
+		job.Status = JOB_PENDING
+		job.RunAt = runAt
+		job.LastError = lastError
+	})
+}
+
+func (r *MemoryCrawlJobRepository) Defer(ctx context.Context, id primitive.ObjectID, owner string, lastError string, runAt time.Time) error {
+	return r.finish(id, owner, func(job *CrawlJob) {
+		job.Status = JOB_PENDING
+		job.RunAt = runAt
+		job.LastError = lastError
+		job.Attempts--
+	})
+}
+
+func (r *MemoryCrawlJobRepository) Dead(ctx context.Context, id primitive.ObjectID, owner string, lastError string) error {
+	return r.finish(id, owner, func(job *CrawlJob) {
+		job.Status = JOB_DEAD
+		job.Active = false
+		job.LastError = lastError
+	})
+}
+
+func (r *MemoryCrawlJobRepository) finish(id primitive.ObjectID, owner string, apply func(job *CrawlJob)) error {
+	r.jobs.mu.Lock()
+	defer r.jobs.mu.Unlock()
+	i := r.jobs.find(func(j CrawlJob) bool {
+		return j.ID == id && j.Status == JOB_LEASED && j.LeaseOwner == owner
+	})
+	if i < 0 {
+		return ErrNotFound
+	}
+	apply(&r.jobs.docs[i])
+	r.jobs.docs[i].UpdatedAt = time.Now()
+	return nil
+}
+
+func (r *MemoryCrawlJobRepository) FindByStatus(ctx context.Context, status string, limit int64) ([]CrawlJob, error) {
+	r.jobs.mu.Lock()
+	jobs := r.jobs.filter(func(j CrawlJob) bool { return j.Status == status })
+	r.jobs.mu.Unlock()
+	sort.SliceStable(jobs, func(i, j int) bool { return jobs[i].UpdatedAt.After(jobs[j].UpdatedAt) })
+	return jobs[:min(int64(len(jobs)), limit)], nil
+}
+
+func (r *MemoryCrawlJobRepository) DeleteDone(ctx context.Context, before time.Time) (int64, error) {
+	r.jobs.mu.Lock()
+	defer r.jobs.mu.Unlock()
+	kept := r.jobs.filter(func(j CrawlJob) bool {
+		return j.Status != JOB_DONE || !j.UpdatedAt.Before(before)
+	})
+	deleted := int64(len(r.jobs.docs) - len(kept))
+	r.jobs.docs = kept
+	return deleted, nil
+}
+
+type CrawlJobService struct {
+	repo CrawlJobRepository
+}
+
+func NewCrawlJobService(repo CrawlJobRepository) *CrawlJobService {
+	return &CrawlJobService{repo}
+}
+
+func (s *CrawlJobService) Enqueue(ctx context.Context, job CrawlJob) (bool, error) {
+	if job.MaxAttempts == 0 {
+		job.MaxAttempts = 5
+	}
+	return s.repo.Enqueue(ctx, job)
+}
+
+func (s *CrawlJobService) Lease(ctx context.Context, owner string, types []string, visibility time.Duration) (CrawlJob, error) {
+	return s.repo.Lease(ctx, owner, types, visibility)
+}
+
+func (s *CrawlJobService) Complete(ctx context.Context, id primitive.ObjectID, owner string) error {
+	return s.repo.Complete(ctx, id, owner)
+}
+
+// Fail retries the job later with an exponential back-off, or moves it to
+// the dead state once it used all its attempts.
+func (s *CrawlJobService) Fail(ctx context.Context, job CrawlJob, owner string, jobErr error) error {
+	if job.Attempts >= job.MaxAttempts {
+		return s.repo.Dead(ctx, job.ID, owner, jobErr.Error())
+	}
+	return s.repo.Retry(ctx, job.ID, owner, jobErr.Error(), time.Now().Add(jobBackoff(job.Attempts)))
+}
+
+// Defer retries the job later without using the attempt it just made, for
+// the failures that are not its fault.
+func (s *CrawlJobService) Defer(ctx context.Context, job CrawlJob, owner string, jobErr error) error {
+	return s.repo.Defer(ctx, job.ID, owner, jobErr.Error(), time.Now().Add(jobBackoff(job.Attempts)))
+}
+
+// jobBackoff doubles from a minute with the attempts, up to an hour.
+func jobBackoff(attempts int) time.Duration {
+	backoff := time.Minute << (attempts - 1)
+	if backoff <= 0 || backoff > time.Hour {
+		backoff = time.Hour
+	}
+	return backoff
+}
+
+func (s *CrawlJobService) FindByStatus(ctx context.Context, status string, limit int64) ([]CrawlJob, error) {
+	return s.repo.FindByStatus(ctx, status, limit)
+}
+
+func (s *CrawlJobService) DeleteDone(ctx context.Context, before time.Time) (int64, error) {
+	return s.repo.DeleteDone(ctx, before)
+}
@@ -0,0 +1,373 @@
+package database
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	EmailCollectionName = "email_outbox"
+	EMAIL_VERIFY        = "verify"
+	EMAIL_RESET         = "reset_password"
+	EMAIL_ALERT         = "alert"
+	EMAIL_PENDING       = "pending"
+	EMAIL_SENDING       = "sending"
+	EMAIL_SENT          = "sent"
+	// EMAIL_FAILED is a message the server refused for good, e.g. a bounce,
+	// or that used all its attempts
+	EMAIL_FAILED = "failed"
+)
+
+// Email is a message of the outbox. The handlers only queue it, the sender
+// leases it and sends it, like the jobs of the job queue.
+type Email struct {
+	ID          primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	Kind        string             `json:"kind" bson:"kind"`
+	To          string             `json:"to" bson:"to"`
+	Subject     string             `json:"subject" bson:"subject"`
+	HTML        string             `json:"html" bson:"html"`
+	Text        string             `json:"text,omitempty" bson:"text,omitempty"`
+	Status      string             `json:"status" bson:"status"`
+	Attempts    int                `json:"attempts" bson:"attempts"`
+	MaxAttempts int                `json:"max_attempts" bson:"max_attempts"`
+	SendAt      time.Time          `json:"send_at" bson:"send_at"`
+	LeaseOwner  string             `json:"lease_owner,omitempty" bson:"lease_owner,omitempty"`
+	LeasedUntil time.Time          `json:"leased_until,omitempty" bson:"leased_until,omitempty"`
+	LastError   string             `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	SentAt      time.Time          `json:"sent_at,omitempty" bson:"sent_at,omitempty"`
+	CreatedAt   time.Time          `bson:"created_at,omitempty"`
+	UpdatedAt   time.Time          `bson:"updated_at,omitempty"`
+}
+
+type EmailRepository interface {
+	Insert(ctx context.Context, email Email) (Email, error)
+	Lease(ctx context.Context, owner string, visibility time.Duration) (Email, error)
+	MarkSent(ctx context.Context, id primitive.ObjectID, owner string) error
+	Retry(ctx context.Context, id primitive.ObjectID, owner string, lastError string, sendAt time.Time) error
+	Defer(ctx context.Context, id primitive.ObjectID, owner string, sendAt time.Time) error
+	Fail(ctx context.Context, id primitive.ObjectID, owner string, lastError string) error
+	CountSentSince(ctx context.Context, to string, since time.Time) (int64, error)
+	FindStuck(ctx context.Context, before time.Time, limit int64, page int64) (DataWithPagination[Email], error)
+}
+
+type MongoEmailRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoEmailRepository(collection *mongo.Collection) *MongoEmailRepository {
+	return &MongoEmailRepository{collection}
+}
+
+func (r *MongoEmailRepository) Insert(ctx context.Context, email Email) (Email, error) {
+	now := time.Now()
+	if email.SendAt.IsZero() {
+		email.SendAt = now
+	}
+	email.Status = EMAIL_PENDING
+	email.CreatedAt = now
+	email.UpdatedAt = now
+	result, err := r.collection.InsertOne(ctx, bson.M{
+		"kind":         email.Kind,
+		"to":           email.To,
+		"subject":      email.Subject,
+		"html":         email.HTML,
+		"text":         email.Text,
+		"status":       email.Status,
+		"attempts":     0,
+		"max_attempts": email.MaxAttempts,
+		"send_at":      email.SendAt,
+		"created_at":   now,
+		"updated_at":   now,
+	})
+	if err != nil {
+		return Email{}, err
+	}
+	email.ID = result.InsertedID.(primitive.ObjectID)
+	return email, nil
+}
+
+// Lease takes the oldest due message, or one whose sender died while
+// sending it. It returns mongo.ErrNoDocuments when there is nothing to send.
+func (r *MongoEmailRepository) Lease(ctx context.Context, owner string, visibility time.Duration) (Email, error) {
+	var email Email
+	now := time.Now()
+	err := r.collection.FindOneAndUpdate(ctx, bson.M{
+		"$or": []bson.M{
+			{"status": EMAIL_PENDING, "send_at": bson.M{"$lte": now}},
+			{"status": EMAIL_SENDING, "leased_until": bson.M{"$lt": now}},
+		},
+	}, bson.M{
+		"$set": bson.M{
+			"status":       EMAIL_SENDING,
+			"lease_owner":  owner,
+			"leased_until": now.Add(visibility),
+			"updated_at":   now,
+		},
+		"$inc": bson.M{"attempts": 1},
+	}, options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "send_at", Value: 1}}).
+		SetReturnDocument(options.After),
+	).Decode(&email)
+	if err != nil {
+		return Email{}, err
+	}
+	return email, nil
+}
+
+func (r *MongoEmailRepository) MarkSent(ctx context.Context, id primitive.ObjectID, owner string) error {
+	now := time.Now()
+	return r.finish(ctx, id, owner, bson.M{
+		"$set": bson.M{"status": EMAIL_SENT, "sent_at": now, "updated_at": now},
+	})
+}
+
+func (r *MongoEmailRepository) Retry(ctx context.Context, id primitive.ObjectID, owner string, lastError string, sendAt time.Time) error {
+	return r.finish(ctx, id, owner, bson.M{
+		"$set": bson.M{"status": EMAIL_PENDING, "send_at": sendAt, "last_error": lastError, "updated_at": time.Now()},
+	})
+}
+
+// Defer puts the message back for later without using an attempt.
+func (r *MongoEmailRepository) Defer(ctx context.Context, id primitive.ObjectID, owner string, sendAt time.Time) error {
+	return r.finish(ctx, id, owner, bson.M{
+		"$set": bson.M{"status": EMAIL_PENDING, "send_at": sendAt, "updated_at": time.Now()},
+		"$inc": bson.M{"attempts": -1},
+	})
+}
+
+func (r *MongoEmailRepository) Fail(ctx context.Context, id primitive.ObjectID, owner string, lastError string) error {
+	return r.finish(ctx, id, owner, bson.M{
+		"$set": bson.M{"status": EMAIL_FAILED, "last_error": lastError, "updated_at": time.Now()},
+	})
+}
+
+// finish only touches the message while the owner still holds the lease.
+func (r *MongoEmailRepository) finish(ctx context.Context, id primitive.ObjectID, owner string, update bson.M) error {
+	result, err := r.collection.UpdateOne(ctx, bson.M{
+		"_id":         id,
+		"status":      EMAIL_SENDING,
+		"lease_owner": owner,
+	}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *MongoEmailRepository) CountSentSince(ctx context.Context, to string, since time.Time) (int64, error) {
+	return r.collection.CountDocuments(ctx, bson.M{
+		"to":      to,
+		"status":  EMAIL_SENT,
+		"sent_at": bson.M{"$gte": since},
+	})
+}
+
+// FindStuck returns the failed messages and the ones that should have been
+// sent before the given time, the oldest first.
+func (r *MongoEmailRepository) FindStuck(ctx context.Context, before time.Time, limit int64, page int64) (DataWithPagination[Email], error) {
+	filter := bson.M{
+		"$or": []bson.M{
+			{"status": EMAIL_FAILED},
+			{"status": bson.M{"$in": []string{EMAIL_PENDING, EMAIL_SENDING}}, "send_at": bson.M{"$lt": before}},
+		},
+	}
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return DataWithPagination[Email]{}, err
+	}
+	emails := []Email{}
+	cursor, err := r.collection.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "send_at", Value: 1}}).
+		// the bodies are not needed to see what is stuck
+		SetProjection(bson.M{"html": 0, "text": 0}).
+		SetSkip((page-1)*limit).
+		SetLimit(limit),
+	)
+	if err != nil {
+		return DataWithPagination[Email]{}, err
+	}
+	if err = cursor.All(ctx, &emails); err != nil {
+		return DataWithPagination[Email]{}, err
+	}
+	return DataWithPagination[Email]{
+		Data:        emails,
+		TotalItems:  int(total),
+		TotalPages:  int((total + limit - 1) / limit),
+		CurrentPage: int(page),
+		Limit:       int(limit),
+	}, nil
+}
+
+type MemoryEmailRepository struct {
+	emails memoryCollection[Email]
+}
+
+func NewMemoryEmailRepository() *MemoryEmailRepository {
+	return &MemoryEmailRepository{}
+}
+
+func (r *MemoryEmailRepository) Insert(ctx context.Context, email Email) (Email, error) {
+	now := time.Now()
+	if email.SendAt.IsZero() {
+		email.SendAt = now
+	}
+	email.ID = primitive.NewObjectID()
+	email.Status = EMAIL_PENDING
+	email.Attempts = 0
+	email.CreatedAt = now
+	email.UpdatedAt = now
+	r.emails.mu.Lock()
+	defer r.emails.mu.Unlock()
+	r.emails.docs = append(r.emails.docs, email)
+	return email, nil
+}
+
+func (r *MemoryEmailRepository) Lease(ctx context.Context, owner string, visibility time.Duration) (Email, error) {
+	r.emails.mu.Lock()
+	defer r.emails.mu.Unlock()
+	now := time.Now()
+	leased := -1
+	for i, email := range r.emails.docs {
+		due := (email.Status == EMAIL_PENDING && !email.SendAt.After(now)) ||
+			(email.Status == EMAIL_SENDING && email.LeasedUntil.Before(now))
+		if due && (leased < 0 || email.SendAt.Before(r.emails.docs[leased].SendAt)) {
+			leased = i
+		}
+	}
+	if leased < 0 {
+		return Email{}, ErrNotFound
+	}
+	email := &r.emails.docs[leased]
+	email.Status = EMAIL_SENDING
+	email.LeaseOwner = owner
+	email.LeasedUntil = now.Add(visibility)
+	email.UpdatedAt = now
+	email.Attempts++
+	return *email, nil
+}
+
+func (r *MemoryEmailRepository) MarkSent(ctx context.Context, id primitive.ObjectID, owner string) error {
+	return r.finish(id, owner, func(email *Email) {
+		email.Status = EMAIL_SENT
+		email.SentAt = time.Now()
+	})
+}
+
+func (r *MemoryEmailRepository) Retry(ctx context.Context, id primitive.ObjectID, owner string, lastError string, sendAt time.Time) error {
+	return r.finish(id, owner, func(email *Email) {
+		email.Status = EMAIL_PENDING
+		email.SendAt = sendAt
+		email.LastError = lastError
+	})
+}
+
+func (r *MemoryEmailRepository) Defer(ctx context.Context, id primitive.ObjectID, owner string, sendAt time.Time) error {
+	return r.finish(id, owner, func(email *Email) {
+		email.Status = EMAIL_PENDING
+		email.SendAt = sendAt
+		email.Attempts--
+	})
+}
+
+func (r *MemoryEmailRepository) Fail(ctx context.Context, id primitive.ObjectID, owner string, lastError string) error {
+	return r.finish(id, owner, func(email *Email) {
+		email.Status = EMAIL_FAILED
+		email.LastError = lastError
+	})
+}
+
+func (r *MemoryEmailRepository) finish(id primitive.ObjectID, owner string, apply func(email *Email)) error {
+	r.emails.mu.Lock()
+	defer r.emails.mu.Unlock()
+	i := r.emails.find(func(e Email) bool {
+		return e.ID == id && e.Status == EMAIL_SENDING && e.LeaseOwner == owner
+	})
+	if i < 0 {
+		return ErrNotFound
+	}
+	apply(&r.emails.docs[i])
+	r.emails.docs[i].UpdatedAt = time.Now()
+	return nil
+}
+
+func (r *MemoryEmailRepository) CountSentSince(ctx context.Context, to string, since time.Time) (int64, error) {
+	r.emails.mu.Lock()
+	defer r.emails.mu.Unlock()
+	sent := r.emails.filter(func(e Email) bool {
+		return e.To == to && e.Status == EMAIL_SENT && !e.SentAt.Before(since)
+	})
+	return int64(len(sent)), nil
+}
+
+func (r *MemoryEmailRepository) FindStuck(ctx context.Context, before time.Time, limit int64, page int64) (DataWithPagination[Email], error) {
+	r.emails.mu.Lock()
+	emails := r.emails.filter(func(e Email) bool {
+		return e.Status == EMAIL_FAILED ||
+			((e.Status == EMAIL_PENDING || e.Status == EMAIL_SENDING) && e.SendAt.Before(before))
+	})
+	r.emails.mu.Unlock()
+	sort.SliceStable(emails, func(i, j int) bool { return emails[i].SendAt.Before(emails[j].SendAt) })
+	for i := range emails {
+		emails[i].HTML = ""
+		emails[i].Text = ""
+	}
+	return paginate(emails, limit, page), nil
+}
+
+type EmailService struct {
+	repo EmailRepository
+}
+
+func NewEmailService(repo EmailRepository) *EmailService {
+	return &EmailService{repo}
+}
+
+// Queue adds the message to the outbox.
+func (s *EmailService) Queue(ctx context.Context, email Email) (Email, error) {
+	if email.MaxAttempts == 0 {
+		email.MaxAttempts = 8
+	}
+	return s.repo.Insert(ctx, email)
+}
+
+func (s *EmailService) Lease(ctx context.Context, owner string, visibility time.Duration) (Email, error) {
+	return s.repo.Lease(ctx, owner, visibility)
+}
+
+func (s *EmailService) MarkSent(ctx context.Context, id primitive.ObjectID, owner string) error {
+	return s.repo.MarkSent(ctx, id, owner)
+}
+
+func (s *EmailService) Defer(ctx context.Context, id primitive.ObjectID, owner string, sendAt time.Time) error {
+	return s.repo.Defer(ctx, id, owner, sendAt)
+}
+
+// Fail retries the message later with an exponential back-off. It gives up
+// when the failure is permanent or the message used all its attempts.
+func (s *EmailService) Fail(ctx context.Context, email Email, owner string, sendErr error, permanent bool) error {
+	if permanent || email.Attempts >= email.MaxAttempts {
+		return s.repo.Fail(ctx, email.ID, owner, sendErr.Error())
+	}
+	backoff := time.Minute << (email.Attempts - 1)
+	if backoff <= 0 || backoff > time.Hour {
+		backoff = time.Hour
+	}
+	return s.repo.Retry(ctx, email.ID, owner, sendErr.Error(), time.Now().Add(backoff))
+}
+
+func (s *EmailService) CountSentSince(ctx context.Context, to string, since time.Time) (int64, error) {
+	return s.repo.CountSentSince(ctx, to, since)
+}
+
+func (s *EmailService) FindStuck(ctx context.Context, before time.Time, limit int64, page int64) (DataWithPagination[Email], error) {
+	return s.repo.FindStuck(ctx, before, limit, page)
+}
@@ -0,0 +1,164 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const SchemaMigrationCollectionName = "schema_migrations"
+
+// ErrNotMigrated is returned by CheckMigrations when migrations are pending.
+var ErrNotMigrated = errors.New("database is not migrated")
+
+// ErrIrreversible is returned when rolling back a migration without Down.
+var ErrIrreversible = errors.New("migration can not be rolled back")
+
+// Migration changes the schema or the documents of the database. Migrations
+// run in the order of their version, Up must be safe to run again on a
+// database it was already run on, a migration that can not be undone has no
+// Down.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, db *mongo.Database) error
+	Down    func(ctx context.Context, db *mongo.Database) error
+}
+
+// MigrationRecord is an applied migration in schema_migrations.
+type MigrationRecord struct {
+	Version   int       `json:"version" bson:"_id"`
+	Name      string    `json:"name" bson:"name"`
+	AppliedAt time.Time `json:"applied_at" bson:"applied_at"`
+}
+
+// MigrationStatus tells whether a migration was applied.
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrations returns the migrations of the schema, oldest first.
+func Migrations() []Migration {
+	sorted := append([]Migration{}, migrations...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+	return sorted
+}
+
+func appliedMigrations(ctx context.Context) (map[int]MigrationRecord, error) {
+	var records []MigrationRecord
+	cursor, err := MongoDB.Collection(SchemaMigrationCollectionName).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	applied := map[int]MigrationRecord{}
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+// MigrationsStatus returns every migration and whether it was applied.
+func MigrationsStatus(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statuses := []MigrationStatus{}
+	for _, migration := range Migrations() {
+		record, ok := applied[migration.Version]
+		statuses = append(statuses, MigrationStatus{Migration: migration, Applied: ok, AppliedAt: record.AppliedAt})
+	}
+	return statuses, nil
+}
+
+// MigrateUp applies the pending migrations up to version, all of them when
+// version is 0, and returns the ones it applied.
+func MigrateUp(ctx context.Context, version int) ([]Migration, error) {
+	statuses, err := MigrationsStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	done := []Migration{}
+	for _, status := range statuses {
+		if status.Applied {
+			continue
+		}
+		if version > 0 && status.Version > version {
+			break
+		}
+		if err := status.Up(ctx, MongoDB); err != nil {
+			return done, fmt.Errorf("migration %d %s: %w", status.Version, status.Name, err)
+		}
+		_, err := MongoDB.Collection(SchemaMigrationCollectionName).UpdateOne(ctx,
+			bson.M{"_id": status.Version},
+			bson.M{"$set": bson.M{"name": status.Name, "applied_at": time.Now()}},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return done, err
+		}
+		done = append(done, status.Migration)
+	}
+	return done, nil
+}
+
+// MigrateDown rolls back the last steps applied migrations, newest first, and
+// returns the ones it rolled back.
+func MigrateDown(ctx context.Context, steps int) ([]Migration, error) {
+	statuses, err := MigrationsStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	done := []Migration{}
+	for i := len(statuses) - 1; i >= 0 && len(done) < steps; i-- {
+		status := statuses[i]
+		if !status.Applied {
+			continue
+		}
+		if status.Down == nil {
+			return done, fmt.Errorf("migration %d %s: %w", status.Version, status.Name, ErrIrreversible)
+		}
+		if err := status.Down(ctx, MongoDB); err != nil {
+			return done, fmt.Errorf("migration %d %s: %w", status.Version, status.Name, err)
+		}
+		_, err := MongoDB.Collection(SchemaMigrationCollectionName).DeleteOne(ctx, bson.M{"_id": status.Version})
+		if err != nil {
+			return done, err
+		}
+		done = append(done, status.Migration)
+	}
+	return done, nil
+}
+
+// CheckMigrations returns ErrNotMigrated with the pending versions when the
+// database is behind the code.
+func CheckMigrations(ctx context.Context) error {
+	statuses, err := MigrationsStatus(ctx)
+	if err != nil {
+		return err
+	}
+	pending := []string{}
+	for _, status := range statuses {
+		if !status.Applied {
+			pending = append(pending, fmt.Sprintf("%d %s", status.Version, status.Name))
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w, pending: %s", ErrNotMigrated, strings.Join(pending, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package database
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMigrationsAreNumbered(t *testing.T) {
+	for i, migration := range Migrations() {
+		if migration.Version != i+1 {
+			t.Fatalf("migration %q has version %d, want %d", migration.Name, migration.Version, i+1)
+		}
+		if migration.Name == "" || migration.Up == nil {
+			t.Errorf("migration %d needs a name and Up", migration.Version)
+		}
+	}
+}
+
+func TestIndexName(t *testing.T) {
+	for _, test := range []struct {
+		keys bson.D
+		want string
+	}{
+		{bson.D{{Key: "email", Value: 1}}, "email_1"},
+		{bson.D{{Key: "name", Value: "text"}}, "name_text"},
+		{bson.D{{Key: "product.$id", Value: 1}, {Key: "created_at", Value: -1}}, "product.$id_1_created_at_-1"},
+	} {
+		if got := indexName(test.keys); got != test.want {
+			t.Errorf("indexName(%v) = %q, want %q", test.keys, got, test.want)
+		}
+	}
+}
@@ -21,47 +21,7 @@ func NewMongoDB(dbName string) error {
 		return err
 	}
 	MongoDB = MongoDBClient.Database(dbName)
-	return nil
-}
-
-func indexedForDocument(collection *mongo.Collection, index map[string]interface{}) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
-		Keys:    index,
-		Options: options.Index().SetUnique(true),
-	})
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-func SetupIndexed() error {
-	// setup index for users collection
-	userCollection := MongoDB.Collection(UserCollectionName)
-	err := indexedForDocument(userCollection, map[string]interface{}{
-		"email": 1,
-	})
-	if err != nil {
-		return err
-	}
-	// setup index for products collection
-	productCollection := MongoDB.Collection(ProductCollectionName)
-	err = indexedForDocument(productCollection, map[string]interface{}{
-		"id_shopee": 1,
-	})
-	if err != nil {
-		return err
-	}
-	// setup index for shops collection
-	shopCollection := MongoDB.Collection(ShopCollectionName)
-	err = indexedForDocument(shopCollection, map[string]interface{}{
-		"shop_id": 1,
-	})
-	if err != nil {
-		return err
-	}
+	Repos = NewMongoRepositories(MongoDB)
 	return nil
 }
 
@@ -0,0 +1,459 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	NotificationCollectionName = "notifications"
+	CHANNEL_EMAIL              = "email"
+	CHANNEL_WEBHOOK            = "webhook"
+	CHANNEL_TELEGRAM           = "telegram"
+	CHANNEL_DISCORD            = "discord"
+	CHANNEL_SLACK              = "slack"
+	CHANNEL_WEB_PUSH           = "web_push"
+	NOTIFICATION_PENDING       = "pending"
+	NOTIFICATION_SENT          = "sent"
+	NOTIFICATION_FAILED        = "failed"
+	// NOTIFICATION_DIGEST waits to be sent in the next digest of the user
+	NOTIFICATION_DIGEST = "digest"
+	// MAX_NOTIFICATION_ATTEMPTS is how many times a notification is sent
+	// before it is left failed
+	MAX_NOTIFICATION_ATTEMPTS = 5
+)
+
+// Notification records an alert of a condition for one price observation on
+// one channel. The three of them are unique, so the same price event is
+// never sent twice.
+type Notification struct {
+	ID          primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	ConditionID primitive.ObjectID `json:"condition_id" bson:"condition_id"`
+	UserID      primitive.ObjectID `json:"user_id" bson:"user_id"`
+	TrackingID  primitive.ObjectID `json:"tracking_id" bson:"tracking_id"`
+	PriceID     primitive.ObjectID `json:"price_id" bson:"price_id"`
+	Price       int64              `json:"price" bson:"price"`
+	// the alert itself, kept for the digests
+	PricePrevious int64     `json:"price_previous" bson:"price_previous"`
+	Condition     string    `json:"condition" bson:"condition"`
+	ProductName   string    `json:"product_name,omitempty" bson:"product_name,omitempty"`
+	ProductImage  string    `json:"product_image,omitempty" bson:"product_image,omitempty"`
+	Link          string    `json:"link,omitempty" bson:"link,omitempty"`
+	Discount      float64   `json:"discount,omitempty" bson:"discount,omitempty"`
+	Channel       string    `json:"channel" bson:"channel"`
+	Status        string    `json:"status" bson:"status"`
+	Attempts      int       `json:"attempts" bson:"attempts"`
+	Error         string    `json:"error,omitempty" bson:"error,omitempty"`
+	SentAt        time.Time `json:"sent_at,omitempty" bson:"sent_at,omitempty"`
+	CreatedAt     time.Time `bson:"created_at,omitempty"`
+	UpdatedAt     time.Time `bson:"updated_at,omitempty"`
+}
+
+type NotificationRepository interface {
+	Insert(ctx context.Context, notification Notification) (Notification, error)
+	UpdateStatus(ctx context.Context, id primitive.ObjectID, status string, errorMsg string) error
+	FindLastSent(ctx context.Context, conditionID primitive.ObjectID) (Notification, error)
+	FindDigestUsers(ctx context.Context) ([]primitive.ObjectID, error)
+	FindDigestByUser(ctx context.Context, userID primitive.ObjectID, limit int64) ([]Notification, error)
+	RetryDigest(ctx context.Context, ids []primitive.ObjectID, errorMsg string) error
+	UpdateStatusMany(ctx context.Context, ids []primitive.ObjectID, status string, errorMsg string) error
+	Reclaim(ctx context.Context, notification Notification, staleBefore time.Time) (Notification, error)
+	FindPageByUserID(ctx context.Context, userID primitive.ObjectID, limit int64, page int64) (DataWithPagination[Notification], error)
+}
+
+type MongoNotificationRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoNotificationRepository(collection *mongo.Collection) *MongoNotificationRepository {
+	return &MongoNotificationRepository{collection}
+}
+
+// Insert records a notification, pending unless it waits for a digest. It
+// fails with a duplicate key error when the notification was already
+// recorded.
+func (r *MongoNotificationRepository) Insert(ctx context.Context, notification Notification) (Notification, error) {
+	now := time.Now()
+	if notification.Status != NOTIFICATION_DIGEST {
+		notification.Status = NOTIFICATION_PENDING
+	}
+	notification.Attempts = 1
+	notification.CreatedAt = now
+	notification.UpdatedAt = now
+	result, err := r.collection.InsertOne(ctx, bson.M{
+		"condition_id":   notification.ConditionID,
+		"user_id":        notification.UserID,
+		"tracking_id":    notification.TrackingID,
+		"price_id":       notification.PriceID,
+		"price":          notification.Price,
+		"price_previous": notification.PricePrevious,
+		"condition":      notification.Condition,
+		"product_name":   notification.ProductName,
+		"product_image":  notification.ProductImage,
+		"link":           notification.Link,
+		"discount":       notification.Discount,
+		"channel":        notification.Channel,
+		"status":         notification.Status,
+		"attempts":       1,
+		"created_at":     now,
+		"updated_at":     now,
+	})
+	if err != nil {
+		return Notification{}, err
+	}
+	notification.ID = result.InsertedID.(primitive.ObjectID)
+	return notification, nil
+}
+
+func (r *MongoNotificationRepository) UpdateStatus(ctx context.Context, id primitive.ObjectID, status string, errorMsg string) error {
+	set := bson.M{
+		"status":     status,
+		"error":      errorMsg,
+		"updated_at": time.Now(),
+	}
+	if status == NOTIFICATION_SENT {
+		set["sent_at"] = time.Now()
+	}
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": set})
+	return err
+}
+
+// FindLastSent returns the last notification of the condition that was sent
+// or waits for a digest.
+func (r *MongoNotificationRepository) FindLastSent(ctx context.Context, conditionID primitive.ObjectID) (Notification, error) {
+	var notification Notification
+	err := r.collection.FindOne(ctx, bson.M{
+		"condition_id": conditionID,
+		"status":       bson.M{"$in": []string{NOTIFICATION_SENT, NOTIFICATION_DIGEST}},
+	}, options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}})).Decode(&notification)
+	if err != nil {
+		return Notification{}, err
+	}
+	return notification, nil
+}
+
+// FindDigestUsers returns the users with notifications waiting for a digest.
+func (r *MongoNotificationRepository) FindDigestUsers(ctx context.Context) ([]primitive.ObjectID, error) {
+	values, err := r.collection.Distinct(ctx, "user_id", bson.M{"status": NOTIFICATION_DIGEST})
+	if err != nil {
+		return nil, err
+	}
+	userIDs := []primitive.ObjectID{}
+	for _, value := range values {
+		if userID, ok := value.(primitive.ObjectID); ok {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	return userIDs, nil
+}
+
+// FindDigestByUser returns the oldest notifications waiting for the digest
+// of the user.
+func (r *MongoNotificationRepository) FindDigestByUser(ctx context.Context, userID primitive.ObjectID, limit int64) ([]Notification, error) {
+	notifications := []Notification{}
+	cursor, err := r.collection.Find(ctx, bson.M{"status": NOTIFICATION_DIGEST, "user_id": userID}, options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}}).
+		SetLimit(limit),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &notifications); err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+// RetryDigest keeps the notifications for the next digest with the error of
+// the send, they fail once MAX_NOTIFICATION_ATTEMPTS were made.
+func (r *MongoNotificationRepository) RetryDigest(ctx context.Context, ids []primitive.ObjectID, errorMsg string) error {
+	_, err := r.collection.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": ids}}, mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"attempts": bson.M{"$add": bson.A{"$attempts", 1}},
+		"status": bson.M{"$cond": bson.A{
+			bson.M{"$gte": bson.A{"$attempts", MAX_NOTIFICATION_ATTEMPTS}},
+			NOTIFICATION_FAILED,
+			NOTIFICATION_DIGEST,
+		}},
+		"error":      bson.M{"$literal": errorMsg},
+		"updated_at": time.Now(),
+	}}}})
+	return err
+}
+
+func (r *MongoNotificationRepository) UpdateStatusMany(ctx context.Context, ids []primitive.ObjectID, status string, errorMsg string) error {
+	set := bson.M{
+		"status":     status,
+		"error":      errorMsg,
+		"updated_at": time.Now(),
+	}
+	if status == NOTIFICATION_SENT {
+		set["sent_at"] = time.Now()
+	}
+	_, err := r.collection.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": ids}}, bson.M{"$set": set})
+	return err
+}
+
+// Reclaim takes the notification of the same price event on the same channel
+// back to send it again, when sending it failed or when it was left pending
+// since before staleBefore, e.g. by a worker that died. It returns
+// mongo.ErrNoDocuments when it was sent, is being sent, waits for a digest or
+// used all its attempts.
+func (r *MongoNotificationRepository) Reclaim(ctx context.Context, notification Notification, staleBefore time.Time) (Notification, error) {
+	var reclaimed Notification
+	err := r.collection.FindOneAndUpdate(ctx, bson.M{
+		"condition_id": notification.ConditionID,
+		"price_id":     notification.PriceID,
+		"channel":      notification.Channel,
+		// the notifications of before the attempts have none
+		"attempts": bson.M{"$not": bson.M{"$gte": MAX_NOTIFICATION_ATTEMPTS}},
+		"$or": []bson.M{
+			{"status": NOTIFICATION_FAILED},
+			{"status": NOTIFICATION_PENDING, "updated_at": bson.M{"$lt": staleBefore}},
+		},
+	}, bson.M{
+		"$set": bson.M{"status": NOTIFICATION_PENDING, "updated_at": time.Now()},
+		"$inc": bson.M{"attempts": 1},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&reclaimed)
+	if err != nil {
+		return Notification{}, err
+	}
+	return reclaimed, nil
+}
+
+// FindPageByUserID returns a page of the notifications of a user, newest
+// first.
+func (r *MongoNotificationRepository) FindPageByUserID(ctx context.Context, userID primitive.ObjectID, limit int64, page int64) (DataWithPagination[Notification], error) {
+	filter := bson.M{"user_id": userID}
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return DataWithPagination[Notification]{}, err
+	}
+	notifications := []Notification{}
+	cursor, err := r.collection.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip((page-1)*limit).
+		SetLimit(limit),
+	)
+	if err != nil {
+		return DataWithPagination[Notification]{}, err
+	}
+	if err = cursor.All(ctx, &notifications); err != nil {
+		return DataWithPagination[Notification]{}, err
+	}
+	return DataWithPagination[Notification]{
+		Data:        notifications,
+		TotalItems:  int(total),
+		TotalPages:  int((total + limit - 1) / limit),
+		CurrentPage: int(page),
+		Limit:       int(limit),
+	}, nil
+}
+
+type MemoryNotificationRepository struct {
+	notifications memoryCollection[Notification]
+}
+
+func NewMemoryNotificationRepository() *MemoryNotificationRepository {
+	return &MemoryNotificationRepository{}
+}
+
+func (r *MemoryNotificationRepository) Insert(ctx context.Context, notification Notification) (Notification, error) {
+	r.notifications.mu.Lock()
+	defer r.notifications.mu.Unlock()
+	if r.notifications.find(func(n Notification) bool {
+		return n.ConditionID == notification.ConditionID && n.PriceID == notification.PriceID && n.Channel == notification.Channel
+	}) >= 0 {
+		return Notification{}, ErrDuplicate
+	}
+	now := time.Now()
+	if notification.Status != NOTIFICATION_DIGEST {
+		notification.Status = NOTIFICATION_PENDING
+	}
+	notification.ID = primitive.NewObjectID()
+	notification.Attempts = 1
+	notification.Error = ""
+	notification.SentAt = time.Time{}
+	notification.CreatedAt = now
+	notification.UpdatedAt = now
+	r.notifications.docs = append(r.notifications.docs, notification)
+	return notification, nil
+}
+
+func (r *MemoryNotificationRepository) UpdateStatus(ctx context.Context, id primitive.ObjectID, status string, errorMsg string) error {
+	return r.UpdateStatusMany(ctx, []primitive.ObjectID{id}, status, errorMsg)
+}
+
+func (r *MemoryNotificationRepository) FindLastSent(ctx context.Context, conditionID primitive.ObjectID) (Notification, error) {
+	r.notifications.mu.Lock()
+	defer r.notifications.mu.Unlock()
+	found := Notification{}
+	for _, notification := range r.notifications.docs {
+		if notification.ConditionID == conditionID &&
+			(notification.Status == NOTIFICATION_SENT || notification.Status == NOTIFICATION_DIGEST) &&
+			(found.ID.IsZero() || !notification.CreatedAt.Before(found.CreatedAt)) {
+			found = notification
+		}
+	}
+	if found.ID.IsZero() {
+		return Notification{}, ErrNotFound
+	}
+	return found, nil
+}
+
+func (r *MemoryNotificationRepository) FindDigestUsers(ctx context.Context) ([]primitive.ObjectID, error) {
+	r.notifications.mu.Lock()
+	defer r.notifications.mu.Unlock()
+	userIDs := []primitive.ObjectID{}
+	for _, notification := range r.notifications.docs {
+		if notification.Status == NOTIFICATION_DIGEST && !containsID(userIDs, notification.UserID) {
+			userIDs = append(userIDs, notification.UserID)
+		}
+	}
+	return userIDs, nil
+}
+
+func (r *MemoryNotificationRepository) FindDigestByUser(ctx context.Context, userID primitive.ObjectID, limit int64) ([]Notification, error) {
+	r.notifications.mu.Lock()
+	notifications := r.notifications.filter(func(n Notification) bool {
+		return n.Status == NOTIFICATION_DIGEST && n.UserID == userID
+	})
+	r.notifications.mu.Unlock()
+	sort.SliceStable(notifications, func(i, j int) bool {
+		return notifications[i].CreatedAt.Before(notifications[j].CreatedAt)
+	})
+	return notifications[:min(int64(len(notifications)), limit)], nil
+}
+
+func (r *MemoryNotificationRepository) RetryDigest(ctx context.Context, ids []primitive.ObjectID, errorMsg string) error {
+	r.notifications.mu.Lock()
+	defer r.notifications.mu.Unlock()
+	for i := range r.notifications.docs {
+		notification := &r.notifications.docs[i]
+		if !containsID(ids, notification.ID) {
+			continue
+		}
+		notification.Status = NOTIFICATION_DIGEST
+		if notification.Attempts >= MAX_NOTIFICATION_ATTEMPTS {
+			notification.Status = NOTIFICATION_FAILED
+		}
+		notification.Attempts++
+		notification.Error = errorMsg
+		notification.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+func (r *MemoryNotificationRepository) UpdateStatusMany(ctx context.Context, ids []primitive.ObjectID, status string, errorMsg string) error {
+	r.notifications.mu.Lock()
+	defer r.notifications.mu.Unlock()
+	now := time.Now()
+	for i := range r.notifications.docs {
+		notification := &r.notifications.docs[i]
+		if !containsID(ids, notification.ID) {
+			continue
+		}
+		notification.Status = status
+		notification.Error = errorMsg
+		notification.UpdatedAt = now
+		if status == NOTIFICATION_SENT {
+			notification.SentAt = now
+		}
+	}
+	return nil
+}
+
+func (r *MemoryNotificationRepository) Reclaim(ctx context.Context, notification Notification, staleBefore time.Time) (Notification, error) {
+	r.notifications.mu.Lock()
+	defer r.notifications.mu.Unlock()
+	i := r.notifications.find(func(n Notification) bool {
+		return n.ConditionID == notification.ConditionID && n.PriceID == notification.PriceID && n.Channel == notification.Channel &&
+			n.Attempts < MAX_NOTIFICATION_ATTEMPTS &&
+			(n.Status == NOTIFICATION_FAILED || (n.Status == NOTIFICATION_PENDING && n.UpdatedAt.Before(staleBefore)))
+	})
+	if i < 0 {
+		return Notification{}, ErrNotFound
+	}
+	reclaimed := &r.notifications.docs[i]
+	reclaimed.Status = NOTIFICATION_PENDING
+	reclaimed.UpdatedAt = time.Now()
+	reclaimed.Attempts++
+	return *reclaimed, nil
+}
+
+func (r *MemoryNotificationRepository) FindPageByUserID(ctx context.Context, userID primitive.ObjectID, limit int64, page int64) (DataWithPagination[Notification], error) {
+	r.notifications.mu.Lock()
+	notifications := r.notifications.filter(func(n Notification) bool { return n.UserID == userID })
+	r.notifications.mu.Unlock()
+	sort.SliceStable(notifications, func(i, j int) bool {
+		a, b := notifications[i], notifications[j]
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.ID.Hex() > b.ID.Hex()
+	})
+	return paginate(notifications, limit, page), nil
+}
+
+type NotificationService struct {
+	repo NotificationRepository
+}
+
+func NewNotificationService(repo NotificationRepository) *NotificationService {
+	return &NotificationService{repo}
+}
+
+func (s *NotificationService) Insert(ctx context.Context, notification Notification) (Notification, error) {
+	return s.repo.Insert(ctx, notification)
+}
+
+func (s *NotificationService) UpdateStatus(ctx context.Context, id primitive.ObjectID, status string, errorMsg string) error {
+	return s.repo.UpdateStatus(ctx, id, status, errorMsg)
+}
+
+func (s *NotificationService) FindLastSent(ctx context.Context, conditionID primitive.ObjectID) (Notification, error) {
+	return s.repo.FindLastSent(ctx, conditionID)
+}
+
+func (s *NotificationService) FindDigestUsers(ctx context.Context) ([]primitive.ObjectID, error) {
+	return s.repo.FindDigestUsers(ctx)
+}
+
+func (s *NotificationService) FindDigestByUser(ctx context.Context, userID primitive.ObjectID, limit int64) ([]Notification, error) {
+	return s.repo.FindDigestByUser(ctx, userID, limit)
+}
+
+func (s *NotificationService) RetryDigest(ctx context.Context, ids []primitive.ObjectID, errorMsg string) error {
+	return s.repo.RetryDigest(ctx, ids, errorMsg)
+}
+
+func (s *NotificationService) UpdateStatusMany(ctx context.Context, ids []primitive.ObjectID, status string, errorMsg string) error {
+	return s.repo.UpdateStatusMany(ctx, ids, status, errorMsg)
+}
+
+func (s *NotificationService) Reclaim(ctx context.Context, notification Notification, staleBefore time.Time) (Notification, error) {
+	return s.repo.Reclaim(ctx, notification, staleBefore)
+}
+
+func (s *NotificationService) FindPageByUserID(ctx context.Context, userID primitive.ObjectID, limit int64, page int64) (DataWithPagination[Notification], error) {
+	return s.repo.FindPageByUserID(ctx, userID, limit, page)
+}
+
+// InCooldown tells whether the condition sent a notification, or queued one
+// for a digest, less than cooldown ago.
+func (s *NotificationService) InCooldown(ctx context.Context, conditionID primitive.ObjectID, cooldown time.Duration) (bool, error) {
+	last, err := s.repo.FindLastSent(ctx, conditionID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return time.Since(last.CreatedAt) < cooldown, nil
+}
@@ -2,14 +2,42 @@ package database
 
 import (
 	"context"
+	"errors"
+	"sort"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-const PriceCollectionName = "prices"
+const (
+	PriceCollectionName = "prices"
+	RESOLUTION_RAW      = "raw"
+	RESOLUTION_HOUR     = "hour"
+	RESOLUTION_DAY      = "day"
+	// MAX_PRICE_BUCKETS bounds the hours or days a rollup may span.
+	MAX_PRICE_BUCKETS = 5000
+)
+
+// ErrTooManyBuckets is returned by Rollup when the range holds more than
+// MAX_PRICE_BUCKETS hours or days.
+var ErrTooManyBuckets = errors.New("too many price buckets")
+
+// PriceBucket sums up the prices of a product in one hour or day, the price
+// carried over from before the bucket included. At the raw resolution a
+// bucket is a single point.
+type PriceBucket struct {
+	Start time.Time `json:"start" bson:"_id"`
+	Min   int64     `json:"min" bson:"min"`
+	Max   int64     `json:"max" bson:"max"`
+	Avg   float64   `json:"avg" bson:"avg"`
+	Last  int64     `json:"last" bson:"last"`
+	Stock int32     `json:"stock" bson:"stock"`
+	Sold  int32     `json:"sold" bson:"sold"`
+	Count int       `json:"count" bson:"count"`
+}
 
 type Price struct {
 	ID                     primitive.ObjectID `json:"_id" bson:"_id"`
@@ -31,11 +59,45 @@ type Price struct {
 	UpdatedAt              time.Time          `bson:"updated_at,omitempty"`
 }
 
+// Changed tells whether a tracked field differs between two price points.
+// Sold and liked counts move all the time and do not make a new point.
+func (p Price) Changed(other Price) bool {
+	return p.Price != other.Price ||
+		p.PriceMin != other.PriceMin ||
+		p.PriceMax != other.PriceMax ||
+		p.PriceBeforeDiscount != other.PriceBeforeDiscount ||
+		p.RawDiscount != other.RawDiscount ||
+		(p.Stock > 0) != (other.Stock > 0)
+}
+
+// The prices collection is a time series of every price point of a product,
+// a new point is only written when a tracked field changed.
 type PriceRepository interface {
 	Insert(ctx context.Context, price Price) (Price, error)
-	Update(ctx context.Context, id string, price Price) (Price, error)
 	FindByProductID(ctx context.Context, productID primitive.ObjectID) ([]Price, error)
-	FindOneByFilter(ctx context.Context, filter bson.M) (Price, error)
+	FindLatest(ctx context.Context, productID primitive.ObjectID) (Price, error)
+	FindRecent(ctx context.Context, productID primitive.ObjectID, limit int64) ([]Price, error)
+	FindAt(ctx context.Context, productID primitive.ObjectID, at time.Time) (Price, error)
+	FindLowest(ctx context.Context, productID primitive.ObjectID) (Price, error)
+	FindRange(ctx context.Context, productID primitive.ObjectID, from time.Time, to time.Time) ([]Price, error)
+	Rollup(ctx context.Context, query PriceRollupQuery, limit int64, page int64) (DataWithPagination[PriceBucket], error)
+	// the ByProducts lookups answer for many products at once, keyed by
+	// product, a product without a point is left out
+	FindRecentByProducts(ctx context.Context, productIDs []primitive.ObjectID, limit int64) (map[primitive.ObjectID][]Price, error)
+	FindAtByProducts(ctx context.Context, at map[primitive.ObjectID]time.Time) (map[primitive.ObjectID]Price, error)
+	FindLowestByProducts(ctx context.Context, productIDs []primitive.ObjectID) (map[primitive.ObjectID]Price, error)
+}
+
+// PriceRollupQuery selects the prices a rollup is made of: the points of the
+// product from Start, to To excluded, and Carried, the price in effect at
+// Start when it was set before it. Start is the start of an hour or a day in
+// DEFAULT_TIMEZONE, To is not after now.
+type PriceRollupQuery struct {
+	ProductID  primitive.ObjectID
+	Carried    *Price
+	Start      time.Time
+	To         time.Time
+	Resolution string
 }
 
 type MongoPriceRepository struct {
@@ -47,9 +109,12 @@ func NewMongoPriceRepository(collection *mongo.Collection) *MongoPriceRepository
 }
 
 func (r *MongoPriceRepository) Insert(ctx context.Context, price Price) (Price, error) {
+	if price.CreatedAt.IsZero() {
+		price.CreatedAt = time.Now()
+	}
 	_, err := r.collection.InsertOne(ctx, bson.M{
 		"product": bson.D{
-			{Key: "$ref", Value: UserCollectionName},
+			{Key: "$ref", Value: ProductCollectionName},
 			{Key: "$id", Value: price.ProductID},
 		},
 		"stock":                     price.Stock,
@@ -64,8 +129,7 @@ func (r *MongoPriceRepository) Insert(ctx context.Context, price Price) (Price,
 		"price_max_before_discount": price.PriceMaxBeforeDiscount,
 		"price_before_discount":     price.PriceBeforeDiscount,
 		"raw_discount":              price.RawDiscount,
-		"created_at":                time.Now(),
-		"updated_at":                time.Now(),
+		"created_at":                price.CreatedAt,
 	})
 	if err != nil {
 		return Price{}, err
@@ -73,39 +137,38 @@ func (r *MongoPriceRepository) Insert(ctx context.Context, price Price) (Price,
 	return price, nil
 }
 
-func (r *MongoPriceRepository) Update(ctx context.Context, id string, price Price) (Price, error) {
-	idPrimitive, err := primitive.ObjectIDFromHex(id)
+func (r *MongoPriceRepository) FindByProductID(ctx context.Context, productID primitive.ObjectID) ([]Price, error) {
+	var prices []Price
+	cursor, err := r.collection.Find(ctx, bson.M{"product.$id": productID}, options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	)
 	if err != nil {
-		return Price{}, err
+		return nil, err
 	}
-	_, err = r.collection.UpdateOne(ctx, bson.M{
-		"_id": idPrimitive,
-	}, bson.M{
-		"$set": bson.M{
-			"stock":                     price.Stock,
-			"sold":                      price.Sold,
-			"historical_sold":           price.HistoricalSold,
-			"liked_count":               price.LikedCount,
-			"cmt_count":                 price.CmtCount,
-			"price":                     price.Price,
-			"price_min":                 price.PriceMin,
-			"price_max":                 price.PriceMax,
-			"price_min_before_discount": price.PriceMinBeforeDiscount,
-			"price_max_before_discount": price.PriceMaxBeforeDiscount,
-			"price_before_discount":     price.PriceBeforeDiscount,
-			"raw_discount":              price.RawDiscount,
-			"updated_at":                time.Now(),
-		},
-	})
+	if err = cursor.All(ctx, &prices); err != nil {
+		return nil, err
+	}
+	return prices, nil
+}
+
+func (r *MongoPriceRepository) FindLatest(ctx context.Context, productID primitive.ObjectID) (Price, error) {
+	var price Price
+	err := r.collection.FindOne(ctx, bson.M{"product.$id": productID}, options.FindOne().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	).Decode(&price)
 	if err != nil {
 		return Price{}, err
 	}
 	return price, nil
 }
 
-func (r *MongoPriceRepository) FindByProductID(ctx context.Context, productID primitive.ObjectID) ([]Price, error) {
-	var prices []Price
-	cursor, err := r.collection.Find(ctx, bson.M{"product.$id": productID})
+// FindRecent returns the latest points of a product, newest first.
+func (r *MongoPriceRepository) FindRecent(ctx context.Context, productID primitive.ObjectID, limit int64) ([]Price, error) {
+	prices := []Price{}
+	cursor, err := r.collection.Find(ctx, bson.M{"product.$id": productID}, options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetLimit(limit),
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -115,15 +178,562 @@ func (r *MongoPriceRepository) FindByProductID(ctx context.Context, productID pr
 	return prices, nil
 }
 
-func (r *MongoPriceRepository) FindOneByFilter(ctx context.Context, filter bson.M) (Price, error) {
+// FindAt returns the price of a product at the given time, the first point
+// after it when the product had none yet.
+func (r *MongoPriceRepository) FindAt(ctx context.Context, productID primitive.ObjectID, at time.Time) (Price, error) {
+	var price Price
+	err := r.collection.FindOne(ctx, bson.M{
+		"product.$id": productID,
+		"created_at":  bson.M{"$lte": at},
+	}, options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}})).Decode(&price)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		err = r.collection.FindOne(ctx, bson.M{
+			"product.$id": productID,
+		}, options.FindOne().SetSort(bson.D{{Key: "created_at", Value: 1}})).Decode(&price)
+	}
+	if err != nil {
+		return Price{}, err
+	}
+	return price, nil
+}
+
+// FindLowest returns the point with the all-time low price of a product.
+func (r *MongoPriceRepository) FindLowest(ctx context.Context, productID primitive.ObjectID) (Price, error) {
 	var price Price
-	err := r.collection.FindOne(ctx, filter).Decode(&price)
+	err := r.collection.FindOne(ctx, bson.M{
+		"product.$id": productID,
+		"price":       bson.M{"$gt": 0},
+	}, options.FindOne().SetSort(bson.D{{Key: "price", Value: 1}, {Key: "created_at", Value: -1}})).Decode(&price)
 	if err != nil {
 		return Price{}, err
 	}
 	return price, nil
 }
 
+// FindRange returns the points of a product from from, to excluded, oldest first.
+func (r *MongoPriceRepository) FindRange(ctx context.Context, productID primitive.ObjectID, from time.Time, to time.Time) ([]Price, error) {
+	prices := []Price{}
+	cursor, err := r.collection.Find(ctx, bson.M{
+		"product.$id": productID,
+		"created_at":  bson.M{"$gte": from, "$lt": to},
+	}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &prices); err != nil {
+		return nil, err
+	}
+	return prices, nil
+}
+
+// topByProduct groups the points matching match by product and keeps the
+// first n of each in the order of sortBy.
+func (r *MongoPriceRepository) topByProduct(ctx context.Context, match bson.M, sortBy bson.D, n int64) (map[primitive.ObjectID][]Price, error) {
+	cursor, err := r.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{
+			"_id":    "$product",
+			"prices": bson.M{"$topN": bson.M{"n": n, "sortBy": sortBy, "output": "$$ROOT"}},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var results []struct {
+		Product bson.D  `bson:"_id"`
+		Prices  []Price `bson:"prices"`
+	}
+	if err = cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	prices := map[primitive.ObjectID][]Price{}
+	for _, result := range results {
+		prices[refID(result.Product)] = result.Prices
+	}
+	return prices, nil
+}
+
+// firstByProduct is topByProduct keeping a single point.
+func (r *MongoPriceRepository) firstByProduct(ctx context.Context, match bson.M, sortBy bson.D) (map[primitive.ObjectID]Price, error) {
+	tops, err := r.topByProduct(ctx, match, sortBy, 1)
+	if err != nil {
+		return nil, err
+	}
+	prices := map[primitive.ObjectID]Price{}
+	for productID, top := range tops {
+		if len(top) > 0 {
+			prices[productID] = top[0]
+		}
+	}
+	return prices, nil
+}
+
+// FindRecentByProducts returns the latest points of each product, newest
+// first.
+func (r *MongoPriceRepository) FindRecentByProducts(ctx context.Context, productIDs []primitive.ObjectID, limit int64) (map[primitive.ObjectID][]Price, error) {
+	return r.topByProduct(ctx, bson.M{"product.$id": bson.M{"$in": productIDs}}, bson.D{{Key: "created_at", Value: -1}}, limit)
+}
+
+// FindAtByProducts is FindAt for every product of at.
+func (r *MongoPriceRepository) FindAtByProducts(ctx context.Context, at map[primitive.ObjectID]time.Time) (map[primitive.ObjectID]Price, error) {
+	if len(at) == 0 {
+		return map[primitive.ObjectID]Price{}, nil
+	}
+	before := bson.A{}
+	for productID, when := range at {
+		before = append(before, bson.M{"product.$id": productID, "created_at": bson.M{"$lte": when}})
+	}
+	prices, err := r.firstByProduct(ctx, bson.M{"$or": before}, bson.D{{Key: "created_at", Value: -1}})
+	if err != nil {
+		return nil, err
+	}
+	// the products that had no point yet take their first one
+	later := []primitive.ObjectID{}
+	for productID := range at {
+		if _, ok := prices[productID]; !ok {
+			later = append(later, productID)
+		}
+	}
+	if len(later) == 0 {
+		return prices, nil
+	}
+	firsts, err := r.firstByProduct(ctx, bson.M{"product.$id": bson.M{"$in": later}}, bson.D{{Key: "created_at", Value: 1}})
+	if err != nil {
+		return nil, err
+	}
+	for productID, price := range firsts {
+		prices[productID] = price
+	}
+	return prices, nil
+}
+
+// FindLowestByProducts is FindLowest for every product.
+func (r *MongoPriceRepository) FindLowestByProducts(ctx context.Context, productIDs []primitive.ObjectID) (map[primitive.ObjectID]Price, error) {
+	return r.firstByProduct(ctx, bson.M{
+		"product.$id": bson.M{"$in": productIDs},
+		"price":       bson.M{"$gt": 0},
+	}, bson.D{{Key: "price", Value: 1}, {Key: "created_at", Value: -1}})
+}
+
+// Rollup returns a page of the buckets of the query. The hours and days are
+// grouped by the aggregation on the product.$id and created_at index, the
+// carried price is matched with them so it starts the first bucket. Every
+// bucket starts with the last price of the bucket before it and a bucket
+// without a point keeps it, the average is weighted by how long each price
+// lasted.
+func (r *MongoPriceRepository) Rollup(ctx context.Context, query PriceRollupQuery, limit int64, page int64) (DataWithPagination[PriceBucket], error) {
+	if query.Resolution == RESOLUTION_RAW {
+		return r.rollupRaw(ctx, query, limit, page)
+	}
+	from := query.Start
+	if query.Carried != nil {
+		from = query.Carried.CreatedAt
+	}
+	unit := query.Resolution
+	// how long from from to to lasted, in seconds
+	seconds := func(from any, to any) bson.M {
+		return bson.M{"$divide": bson.A{bson.M{"$subtract": bson.A{to, from}}, 1000}}
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"product.$id": query.ProductID,
+			"created_at":  bson.M{"$gte": from, "$lt": query.To},
+		}}},
+		// a price lasts until the next point
+		{{Key: "$setWindowFields", Value: bson.M{
+			"sortBy": bson.M{"created_at": 1},
+			"output": bson.M{"next": bson.M{"$shift": bson.M{"output": "$created_at", "by": 1}}},
+		}}},
+		// the carried price counts from the start of the first bucket
+		{{Key: "$set", Value: bson.M{"at": bson.M{"$max": bson.A{"$created_at", query.Start}}}}},
+		{{Key: "$set", Value: bson.M{"bucket": bson.M{"$dateTrunc": bson.M{
+			"date":     "$at",
+			"unit":     unit,
+			"timezone": DEFAULT_TIMEZONE,
+		}}}}},
+		{{Key: "$set", Value: bson.M{"until": bson.M{"$min": bson.A{
+			"$next",
+			query.To,
+			bson.M{"$dateAdd": bson.M{"startDate": "$bucket", "unit": unit, "amount": 1, "timezone": DEFAULT_TIMEZONE}},
+		}}}}},
+		{{Key: "$sort", Value: bson.M{"created_at": 1}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":      "$bucket",
+			"min":      bson.M{"$min": "$price"},
+			"max":      bson.M{"$max": "$price"},
+			"last":     bson.M{"$last": "$price"},
+			"stock":    bson.M{"$last": "$stock"},
+			"sold":     bson.M{"$last": "$sold"},
+			"first_at": bson.M{"$min": "$at"},
+			"weighted": bson.M{"$sum": bson.M{"$multiply": bson.A{"$price", seconds("$at", "$until")}}},
+			"count": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$gte": bson.A{"$created_at", query.Start}}, 1, 0,
+			}}},
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"_id": 0, "start": "$_id", "min": 1, "max": 1, "last": 1, "stock": 1, "sold": 1,
+			"first_at": 1, "weighted": 1, "count": 1,
+		}}},
+		// the hours or days without a point keep the last price
+		{{Key: "$densify", Value: bson.M{
+			"field": "start",
+			"range": bson.M{"step": 1, "unit": unit, "bounds": bson.A{query.Start, query.To}},
+		}}},
+		{{Key: "$fill", Value: bson.M{
+			"sortBy": bson.M{"start": 1},
+			"output": bson.M{
+				"last":  bson.M{"method": "locf"},
+				"stock": bson.M{"method": "locf"},
+				"sold":  bson.M{"method": "locf"},
+			},
+		}}},
+		{{Key: "$setWindowFields", Value: bson.M{
+			"sortBy": bson.M{"start": 1},
+			"output": bson.M{"previous": bson.M{"$shift": bson.M{"output": "$last", "by": -1}}},
+		}}},
+		// the buckets before the first known price are left out
+		{{Key: "$match", Value: bson.M{"last": bson.M{"$ne": nil}}}},
+		{{Key: "$set", Value: bson.M{"end": bson.M{"$min": bson.A{
+			query.To,
+			bson.M{"$dateAdd": bson.M{"startDate": "$start", "unit": unit, "amount": 1, "timezone": DEFAULT_TIMEZONE}},
+		}}}}},
+		{{Key: "$set", Value: bson.M{
+			// the previous price lasts until the first point of the bucket
+			"weighted": bson.M{"$add": bson.A{
+				bson.M{"$ifNull": bson.A{"$weighted", 0}},
+				bson.M{"$multiply": bson.A{
+					bson.M{"$ifNull": bson.A{"$previous", 0}},
+					seconds("$start", bson.M{"$ifNull": bson.A{"$first_at", "$end"}}),
+				}},
+			}},
+			// without a previous price the bucket starts at its first point
+			"duration": seconds(bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$previous", nil}}, "$first_at", "$start"}}, "$end"),
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"_id":   "$start",
+			"min":   bson.M{"$min": bson.A{"$min", "$previous"}},
+			"max":   bson.M{"$max": bson.A{"$max", "$previous"}},
+			"avg":   bson.M{"$cond": bson.A{bson.M{"$gt": bson.A{"$duration", 0}}, bson.M{"$divide": bson.A{"$weighted", "$duration"}}, "$last"}},
+			"last":  1,
+			"stock": 1,
+			"sold":  1,
+			"count": bson.M{"$ifNull": bson.A{"$count", 0}},
+		}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+		{{Key: "$facet", Value: bson.M{
+			"data":  bson.A{bson.M{"$skip": (page - 1) * limit}, bson.M{"$limit": limit}},
+			"total": bson.A{bson.M{"$count": "count"}},
+		}}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return DataWithPagination[PriceBucket]{}, err
+	}
+	var result []struct {
+		Data  []PriceBucket `bson:"data"`
+		Total []struct {
+			Count int64 `bson:"count"`
+		} `bson:"total"`
+	}
+	if err = cursor.All(ctx, &result); err != nil {
+		return DataWithPagination[PriceBucket]{}, err
+	}
+	buckets := []PriceBucket{}
+	var total int64
+	if len(result) > 0 {
+		if result[0].Data != nil {
+			buckets = result[0].Data
+		}
+		if len(result[0].Total) > 0 {
+			total = result[0].Total[0].Count
+		}
+	}
+	return DataWithPagination[PriceBucket]{
+		Data:        buckets,
+		TotalItems:  int(total),
+		TotalPages:  int((total + limit - 1) / limit),
+		CurrentPage: int(page),
+		Limit:       int(limit),
+	}, nil
+}
+
+// rollupRaw pages the points on the index, the carried price is the first
+// item.
+func (r *MongoPriceRepository) rollupRaw(ctx context.Context, query PriceRollupQuery, limit int64, page int64) (DataWithPagination[PriceBucket], error) {
+	filter := bson.M{
+		"product.$id": query.ProductID,
+		"created_at":  bson.M{"$gte": query.Start, "$lt": query.To},
+	}
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return DataWithPagination[PriceBucket]{}, err
+	}
+	buckets := []PriceBucket{}
+	skip := (page - 1) * limit
+	if query.Carried != nil {
+		total++
+		if skip == 0 {
+			buckets = append(buckets, rawBucket(query.Start, *query.Carried, 0))
+		} else {
+			skip--
+		}
+	}
+	if fetch := limit - int64(len(buckets)); fetch > 0 {
+		prices := []Price{}
+		cursor, err := r.collection.Find(ctx, filter, options.Find().
+			SetSort(bson.D{{Key: "created_at", Value: 1}}).
+			SetSkip(skip).
+			SetLimit(fetch),
+		)
+		if err != nil {
+			return DataWithPagination[PriceBucket]{}, err
+		}
+		if err = cursor.All(ctx, &prices); err != nil {
+			return DataWithPagination[PriceBucket]{}, err
+		}
+		for _, price := range prices {
+			buckets = append(buckets, rawBucket(price.CreatedAt, price, 1))
+		}
+	}
+	return DataWithPagination[PriceBucket]{
+		Data:        buckets,
+		TotalItems:  int(total),
+		TotalPages:  int((total + limit - 1) / limit),
+		CurrentPage: int(page),
+		Limit:       int(limit),
+	}, nil
+}
+
+type MemoryPriceRepository struct {
+	prices memoryCollection[Price]
+}
+
+func NewMemoryPriceRepository() *MemoryPriceRepository {
+	return &MemoryPriceRepository{}
+}
+
+func (r *MemoryPriceRepository) Insert(ctx context.Context, price Price) (Price, error) {
+	if price.CreatedAt.IsZero() {
+		price.CreatedAt = time.Now()
+	}
+	stored := price
+	stored.ID = primitive.NewObjectID()
+	stored.Product = dbRef(ProductCollectionName, price.ProductID)
+	stored.ProductID = primitive.NilObjectID
+	stored.UpdatedAt = time.Time{}
+	r.prices.mu.Lock()
+	defer r.prices.mu.Unlock()
+	r.prices.docs = append(r.prices.docs, stored)
+	return price, nil
+}
+
+// oldestFirst returns the points of a product matching match sorted by
+// created_at.
+func (r *MemoryPriceRepository) oldestFirst(productID primitive.ObjectID, match func(Price) bool) []Price {
+	r.prices.mu.Lock()
+	prices := r.prices.filter(func(p Price) bool {
+		return refID(p.Product) == productID && match(p)
+	})
+	r.prices.mu.Unlock()
+	sort.SliceStable(prices, func(i, j int) bool {
+		return prices[i].CreatedAt.Before(prices[j].CreatedAt)
+	})
+	return prices
+}
+
+func (r *MemoryPriceRepository) newestFirst(productID primitive.ObjectID, match func(Price) bool) []Price {
+	prices := r.oldestFirst(productID, match)
+	for i, j := 0, len(prices)-1; i < j; i, j = i+1, j-1 {
+		prices[i], prices[j] = prices[j], prices[i]
+	}
+	return prices
+}
+
+func anyPrice(Price) bool { return true }
+
+func (r *MemoryPriceRepository) FindByProductID(ctx context.Context, productID primitive.ObjectID) ([]Price, error) {
+	return r.newestFirst(productID, anyPrice), nil
+}
+
+func (r *MemoryPriceRepository) FindLatest(ctx context.Context, productID primitive.ObjectID) (Price, error) {
+	return first(r.newestFirst(productID, anyPrice))
+}
+
+func (r *MemoryPriceRepository) FindRecent(ctx context.Context, productID primitive.ObjectID, limit int64) ([]Price, error) {
+	prices := r.newestFirst(productID, anyPrice)
+	return prices[:min(int64(len(prices)), limit)], nil
+}
+
+func (r *MemoryPriceRepository) FindAt(ctx context.Context, productID primitive.ObjectID, at time.Time) (Price, error) {
+	price, err := first(r.newestFirst(productID, func(p Price) bool { return !p.CreatedAt.After(at) }))
+	if errors.Is(err, ErrNotFound) {
+		price, err = first(r.oldestFirst(productID, anyPrice))
+	}
+	return price, err
+}
+
+func (r *MemoryPriceRepository) FindLowest(ctx context.Context, productID primitive.ObjectID) (Price, error) {
+	prices := r.newestFirst(productID, func(p Price) bool { return p.Price > 0 })
+	sort.SliceStable(prices, func(i, j int) bool { return prices[i].Price < prices[j].Price })
+	return first(prices)
+}
+
+func (r *MemoryPriceRepository) FindRange(ctx context.Context, productID primitive.ObjectID, from time.Time, to time.Time) ([]Price, error) {
+	return r.oldestFirst(productID, func(p Price) bool {
+		return !p.CreatedAt.Before(from) && p.CreatedAt.Before(to)
+	}), nil
+}
+
+func (r *MemoryPriceRepository) FindRecentByProducts(ctx context.Context, productIDs []primitive.ObjectID, limit int64) (map[primitive.ObjectID][]Price, error) {
+	prices := map[primitive.ObjectID][]Price{}
+	for _, productID := range productIDs {
+		if recent, _ := r.FindRecent(ctx, productID, limit); len(recent) > 0 {
+			prices[productID] = recent
+		}
+	}
+	return prices, nil
+}
+
+func (r *MemoryPriceRepository) FindAtByProducts(ctx context.Context, at map[primitive.ObjectID]time.Time) (map[primitive.ObjectID]Price, error) {
+	prices := map[primitive.ObjectID]Price{}
+	for productID, when := range at {
+		if price, err := r.FindAt(ctx, productID, when); err == nil {
+			prices[productID] = price
+		}
+	}
+	return prices, nil
+}
+
+func (r *MemoryPriceRepository) FindLowestByProducts(ctx context.Context, productIDs []primitive.ObjectID) (map[primitive.ObjectID]Price, error) {
+	prices := map[primitive.ObjectID]Price{}
+	for _, productID := range productIDs {
+		if price, err := r.FindLowest(ctx, productID); err == nil {
+			prices[productID] = price
+		}
+	}
+	return prices, nil
+}
+
+// Rollup groups the points in memory the way the aggregation does.
+func (r *MemoryPriceRepository) Rollup(ctx context.Context, query PriceRollupQuery, limit int64, page int64) (DataWithPagination[PriceBucket], error) {
+	points, _ := r.FindRange(ctx, query.ProductID, query.Start, query.To)
+	return paginate(rollupPrices(query.Carried, points, query.Start, query.To, query.Resolution), limit, page), nil
+}
+
+// bucketStart is the start of the hour or the day of at in DEFAULT_TIMEZONE.
+func bucketStart(at time.Time, resolution string) time.Time {
+	at = at.In(loadLocation(DEFAULT_TIMEZONE))
+	switch resolution {
+	case RESOLUTION_HOUR:
+		return time.Date(at.Year(), at.Month(), at.Day(), at.Hour(), 0, 0, 0, at.Location())
+	case RESOLUTION_DAY:
+		return time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, at.Location())
+	}
+	return at
+}
+
+func nextBucket(start time.Time, resolution string) time.Time {
+	if resolution == RESOLUTION_HOUR {
+		return start.Add(time.Hour)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// countBuckets is the number of hours or days from start, to excluded.
+func countBuckets(start time.Time, to time.Time, resolution string) int64 {
+	size := 24 * time.Hour
+	if resolution == RESOLUTION_HOUR {
+		size = time.Hour
+	}
+	return int64((to.Sub(start) + size - 1) / size)
+}
+
+// rollupPrices groups the points from start, to excluded, by resolution.
+// Only the points where the price changed are stored, so every bucket starts
+// with the price carried over from before it, and a bucket without a point
+// keeps that price. The average is weighted by how long each price lasted,
+// until to for the last bucket. The buckets before the first known price are
+// left out.
+func rollupPrices(carried *Price, points []Price, start time.Time, to time.Time, resolution string) []PriceBucket {
+	buckets := []PriceBucket{}
+	if resolution == RESOLUTION_RAW {
+		if carried != nil {
+			buckets = append(buckets, rawBucket(start, *carried, 0))
+		}
+		for _, point := range points {
+			buckets = append(buckets, rawBucket(point.CreatedAt, point, 1))
+		}
+		return buckets
+	}
+
+	// how long a price lasted from from to until, within the bucket
+	lasted := func(from time.Time, until time.Time) float64 {
+		if !from.Before(until) {
+			return 0
+		}
+		return until.Sub(from).Seconds()
+	}
+	i := 0
+	for bucketStart := start; bucketStart.Before(to); {
+		bucketEnd := nextBucket(bucketStart, resolution)
+		if to.Before(bucketEnd) {
+			bucketEnd = to
+		}
+		bucket := PriceBucket{Start: bucketStart}
+		if carried != nil {
+			bucket.Min, bucket.Max = carried.Price, carried.Price
+		}
+		since := bucketStart
+		var weighted, duration float64
+		for ; i < len(points) && points[i].CreatedAt.Before(bucketEnd); i++ {
+			point := points[i]
+			if carried != nil {
+				d := lasted(since, point.CreatedAt)
+				weighted += float64(carried.Price) * d
+				duration += d
+			}
+			if carried == nil || point.Price < bucket.Min {
+				bucket.Min = point.Price
+			}
+			if carried == nil || point.Price > bucket.Max {
+				bucket.Max = point.Price
+			}
+			carried = &point
+			since = point.CreatedAt
+			bucket.Count++
+		}
+		if carried != nil {
+			d := lasted(since, bucketEnd)
+			weighted += float64(carried.Price) * d
+			duration += d
+			bucket.Avg = float64(carried.Price)
+			if duration > 0 {
+				bucket.Avg = weighted / duration
+			}
+			bucket.Last = carried.Price
+			bucket.Stock = carried.Stock
+			bucket.Sold = carried.Sold
+			buckets = append(buckets, bucket)
+		}
+		bucketStart = nextBucket(bucketStart, resolution)
+	}
+	return buckets
+}
+
+func rawBucket(start time.Time, price Price, count int) PriceBucket {
+	return PriceBucket{
+		Start: start,
+		Min:   price.Price,
+		Max:   price.Price,
+		Avg:   float64(price.Price),
+		Last:  price.Price,
+		Stock: price.Stock,
+		Sold:  price.Sold,
+		Count: count,
+	}
+}
+
 type PriceService struct {
 	repo PriceRepository
 }
@@ -136,14 +746,83 @@ func (s *PriceService) Insert(ctx context.Context, price Price) (Price, error) {
 	return s.repo.Insert(ctx, price)
 }
 
-func (s *PriceService) Update(ctx context.Context, id string, price Price) (Price, error) {
-	return s.repo.Update(ctx, id, price)
+// Record writes the price point unless no tracked field changed since the
+// latest point of the product. It returns the latest point before this one,
+// with a zero ID when the product had none, and whether a point was written.
+func (s *PriceService) Record(ctx context.Context, price Price) (Price, bool, error) {
+	latest, err := s.repo.FindLatest(ctx, price.ProductID)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return Price{}, false, err
+	}
+	if err == nil && !price.Changed(latest) {
+		return latest, false, nil
+	}
+	_, err = s.repo.Insert(ctx, price)
+	if err != nil {
+		return latest, false, err
+	}
+	return latest, true, nil
+}
+
+func (s *PriceService) FindLatest(ctx context.Context, productID primitive.ObjectID) (Price, error) {
+	return s.repo.FindLatest(ctx, productID)
+}
+
+// Rollup returns a page of the prices of a product between from and to,
+// grouped by resolution. The hours and days start in DEFAULT_TIMEZONE. The
+// range stops at now, and a range of more than MAX_PRICE_BUCKETS hours or
+// days is rejected with ErrTooManyBuckets before any point is loaded.
+func (s *PriceService) Rollup(ctx context.Context, productID primitive.ObjectID, from time.Time, to time.Time, resolution string, limit int64, page int64) (DataWithPagination[PriceBucket], error) {
+	if now := time.Now(); now.Before(to) {
+		to = now
+	}
+	start := bucketStart(from, resolution)
+	if !start.Before(to) {
+		return paginate([]PriceBucket{}, limit, page), nil
+	}
+	if resolution != RESOLUTION_RAW && countBuckets(start, to, resolution) > MAX_PRICE_BUCKETS {
+		return DataWithPagination[PriceBucket]{}, ErrTooManyBuckets
+	}
+	query := PriceRollupQuery{ProductID: productID, Start: start, To: to, Resolution: resolution}
+	// the price in effect when the first bucket starts
+	at, err := s.repo.FindAt(ctx, productID, start)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return DataWithPagination[PriceBucket]{}, err
+	}
+	if err == nil && at.CreatedAt.Before(start) {
+		query.Carried = &at
+	}
+	return s.repo.Rollup(ctx, query, limit, page)
 }
 
 func (s *PriceService) FindByProductID(ctx context.Context, productID primitive.ObjectID) ([]Price, error) {
 	return s.repo.FindByProductID(ctx, productID)
 }
 
-func (s *PriceService) FindOneByFilter(ctx context.Context, filter bson.M) (Price, error) {
-	return s.repo.FindOneByFilter(ctx, filter)
+func (s *PriceService) FindRecent(ctx context.Context, productID primitive.ObjectID, limit int64) ([]Price, error) {
+	return s.repo.FindRecent(ctx, productID, limit)
+}
+
+func (s *PriceService) FindAt(ctx context.Context, productID primitive.ObjectID, at time.Time) (Price, error) {
+	return s.repo.FindAt(ctx, productID, at)
+}
+
+func (s *PriceService) FindLowest(ctx context.Context, productID primitive.ObjectID) (Price, error) {
+	return s.repo.FindLowest(ctx, productID)
+}
+
+func (s *PriceService) FindRange(ctx context.Context, productID primitive.ObjectID, from time.Time, to time.Time) ([]Price, error) {
+	return s.repo.FindRange(ctx, productID, from, to)
+}
+
+func (s *PriceService) FindRecentByProducts(ctx context.Context, productIDs []primitive.ObjectID, limit int64) (map[primitive.ObjectID][]Price, error) {
+	return s.repo.FindRecentByProducts(ctx, productIDs, limit)
+}
+
+func (s *PriceService) FindAtByProducts(ctx context.Context, at map[primitive.ObjectID]time.Time) (map[primitive.ObjectID]Price, error) {
+	return s.repo.FindAtByProducts(ctx, at)
+}
+
+func (s *PriceService) FindLowestByProducts(ctx context.Context, productIDs []primitive.ObjectID) (map[primitive.ObjectID]Price, error) {
+	return s.repo.FindLowestByProducts(ctx, productIDs)
 }
@@ -0,0 +1,139 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestPriceRollup(t *testing.T) {
+	testPriceRollup(t, NewMemoryPriceRepository())
+}
+
+// TestMongoPriceRollup runs the aggregation on a time series prices
+// collection of the server at MONGO_TEST_URI.
+func TestMongoPriceRollup(t *testing.T) {
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI is not set")
+	}
+	ctx := context.Background()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect(ctx)
+	db := client.Database("stracks_test_" + primitive.NewObjectID().Hex())
+	defer db.Drop(ctx)
+	if err = createPriceCollection(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	testPriceRollup(t, NewMongoPriceRepository(db.Collection(PriceCollectionName)))
+}
+
+func testPriceRollup(t *testing.T, repo PriceRepository) {
+	ctx := context.Background()
+	service := NewPriceService(repo)
+	productID := primitive.NewObjectID()
+	vietnam := loadLocation(DEFAULT_TIMEZONE)
+	day := func(d int, hour int) time.Time {
+		return time.Date(2024, time.March, d, hour, 0, 0, 0, vietnam)
+	}
+	for _, point := range []Price{
+		// before the range, carried into the first day
+		{Price: 400, CreatedAt: day(3, 12)},
+		// 1:00 in Vietnam is still the 4th in UTC
+		{Price: 100, CreatedAt: day(5, 1)},
+		{Price: 300, CreatedAt: day(5, 13)},
+	} {
+		point.ProductID = productID
+		if _, err := service.Insert(ctx, point); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := service.Rollup(ctx, productID, day(4, 10), day(7, 0), RESOLUTION_DAY, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PriceBucket{
+		{Start: day(4, 0), Min: 400, Max: 400, Avg: 400, Last: 400},
+		// 400 for an hour, 100 for 12 hours, 300 for 11 hours
+		{Start: day(5, 0), Min: 100, Max: 400, Avg: float64(400+100*12+300*11) / 24, Last: 300, Count: 2},
+		// no change, the price is carried over
+		{Start: day(6, 0), Min: 300, Max: 300, Avg: 300, Last: 300},
+	}
+	if len(result.Data) != len(want) || result.TotalItems != len(want) {
+		t.Fatalf("got %d of %d buckets, want %d: %+v", len(result.Data), result.TotalItems, len(want), result.Data)
+	}
+	for i, bucket := range result.Data {
+		if !bucket.Start.Equal(want[i].Start) || bucket.Min != want[i].Min || bucket.Max != want[i].Max ||
+			math.Abs(bucket.Avg-want[i].Avg) > 1e-6 || bucket.Last != want[i].Last || bucket.Count != want[i].Count {
+			t.Errorf("bucket %d = %+v, want %+v", i, bucket, want[i])
+		}
+	}
+
+	// the raw points are paged, the carried price comes first
+	raw, err := service.Rollup(ctx, productID, day(4, 10), day(7, 0), RESOLUTION_RAW, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw.TotalItems != 3 || len(raw.Data) != 1 || raw.Data[0].Last != 300 || raw.Data[0].Count != 1 {
+		t.Errorf("raw page 2 = %+v", raw)
+	}
+	raw, _ = service.Rollup(ctx, productID, day(4, 10), day(7, 0), RESOLUTION_RAW, 2, 1)
+	if len(raw.Data) != 2 || raw.Data[0].Last != 400 || raw.Data[0].Count != 0 || raw.Data[1].Last != 100 {
+		t.Errorf("raw page 1 = %+v", raw)
+	}
+}
+
+func TestPriceRollupBeforeFirstPoint(t *testing.T) {
+	start := time.Date(2024, time.March, 5, 0, 0, 0, 0, time.UTC)
+	points := []Price{{Price: 100, CreatedAt: start.Add(90 * time.Minute)}}
+	// the range stops at now
+	buckets := rollupPrices(nil, points, start, start.Add(150*time.Minute), RESOLUTION_HOUR)
+	if len(buckets) != 2 {
+		t.Fatalf("got %d buckets, want the 2 hours from the first point: %+v", len(buckets), buckets)
+	}
+	// the current hour only counts until now
+	if buckets[1].Avg != 100 || buckets[1].Count != 0 {
+		t.Errorf("current hour = %+v", buckets[1])
+	}
+}
+
+func TestPriceRollupBounds(t *testing.T) {
+	ctx := context.Background()
+	service := NewPriceService(NewMemoryPriceRepository())
+	productID := primitive.NewObjectID()
+	now := time.Now()
+	service.Insert(ctx, Price{ProductID: productID, Price: 100, CreatedAt: now.Add(-3 * time.Hour)})
+
+	// the range stops at now, no bucket is made up for the future
+	result, err := service.Rollup(ctx, productID, now.Add(-2*time.Hour), now.AddDate(0, 0, 2), RESOLUTION_HOUR, 100, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.TotalItems > 3 {
+		t.Errorf("got %d hours, want at most 3", result.TotalItems)
+	}
+	for _, bucket := range result.Data {
+		if bucket.Start.After(now) {
+			t.Errorf("bucket %v starts after now", bucket.Start)
+		}
+	}
+
+	_, err = service.Rollup(ctx, productID, now.AddDate(-1, 0, 0), now, RESOLUTION_HOUR, 100, 1)
+	if !errors.Is(err, ErrTooManyBuckets) {
+		t.Errorf("a year of hours: err = %v, want ErrTooManyBuckets", err)
+	}
+	if _, err = service.Rollup(ctx, productID, now.AddDate(-1, 0, 0), now, RESOLUTION_DAY, 100, 1); err != nil {
+		t.Errorf("a year of days: err = %v", err)
+	}
+}
@@ -2,11 +2,14 @@ package database
 
 import (
 	"context"
+	"sort"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 const ProductCollectionName = "products"
@@ -31,11 +34,39 @@ type Product struct {
 	PriceMaxBeforeDiscount int64              `json:"price_max_before_discount,omitempty" bson:"price_max_before_discount,omitempty"`
 	PriceBeforeDiscount    int64              `json:"price_before_discount,omitempty" bson:"price_before_discount,omitempty"`
 	RawDiscount            float32            `json:"raw_discount,omitempty" bson:"raw_discount,omitempty"`
+	Rating                 float64            `json:"rating,omitempty" bson:"rating,omitempty"`
+	ShopImage              string             `json:"shop_image,omitempty" bson:"shop_image,omitempty"`
+	FlashSaleEndsAt        time.Time          `json:"flash_sale_ends_at,omitempty" bson:"flash_sale_ends_at,omitempty"`
 	Images                 []string           `json:"images,omitempty" bson:"images,omitempty"`
 	CreatedAt              time.Time          `bson:"created_at,omitempty"`
 	UpdatedAt              time.Time          `bson:"updated_at,omitempty"`
 }
 
+// ProductQuery filters, sorts and pages the products list.
+type ProductQuery struct {
+	// Search is a text search on the name
+	Search string
+	ShopID primitive.ObjectID
+	// MinPrice and MaxPrice are in the units of Shopee, the price x 100000
+	MinPrice    int64
+	MaxPrice    int64
+	MinDiscount float64
+	MinRating   float64
+	// Sort is one of ProductSorts, "-" in front sorts descending
+	Sort  string
+	Limit int64
+	Page  int64
+}
+
+// ProductSorts maps the sort names of the API to fields.
+var ProductSorts = map[string]string{
+	"price":    "price",
+	"discount": "raw_discount",
+	"rating":   "rating",
+	"sold":     "historical_sold",
+	"newest":   "created_at",
+}
+
 type ProductRepository interface {
 	Insert(ctx context.Context, product Product) (any, error)
 	FindAll(ctx context.Context) ([]Product, error)
@@ -43,6 +74,9 @@ type ProductRepository interface {
 	FindByName(ctx context.Context, name string) ([]Product, error)
 	Remove(ctx context.Context, id primitive.ObjectID) (bool, error)
 	Update(ctx context.Context, id string, product Product) (Product, error)
+	FindByIDs(ctx context.Context, ids []primitive.ObjectID) ([]Product, error)
+	FindById(ctx context.Context, id primitive.ObjectID) (Product, error)
+	Search(ctx context.Context, query ProductQuery) (DataWithPagination[Product], error)
 }
 
 type MongoProductRepository struct {
@@ -61,9 +95,24 @@ func (r *MongoProductRepository) Insert(ctx context.Context, product Product) (a
 			{Key: "$ref", Value: ShopCollectionName},
 			{Key: "$id", Value: product.ShopID},
 		},
-		"images":     product.Images,
-		"created_at": time.Now(),
-		"updated_at": time.Now(),
+		"images":                    product.Images,
+		"shop_name":                 product.ShopName,
+		"shop_rating":               product.ShopRating,
+		"stock":                     product.Stock,
+		"sold":                      product.Sold,
+		"historical_sold":           product.HistoricalSold,
+		"liked_count":               product.LikedCount,
+		"cmt_count":                 product.CmtCount,
+		"price":                     product.Price,
+		"price_min":                 product.PriceMin,
+		"price_max":                 product.PriceMax,
+		"price_min_before_discount": product.PriceMinBeforeDiscount,
+		"price_max_before_discount": product.PriceMaxBeforeDiscount,
+		"price_before_discount":     product.PriceBeforeDiscount,
+		"raw_discount":              product.RawDiscount,
+		"rating":                    product.Rating,
+		"created_at":                time.Now(),
+		"updated_at":                time.Now(),
 	})
 	if err != nil {
 		return nil, err
@@ -98,19 +147,13 @@ func (r *MongoProductRepository) FindByIdShopee(ctx context.Context, id int64) (
 	return result, nil
 }
 
+// FindByName returns the products whose name matches the words of name.
 func (r *MongoProductRepository) FindByName(ctx context.Context, name string) ([]Product, error) {
-	cursor, err := r.collection.Find(ctx, nil)
+	result, err := r.Search(ctx, ProductQuery{Search: name, Limit: 50, Page: 1})
 	if err != nil {
 		return nil, err
-	} else {
-		var products []Product
-		for cursor.Next(ctx) {
-			var product Product
-			cursor.Decode(&product)
-			products = append(products, product)
-		}
-		return products, nil
 	}
+	return result.Data, nil
 }
 
 func (r *MongoProductRepository) Remove(ctx context.Context, id primitive.ObjectID) (bool, error) {
@@ -127,14 +170,31 @@ func (r *MongoProductRepository) Update(ctx context.Context, id string, product
 	if err != nil {
 		return Product{}, err
 	}
+	set := bson.M{
+		"name":                      product.Name,
+		"images":                    product.Images,
+		"stock":                     product.Stock,
+		"sold":                      product.Sold,
+		"historical_sold":           product.HistoricalSold,
+		"liked_count":               product.LikedCount,
+		"cmt_count":                 product.CmtCount,
+		"price":                     product.Price,
+		"price_min":                 product.PriceMin,
+		"price_max":                 product.PriceMax,
+		"price_min_before_discount": product.PriceMinBeforeDiscount,
+		"price_max_before_discount": product.PriceMaxBeforeDiscount,
+		"price_before_discount":     product.PriceBeforeDiscount,
+		"raw_discount":              product.RawDiscount,
+		"updated_at":                time.Now(),
+	}
+	// a product without reviews has no rating, the last one is kept
+	if product.Rating > 0 {
+		set["rating"] = product.Rating
+	}
 	_, err = r.collection.UpdateOne(ctx, bson.M{
 		"_id": userIDObj,
 	}, bson.M{
-		"$set": bson.M{
-			"name":       product.Name,
-			"images":     product.Images,
-			"updated_at": time.Now(),
-		},
+		"$set": set,
 	})
 	if err != nil {
 		return Product{}, err
@@ -143,6 +203,249 @@ func (r *MongoProductRepository) Update(ctx context.Context, id string, product
 	}
 }
 
+func (r *MongoProductRepository) FindByIDs(ctx context.Context, ids []primitive.ObjectID) ([]Product, error) {
+	var products []Product
+	cursor, err := r.collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &products); err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+func (r *MongoProductRepository) FindById(ctx context.Context, id primitive.ObjectID) (Product, error) {
+	var product Product
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&product)
+	if err != nil {
+		return Product{}, err
+	}
+	return product, nil
+}
+
+func (r *MongoProductRepository) Search(ctx context.Context, query ProductQuery) (DataWithPagination[Product], error) {
+	filter := bson.M{}
+	if query.Search != "" {
+		filter["$text"] = bson.M{"$search": query.Search}
+	}
+	if !query.ShopID.IsZero() {
+		filter["shop.$id"] = query.ShopID
+	}
+	price := bson.M{}
+	if query.MinPrice > 0 {
+		price["$gte"] = query.MinPrice
+	}
+	if query.MaxPrice > 0 {
+		price["$lte"] = query.MaxPrice
+	}
+	if len(price) > 0 {
+		filter["price"] = price
+	}
+	if query.MinDiscount > 0 {
+		filter["raw_discount"] = bson.M{"$gte": query.MinDiscount}
+	}
+	if query.MinRating > 0 {
+		filter["rating"] = bson.M{"$gte": query.MinRating}
+	}
+
+	sort := bson.D{}
+	if field, ok := ProductSorts[strings.TrimPrefix(query.Sort, "-")]; ok {
+		order := 1
+		if strings.HasPrefix(query.Sort, "-") {
+			order = -1
+		}
+		sort = append(sort, bson.E{Key: field, Value: order})
+	} else if query.Search != "" {
+		sort = append(sort, bson.E{Key: "score", Value: bson.M{"$meta": "textScore"}})
+	}
+	sort = append(sort, bson.E{Key: "_id", Value: 1})
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return DataWithPagination[Product]{}, err
+	}
+	products := []Product{}
+	cursor, err := r.collection.Find(ctx, filter, options.Find().
+		SetSort(sort).
+		SetSkip((query.Page-1)*query.Limit).
+		SetLimit(query.Limit),
+	)
+	if err != nil {
+		return DataWithPagination[Product]{}, err
+	}
+	if err = cursor.All(ctx, &products); err != nil {
+		return DataWithPagination[Product]{}, err
+	}
+	return DataWithPagination[Product]{
+		Data:        products,
+		TotalItems:  int(total),
+		TotalPages:  int((total + query.Limit - 1) / query.Limit),
+		CurrentPage: int(query.Page),
+		Limit:       int(query.Limit),
+	}, nil
+}
+
+type MemoryProductRepository struct {
+	products memoryCollection[Product]
+}
+
+func NewMemoryProductRepository() *MemoryProductRepository {
+	return &MemoryProductRepository{}
+}
+
+func (r *MemoryProductRepository) Insert(ctx context.Context, product Product) (any, error) {
+	r.products.mu.Lock()
+	defer r.products.mu.Unlock()
+	if r.products.find(func(p Product) bool { return p.IDShopee == product.IDShopee }) >= 0 {
+		return nil, ErrDuplicate
+	}
+	now := time.Now()
+	product.ID = primitive.NewObjectID()
+	product.Shop = dbRef(ShopCollectionName, product.ShopID)
+	product.ShopID = primitive.NilObjectID
+	product.ShopImage = ""
+	product.FlashSaleEndsAt = time.Time{}
+	product.CreatedAt = now
+	product.UpdatedAt = now
+	r.products.docs = append(r.products.docs, product)
+	return product.ID, nil
+}
+
+func (r *MemoryProductRepository) FindAll(ctx context.Context) ([]Product, error) {
+	r.products.mu.Lock()
+	defer r.products.mu.Unlock()
+	return append([]Product{}, r.products.docs...), nil
+}
+
+func (r *MemoryProductRepository) FindByIdShopee(ctx context.Context, id int64) (Product, error) {
+	return r.findOne(func(p Product) bool { return p.IDShopee == id })
+}
+
+func (r *MemoryProductRepository) FindById(ctx context.Context, id primitive.ObjectID) (Product, error) {
+	return r.findOne(func(p Product) bool { return p.ID == id })
+}
+
+func (r *MemoryProductRepository) findOne(match func(Product) bool) (Product, error) {
+	r.products.mu.Lock()
+	defer r.products.mu.Unlock()
+	i := r.products.find(match)
+	if i < 0 {
+		return Product{}, ErrNotFound
+	}
+	return r.products.docs[i], nil
+}
+
+func (r *MemoryProductRepository) FindByName(ctx context.Context, name string) ([]Product, error) {
+	result, err := r.Search(ctx, ProductQuery{Search: name, Limit: 50, Page: 1})
+	if err != nil {
+		return nil, err
+	}
+	return result.Data, nil
+}
+
+func (r *MemoryProductRepository) Remove(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	r.products.mu.Lock()
+	defer r.products.mu.Unlock()
+	if i := r.products.find(func(p Product) bool { return p.ID == id }); i >= 0 {
+		r.products.docs = append(r.products.docs[:i], r.products.docs[i+1:]...)
+	}
+	return true, nil
+}
+
+func (r *MemoryProductRepository) Update(ctx context.Context, id string, product Product) (Product, error) {
+	idObj, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return Product{}, err
+	}
+	r.products.mu.Lock()
+	defer r.products.mu.Unlock()
+	if i := r.products.find(func(p Product) bool { return p.ID == idObj }); i >= 0 {
+		stored := &r.products.docs[i]
+		stored.Name = product.Name
+		stored.Images = product.Images
+		stored.Stock = product.Stock
+		stored.Sold = product.Sold
+		stored.HistoricalSold = product.HistoricalSold
+		stored.LikedCount = product.LikedCount
+		stored.CmtCount = product.CmtCount
+		stored.Price = product.Price
+		stored.PriceMin = product.PriceMin
+		stored.PriceMax = product.PriceMax
+		stored.PriceMinBeforeDiscount = product.PriceMinBeforeDiscount
+		stored.PriceMaxBeforeDiscount = product.PriceMaxBeforeDiscount
+		stored.PriceBeforeDiscount = product.PriceBeforeDiscount
+		stored.RawDiscount = product.RawDiscount
+		if product.Rating > 0 {
+			stored.Rating = product.Rating
+		}
+		stored.UpdatedAt = time.Now()
+	}
+	return product, nil
+}
+
+func (r *MemoryProductRepository) FindByIDs(ctx context.Context, ids []primitive.ObjectID) ([]Product, error) {
+	r.products.mu.Lock()
+	defer r.products.mu.Unlock()
+	return r.products.filter(func(p Product) bool { return containsID(ids, p.ID) }), nil
+}
+
+// Search matches the words of the search in the names, like the text index
+// does without stemming, and sorts by the number of words matched.
+func (r *MemoryProductRepository) Search(ctx context.Context, query ProductQuery) (DataWithPagination[Product], error) {
+	words := strings.Fields(strings.ToLower(query.Search))
+	score := func(product Product) int {
+		matched := 0
+		for _, word := range strings.Fields(strings.ToLower(product.Name)) {
+			for _, search := range words {
+				if word == search {
+					matched++
+				}
+			}
+		}
+		return matched
+	}
+	r.products.mu.Lock()
+	products := r.products.filter(func(p Product) bool {
+		return (len(words) == 0 || score(p) > 0) &&
+			(query.ShopID.IsZero() || refID(p.Shop) == query.ShopID) &&
+			(query.MinPrice <= 0 || p.Price >= query.MinPrice) &&
+			(query.MaxPrice <= 0 || p.Price <= query.MaxPrice) &&
+			(query.MinDiscount <= 0 || float64(p.RawDiscount) >= query.MinDiscount) &&
+			(query.MinRating <= 0 || p.Rating >= query.MinRating)
+	})
+	r.products.mu.Unlock()
+
+	descending := strings.HasPrefix(query.Sort, "-")
+	field, sorted := ProductSorts[strings.TrimPrefix(query.Sort, "-")]
+	value := func(p Product) float64 {
+		switch field {
+		case "price":
+			return float64(p.Price)
+		case "raw_discount":
+			return float64(p.RawDiscount)
+		case "rating":
+			return p.Rating
+		case "historical_sold":
+			return float64(p.HistoricalSold)
+		case "created_at":
+			return float64(p.CreatedAt.UnixNano())
+		}
+		return 0
+	}
+	sort.SliceStable(products, func(i, j int) bool {
+		a, b := products[i], products[j]
+		switch {
+		case sorted && value(a) != value(b):
+			return (value(a) < value(b)) != descending
+		case !sorted && len(words) > 0 && score(a) != score(b):
+			return score(a) > score(b)
+		}
+		return a.ID.Hex() < b.ID.Hex()
+	})
+	return paginate(products, query.Limit, query.Page), nil
+}
+
 type ProductService struct {
 	repo ProductRepository
 }
@@ -174,3 +477,15 @@ func (s *ProductService) Remove(ctx context.Context, id primitive.ObjectID) (boo
 func (s *ProductService) Update(ctx context.Context, id string, product Product) (Product, error) {
 	return s.repo.Update(ctx, id, product)
 }
+
+func (s *ProductService) FindByIDs(ctx context.Context, ids []primitive.ObjectID) ([]Product, error) {
+	return s.repo.FindByIDs(ctx, ids)
+}
+
+func (s *ProductService) FindById(ctx context.Context, id primitive.ObjectID) (Product, error) {
+	return s.repo.FindById(ctx, id)
+}
+
+func (s *ProductService) Search(ctx context.Context, query ProductQuery) (DataWithPagination[Product], error) {
+	return s.repo.Search(ctx, query)
+}
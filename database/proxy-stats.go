@@ -0,0 +1,132 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	ProxyStatCollectionName = "proxy_stats"
+	// PROXY_STATS_STALE is how long the stats of a worker are shown after
+	// its last publish, a stopped worker drops out of the pool
+	PROXY_STATS_STALE = 10 * time.Minute
+	// PROXY_STATS_TTL removes the stats of the stopped workers
+	PROXY_STATS_TTL = 24 * time.Hour
+)
+
+// ProxyStat is what one worker knows about one proxy. The proxy pool lives
+// in the worker, it publishes the stats so the API can show them.
+type ProxyStat struct {
+	ID            primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	Worker        string             `json:"worker" bson:"worker"`
+	Url           string             `json:"url" bson:"url"`
+	Score         float64            `json:"score" bson:"score"`
+	Requests      int64              `json:"requests" bson:"requests"`
+	Blocks        int64              `json:"blocks" bson:"blocks"`
+	Failures      int64              `json:"failures" bson:"failures"`
+	CooldownUntil time.Time          `json:"cooldown_until,omitempty" bson:"cooldown_until,omitempty"`
+	UpdatedAt     time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+type ProxyStatRepository interface {
+	// Save replaces the stats of the worker for each proxy
+	Save(ctx context.Context, stats []ProxyStat) error
+	FindSince(ctx context.Context, since time.Time) ([]ProxyStat, error)
+}
+
+type MongoProxyStatRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoProxyStatRepository(collection *mongo.Collection) *MongoProxyStatRepository {
+	return &MongoProxyStatRepository{collection}
+}
+
+func (r *MongoProxyStatRepository) Save(ctx context.Context, stats []ProxyStat) error {
+	if len(stats) == 0 {
+		return nil
+	}
+	now := time.Now()
+	models := make([]mongo.WriteModel, len(stats))
+	for i, stat := range stats {
+		models[i] = mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"worker": stat.Worker, "url": stat.Url}).
+			SetUpdate(bson.M{"$set": bson.M{
+				"score":          stat.Score,
+				"requests":       stat.Requests,
+				"blocks":         stat.Blocks,
+				"failures":       stat.Failures,
+				"cooldown_until": stat.CooldownUntil,
+				"updated_at":     now,
+			}}).
+			SetUpsert(true)
+	}
+	_, err := r.collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+func (r *MongoProxyStatRepository) FindSince(ctx context.Context, since time.Time) ([]ProxyStat, error) {
+	stats := []ProxyStat{}
+	cursor, err := r.collection.Find(ctx, bson.M{"updated_at": bson.M{"$gte": since}})
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+type MemoryProxyStatRepository struct {
+	stats memoryCollection[ProxyStat]
+}
+
+func NewMemoryProxyStatRepository() *MemoryProxyStatRepository {
+	return &MemoryProxyStatRepository{}
+}
+
+func (r *MemoryProxyStatRepository) Save(ctx context.Context, stats []ProxyStat) error {
+	r.stats.mu.Lock()
+	defer r.stats.mu.Unlock()
+	now := time.Now()
+	for _, stat := range stats {
+		stat.UpdatedAt = now
+		i := r.stats.find(func(s ProxyStat) bool { return s.Worker == stat.Worker && s.Url == stat.Url })
+		if i < 0 {
+			stat.ID = primitive.NewObjectID()
+			r.stats.docs = append(r.stats.docs, stat)
+			continue
+		}
+		stat.ID = r.stats.docs[i].ID
+		r.stats.docs[i] = stat
+	}
+	return nil
+}
+
+func (r *MemoryProxyStatRepository) FindSince(ctx context.Context, since time.Time) ([]ProxyStat, error) {
+	r.stats.mu.Lock()
+	defer r.stats.mu.Unlock()
+	return r.stats.filter(func(s ProxyStat) bool { return !s.UpdatedAt.Before(since) }), nil
+}
+
+type ProxyStatService struct {
+	repo ProxyStatRepository
+}
+
+func NewProxyStatService(repo ProxyStatRepository) *ProxyStatService {
+	return &ProxyStatService{repo}
+}
+
+func (s *ProxyStatService) Save(ctx context.Context, stats []ProxyStat) error {
+	return s.repo.Save(ctx, stats)
+}
+
+// FindFresh returns the stats the running workers published.
+func (s *ProxyStatService) FindFresh(ctx context.Context) ([]ProxyStat, error) {
+	return s.repo.FindSince(ctx, time.Now().Add(-PROXY_STATS_STALE))
+}
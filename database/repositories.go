@@ -0,0 +1,151 @@
+package database
+
+import (
+	"errors"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrNotFound is returned by the repositories when nothing matches, it is
+// the error of the mongo driver so that both can be checked the same way.
+var ErrNotFound = mongo.ErrNoDocuments
+
+// ErrDuplicate is returned by the in-memory repositories where mongo fails
+// with a duplicate key error.
+var ErrDuplicate = errors.New("duplicate key")
+
+// IsDuplicate tells whether err is a duplicate key error of any repository.
+func IsDuplicate(err error) bool {
+	return errors.Is(err, ErrDuplicate) || mongo.IsDuplicateKeyError(err)
+}
+
+// Repositories are the storage of every collection. The handlers and the jobs
+// use Repos, the tests swap it for NewMemoryRepositories.
+type Repositories struct {
+	Users                 UserRepository
+	Tokens                TokenRepository
+	Shops                 ShopRepository
+	Products              ProductRepository
+	Prices                PriceRepository
+	Trackings             TrackingRepository
+	TrackingConditions    TrackingConditionRepository
+	TrackingSubscriptions TrackingSubscriptionRepository
+	Notifications         NotificationRepository
+	Emails                EmailRepository
+	CrawlJobs             CrawlJobRepository
+	ProxyStats            ProxyStatRepository
+}
+
+// Repos is set by NewMongoDB.
+var Repos *Repositories
+
+func NewMongoRepositories(db *mongo.Database) *Repositories {
+	return &Repositories{
+		Users:                 NewMongoUserRepository(db.Collection(UserCollectionName)),
+		Tokens:                NewMongoTokenRepository(db.Collection(TokenCollectionName)),
+		Shops:                 NewMongoShopRepository(db.Collection(ShopCollectionName)),
+		Products:              NewMongoProductRepository(db.Collection(ProductCollectionName)),
+		Prices:                NewMongoPriceRepository(db.Collection(PriceCollectionName)),
+		Trackings:             NewMongoTrackingRepository(db.Collection(TrackingCollectionName)),
+		TrackingConditions:    NewMongoTrackingConditionRepository(db.Collection(TrackingConditionCollectionName)),
+		TrackingSubscriptions: NewMongoTrackingSubscriptionRepository(db.Collection(TrackingSubscriptionCollectionName)),
+		Notifications:         NewMongoNotificationRepository(db.Collection(NotificationCollectionName)),
+		Emails:                NewMongoEmailRepository(db.Collection(EmailCollectionName)),
+		CrawlJobs:             NewMongoCrawlJobRepository(db.Collection(CrawlJobCollectionName)),
+		ProxyStats:            NewMongoProxyStatRepository(db.Collection(ProxyStatCollectionName)),
+	}
+}
+
+// NewMemoryRepositories keeps everything in memory, for the tests. The
+// conditions look up their user and tracking like the mongo lookups do.
+func NewMemoryRepositories() *Repositories {
+	users := NewMemoryUserRepository()
+	trackings := NewMemoryTrackingRepository()
+	return &Repositories{
+		Users:                 users,
+		Tokens:                NewMemoryTokenRepository(),
+		Shops:                 NewMemoryShopRepository(),
+		Products:              NewMemoryProductRepository(),
+		Prices:                NewMemoryPriceRepository(),
+		Trackings:             trackings,
+		TrackingConditions:    NewMemoryTrackingConditionRepository(users, trackings),
+		TrackingSubscriptions: NewMemoryTrackingSubscriptionRepository(),
+		Notifications:         NewMemoryNotificationRepository(),
+		Emails:                NewMemoryEmailRepository(),
+		CrawlJobs:             NewMemoryCrawlJobRepository(),
+		ProxyStats:            NewMemoryProxyStatRepository(),
+	}
+}
+
+// memoryCollection holds the documents of an in-memory repository in
+// insertion order.
+type memoryCollection[T any] struct {
+	mu   sync.Mutex
+	docs []T
+}
+
+// find returns the index of the first document matching match, -1 when
+// there is none.
+func (c *memoryCollection[T]) find(match func(T) bool) int {
+	for i, doc := range c.docs {
+		if match(doc) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (c *memoryCollection[T]) filter(match func(T) bool) []T {
+	docs := []T{}
+	for _, doc := range c.docs {
+		if match(doc) {
+			docs = append(docs, doc)
+		}
+	}
+	return docs
+}
+
+// paginate returns a page of docs like the mongo repositories.
+func paginate[T any](docs []T, limit int64, page int64) DataWithPagination[T] {
+	total := int64(len(docs))
+	start := min((page-1)*limit, total)
+	end := min(start+limit, total)
+	return DataWithPagination[T]{
+		Data:        append([]T{}, docs[start:end]...),
+		TotalItems:  int(total),
+		TotalPages:  int((total + limit - 1) / limit),
+		CurrentPage: int(page),
+		Limit:       int(limit),
+	}
+}
+
+func dbRef(collection string, id primitive.ObjectID) bson.D {
+	return bson.D{{Key: "$ref", Value: collection}, {Key: "$id", Value: id}}
+}
+
+// refID is the id a DBRef points at.
+func refID(ref bson.D) primitive.ObjectID {
+	id, _ := ref.Map()["$id"].(primitive.ObjectID)
+	return id
+}
+
+func containsID(ids []primitive.ObjectID, id primitive.ObjectID) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+// first returns the first of docs, ErrNotFound when there is none.
+func first[T any](docs []T) (T, error) {
+	if len(docs) == 0 {
+		var zero T
+		return zero, ErrNotFound
+	}
+	return docs[0], nil
+}
@@ -0,0 +1,264 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPaginate(t *testing.T) {
+	docs := []int{1, 2, 3, 4, 5}
+	page := paginate(docs, 2, 3)
+	if len(page.Data) != 1 || page.Data[0] != 5 || page.TotalItems != 5 || page.TotalPages != 3 {
+		t.Errorf("page 3 = %+v", page)
+	}
+	if page := paginate(docs, 2, 4); len(page.Data) != 0 {
+		t.Errorf("page past the end = %+v, want no data", page)
+	}
+}
+
+func TestMemoryTrackingSubscriptions(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryTrackingSubscriptionRepository()
+	userID, trackingID := primitive.NewObjectID(), primitive.NewObjectID()
+
+	if ok, _ := repo.Subscribe(ctx, userID, trackingID); !ok {
+		t.Fatal("first subscribe should subscribe")
+	}
+	if ok, _ := repo.Subscribe(ctx, userID, trackingID); ok {
+		t.Error("subscribing twice should not subscribe again")
+	}
+	if ok, _ := repo.Unsubscribe(ctx, userID, trackingID); !ok {
+		t.Fatal("unsubscribe should archive the subscription")
+	}
+	if _, err := repo.Find(ctx, userID, trackingID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("archived subscription found, err %v", err)
+	}
+	if ok, _ := repo.Subscribe(ctx, userID, trackingID); !ok {
+		t.Error("subscribing again should restore the archived subscription")
+	}
+	counts, _ := repo.CountByTracking(ctx)
+	if counts[trackingID] != 1 {
+		t.Errorf("count = %d, want 1", counts[trackingID])
+	}
+}
+
+func TestMemoryTrackingConditionsWithUser(t *testing.T) {
+	ctx := context.Background()
+	repos := NewMemoryRepositories()
+	id, _ := repos.Users.Insert(ctx, User{Email: "a@example.com", Password: "secret"})
+	userID := id.(primitive.ObjectID)
+	id, _ = repos.Trackings.Insert(ctx, Tracking{IDShopee: 1, Status: true})
+	trackingID := id.(primitive.ObjectID)
+
+	condition, err := repos.TrackingConditions.Insert(ctx, TrackingCondition{TrackingID: trackingID, UserID: userID, Condition: LESS_THAN})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conditionID, _ := primitive.ObjectIDFromHex(condition.ID)
+	if err = repos.TrackingConditions.SetFired(ctx, conditionID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	conditions, _ := repos.TrackingConditions.FindAllWithUser(ctx, TrackingConditionQuery{TrackingID: trackingID, ActiveOnly: true})
+	if len(conditions) != 1 {
+		t.Fatalf("got %d conditions, want 1", len(conditions))
+	}
+	got := conditions[0]
+	if !got.Fired || len(got.UserInfo) != 1 || got.UserInfo[0].ID != userID || len(got.TrackingInfo) != 1 {
+		t.Errorf("condition = %+v", got)
+	}
+	if got.UserInfo[0].Password != "" {
+		t.Error("the password of the user should not be loaded")
+	}
+
+	repos.TrackingConditions.RemoveAll(ctx, TrackingConditionQuery{TrackingID: trackingID, UserID: userID})
+	if conditions, _ := repos.TrackingConditions.FindAll(ctx, TrackingConditionQuery{TrackingID: trackingID, ActiveOnly: true}); len(conditions) != 0 {
+		t.Errorf("removed conditions are still active: %+v", conditions)
+	}
+}
+
+func TestMemoryPriceLowest(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryPriceRepository()
+	productID := primitive.NewObjectID()
+	day := time.Date(2024, time.March, 5, 0, 0, 0, 0, time.UTC)
+	for i, price := range []int64{300, 50, 0, 50} {
+		repo.Insert(ctx, Price{ProductID: productID, Price: price, CreatedAt: day.Add(time.Duration(i) * time.Hour)})
+	}
+	lowest, _ := repo.FindLowest(ctx, productID)
+	if lowest.Price != 50 || !lowest.CreatedAt.Equal(day.Add(3*time.Hour)) {
+		t.Errorf("lowest = %d at %v, want the newest 50", lowest.Price, lowest.CreatedAt)
+	}
+}
+
+func TestMemoryPricesByProducts(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryPriceRepository()
+	first, second, none := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	day := time.Date(2024, time.March, 5, 0, 0, 0, 0, time.UTC)
+	for i, price := range []int64{300, 200, 250} {
+		repo.Insert(ctx, Price{ProductID: first, Price: price, CreatedAt: day.Add(time.Duration(i) * time.Hour)})
+	}
+	repo.Insert(ctx, Price{ProductID: second, Price: 90, CreatedAt: day.Add(5 * time.Hour)})
+	ids := []primitive.ObjectID{first, second, none}
+
+	recent, _ := repo.FindRecentByProducts(ctx, ids, 2)
+	if len(recent[first]) != 2 || recent[first][0].Price != 250 || len(recent[second]) != 1 {
+		t.Errorf("recent = %+v", recent)
+	}
+	if _, ok := recent[none]; ok {
+		t.Error("a product without a point should be left out")
+	}
+	// the second product had no point yet, it takes its first one
+	starts, _ := repo.FindAtByProducts(ctx, map[primitive.ObjectID]time.Time{first: day.Add(90 * time.Minute), second: day})
+	if starts[first].Price != 200 || starts[second].Price != 90 {
+		t.Errorf("starts = %+v", starts)
+	}
+	lows, _ := repo.FindLowestByProducts(ctx, ids)
+	if lows[first].Price != 200 || lows[second].Price != 90 || len(lows) != 2 {
+		t.Errorf("lows = %+v", lows)
+	}
+}
+
+func TestMemoryCrawlJobLease(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryCrawlJobRepository()
+	repo.Enqueue(ctx, CrawlJob{Type: JOB_CRAWL_SHOP, ShopID: 1, Priority: 1})
+	repo.Enqueue(ctx, CrawlJob{Type: JOB_CRAWL_SHOP, ShopID: 2, Priority: 5})
+	if added, _ := repo.Enqueue(ctx, CrawlJob{Type: JOB_CRAWL_SHOP, ShopID: 2}); added {
+		t.Error("an active job should only be queued once")
+	}
+
+	job, err := repo.Lease(ctx, "worker", []string{JOB_CRAWL_SHOP}, time.Minute)
+	if err != nil || job.ShopID != 2 || job.Attempts != 1 {
+		t.Fatalf("leased %+v, %v, want the job of shop 2", job, err)
+	}
+	if err = repo.Complete(ctx, job.ID, "other"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("completing the lease of another worker = %v, want ErrNotFound", err)
+	}
+	if err = repo.Complete(ctx, job.ID, "worker"); err != nil {
+		t.Fatal(err)
+	}
+	if added, _ := repo.Enqueue(ctx, CrawlJob{Type: JOB_CRAWL_SHOP, ShopID: 2}); !added {
+		t.Error("a done job should be queued again")
+	}
+}
+
+func TestMemoryCrawlJobAttempts(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryCrawlJobRepository()
+	repo.Enqueue(ctx, CrawlJob{Type: JOB_CRAWL_SHOP, ShopID: 1, MaxAttempts: 1})
+
+	job, _ := repo.Lease(ctx, "worker", []string{JOB_CRAWL_SHOP}, time.Minute)
+	if err := repo.Defer(ctx, job.ID, "worker", "blocked", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	job, err := repo.Lease(ctx, "worker", []string{JOB_CRAWL_SHOP}, -time.Second)
+	if err != nil || job.Attempts != 1 {
+		t.Fatalf("leased %+v, %v, a deferred job should keep its attempts", job, err)
+	}
+
+	// the worker died, the lease expired after the last attempt
+	if _, err = repo.Lease(ctx, "other", []string{JOB_CRAWL_SHOP}, time.Minute); !errors.Is(err, ErrNotFound) {
+		t.Errorf("lease = %v, want ErrNotFound", err)
+	}
+	dead, _ := repo.FindByStatus(ctx, JOB_DEAD, 10)
+	if len(dead) != 1 || dead[0].LastError != LEASE_EXPIRED {
+		t.Errorf("dead jobs = %+v", dead)
+	}
+}
+
+func TestMemoryNotificationReclaim(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryNotificationRepository()
+	alert := Notification{ConditionID: primitive.NewObjectID(), PriceID: primitive.NewObjectID(), Channel: CHANNEL_WEBHOOK}
+	notification, _ := repo.Insert(ctx, alert)
+	if _, err := repo.Insert(ctx, alert); !IsDuplicate(err) {
+		t.Fatalf("insert twice = %v, want a duplicate", err)
+	}
+
+	// pending and not stale, another worker is sending it
+	if _, err := repo.Reclaim(ctx, alert, time.Now().Add(-time.Minute)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("reclaim while sending = %v, want ErrNotFound", err)
+	}
+	for attempt := 2; attempt <= MAX_NOTIFICATION_ATTEMPTS; attempt++ {
+		repo.UpdateStatus(ctx, notification.ID, NOTIFICATION_FAILED, "timeout")
+		reclaimed, err := repo.Reclaim(ctx, alert, time.Now())
+		if err != nil || reclaimed.Attempts != attempt || reclaimed.Status != NOTIFICATION_PENDING {
+			t.Fatalf("reclaim = %+v, %v, want attempt %d", reclaimed, err, attempt)
+		}
+	}
+	repo.UpdateStatus(ctx, notification.ID, NOTIFICATION_FAILED, "timeout")
+	if _, err := repo.Reclaim(ctx, alert, time.Now()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("reclaim after the last attempt = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryNotificationDigest(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryNotificationRepository()
+	userID := primitive.NewObjectID()
+	notification, _ := repo.Insert(ctx, Notification{UserID: userID, ConditionID: primitive.NewObjectID(), PriceID: primitive.NewObjectID(), Channel: CHANNEL_EMAIL, Status: NOTIFICATION_DIGEST})
+	repo.Insert(ctx, Notification{UserID: primitive.NewObjectID(), ConditionID: primitive.NewObjectID(), PriceID: primitive.NewObjectID(), Channel: CHANNEL_EMAIL, Status: NOTIFICATION_SENT})
+
+	if users, _ := repo.FindDigestUsers(ctx); len(users) != 1 || users[0] != userID {
+		t.Fatalf("digest users = %v, want only %v", users, userID)
+	}
+	ids := []primitive.ObjectID{notification.ID}
+	for attempt := 1; attempt < MAX_NOTIFICATION_ATTEMPTS; attempt++ {
+		repo.RetryDigest(ctx, ids, "timeout")
+		if alerts, _ := repo.FindDigestByUser(ctx, userID, 10); len(alerts) != 1 || alerts[0].Error != "timeout" {
+			t.Fatalf("after %d failed digests the alert = %+v, want it kept", attempt, alerts)
+		}
+	}
+	repo.RetryDigest(ctx, ids, "timeout")
+	if alerts, _ := repo.FindDigestByUser(ctx, userID, 10); len(alerts) != 0 {
+		t.Errorf("alerts after the last attempt = %+v, want none", alerts)
+	}
+}
+
+func TestMemoryUserSetChannelEnabled(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryUserRepository()
+	id, _ := repo.Insert(ctx, User{Email: "a@example.com", Password: "secret"})
+	userID := id.(primitive.ObjectID).Hex()
+	push := NotificationChannel{Type: CHANNEL_WEB_PUSH, Target: "https://push.example.com/1", Enabled: true}
+	webhook := NotificationChannel{Type: CHANNEL_WEBHOOK, Target: "https://example.com/hook", Enabled: true}
+	repo.Update(ctx, userID, UserUpdate{Channels: &[]NotificationChannel{push, webhook}})
+
+	// the channels were reordered since the user was loaded
+	repo.Update(ctx, userID, UserUpdate{Channels: &[]NotificationChannel{webhook, push}})
+	if err := repo.SetChannelEnabled(ctx, userID, push, false); err != nil {
+		t.Fatal(err)
+	}
+	user, _ := repo.FindById(ctx, userID)
+	if !user.Channels[0].Enabled || user.Channels[1].Enabled {
+		t.Errorf("channels = %+v, want only the push channel disabled", user.Channels)
+	}
+}
+
+func TestMemoryTrackingConditionUpdate(t *testing.T) {
+	ctx := context.Background()
+	repos := NewMemoryRepositories()
+	condition, _ := repos.TrackingConditions.Insert(ctx, TrackingCondition{TrackingID: primitive.NewObjectID(), UserID: primitive.NewObjectID(), Condition: TARGET_PRICE, Price: 100})
+	conditionID, _ := primitive.ObjectIDFromHex(condition.ID)
+	repos.TrackingConditions.SetFired(ctx, conditionID, true)
+
+	if _, err := repos.TrackingConditions.Update(ctx, conditionID, TrackingCondition{Condition: DISCOUNT_ABOVE, Percent: 20}); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := repos.TrackingConditions.FindOne(ctx, TrackingConditionQuery{ID: conditionID})
+	if got.Condition != DISCOUNT_ABOVE || got.Percent != 20 {
+		t.Errorf("condition = %+v", got)
+	}
+	if got.Fired {
+		t.Error("an edited condition should be re-armed")
+	}
+	if !got.UpdatedAt.After(condition.UpdatedAt) {
+		t.Errorf("updated_at %v not after %v", got.UpdatedAt, condition.UpdatedAt)
+	}
+}
@@ -0,0 +1,479 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// migrations of the schema, a new one gets the next version. A migration
+// that was released is never changed, a new one fixes it.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "unique users, products and shops",
+		Up:      createIndexes(initialIndexes),
+		Down:    dropIndexes(initialIndexes),
+	},
+	{
+		Version: 2,
+		Name:    "search products by name",
+		Up:      createIndexes(productTextIndex),
+		Down:    dropIndexes(productTextIndex),
+	},
+	{
+		Version: 3,
+		Name:    "prices time series",
+		Up:      createPriceCollection,
+		// the price points would be lost
+		Down: nil,
+	},
+	{
+		Version: 4,
+		Name:    "crawl jobs queue",
+		Up:      createIndexes(crawlJobIndexes),
+		Down:    dropIndexes(crawlJobIndexes),
+	},
+	{
+		Version: 5,
+		Name:    "notifications",
+		Up:      createIndexes(notificationIndexes),
+		Down:    dropIndexes(notificationIndexes),
+	},
+	{
+		Version: 6,
+		Name:    "email outbox",
+		Up:      createIndexes(emailIndexes),
+		Down:    dropIndexes(emailIndexes),
+	},
+	{
+		Version: 7,
+		Name:    "tracking subscriptions",
+		Up:      moveTrackingUsers,
+		Down:    embedTrackingUsers,
+	},
+	{
+		Version: 8,
+		Name:    "prices reference products",
+		Up:      fixPriceProductRef,
+		// the reference to users was a bug
+		Down: nil,
+	},
+	{
+		Version: 9,
+		Name:    "notifications of a user",
+		Up:      createIndexes(userNotificationIndexes),
+		Down:    dropIndexes(userNotificationIndexes),
+	},
+	{
+		Version: 10,
+		Name:    "verified email channels",
+		Up:      verifyOwnEmailChannels,
+		// the flag is ignored by older versions
+		Down: nil,
+	},
+	{
+		Version: 11,
+		Name:    "proxy stats of the workers",
+		Up:      createIndexes(proxyStatIndexes),
+		Down:    dropIndexes(proxyStatIndexes),
+	},
+}
+
+// collectionIndexes are indexes of one collection.
+type collectionIndexes struct {
+	collection string
+	models     []mongo.IndexModel
+}
+
+var initialIndexes = []collectionIndexes{
+	{UserCollectionName, []mongo.IndexModel{{
+		Keys:    bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}}},
+	{ProductCollectionName, []mongo.IndexModel{{
+		Keys:    bson.D{{Key: "id_shopee", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}}},
+	{ShopCollectionName, []mongo.IndexModel{{
+		Keys:    bson.D{{Key: "shop_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}}},
+}
+
+// no stemming for vietnamese names
+var productTextIndex = []collectionIndexes{
+	{ProductCollectionName, []mongo.IndexModel{{
+		Keys:    bson.D{{Key: "name", Value: "text"}},
+		Options: options.Index().SetDefaultLanguage("none"),
+	}}},
+}
+
+// a job is queued only once while active
+var crawlJobIndexes = []collectionIndexes{
+	{CrawlJobCollectionName, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "type", Value: 1}, {Key: "shop_id", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"active": true}),
+		},
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "priority", Value: -1}, {Key: "run_at", Value: 1}},
+		},
+	}},
+}
+
+// a notification is recorded once per condition, price and channel
+var notificationIndexes = []collectionIndexes{
+	{NotificationCollectionName, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "condition_id", Value: 1}, {Key: "price_id", Value: 1}, {Key: "channel", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "condition_id", Value: 1}, {Key: "status", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "user_id", Value: 1}, {Key: "created_at", Value: 1}},
+		},
+	}},
+}
+
+// the service worker of web push lists the latest notifications of the user
+var userNotificationIndexes = []collectionIndexes{
+	{NotificationCollectionName, []mongo.IndexModel{{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+	}}},
+}
+
+// the sender takes the oldest due message, the rate limit counts the sent ones
+var emailIndexes = []collectionIndexes{
+	{EmailCollectionName, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "send_at", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "to", Value: 1}, {Key: "status", Value: 1}, {Key: "sent_at", Value: -1}},
+		},
+	}},
+}
+
+// a user tracks a tracking once, the listing shows the newest first
+var trackingSubscriptionIndexes = []collectionIndexes{
+	{TrackingSubscriptionCollectionName, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "tracking_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "archived", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "tracking_id", Value: 1}, {Key: "archived", Value: 1}},
+		},
+	}},
+}
+
+// a worker publishes one document per proxy, the ones of the stopped workers
+// expire
+var proxyStatIndexes = []collectionIndexes{
+	{ProxyStatCollectionName, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "worker", Value: 1}, {Key: "url", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "updated_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(PROXY_STATS_TTL / time.Second)),
+		},
+	}},
+}
+
+var priceIndexes = []collectionIndexes{
+	{PriceCollectionName, []mongo.IndexModel{{
+		Keys: bson.D{{Key: "product.$id", Value: 1}, {Key: "created_at", Value: -1}},
+	}}},
+}
+
+// createIndexes creates the indexes, an index that exists is left as it is.
+func createIndexes(indexes []collectionIndexes) func(ctx context.Context, db *mongo.Database) error {
+	return func(ctx context.Context, db *mongo.Database) error {
+		for _, index := range indexes {
+			_, err := db.Collection(index.collection).Indexes().CreateMany(ctx, index.models)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func dropIndexes(indexes []collectionIndexes) func(ctx context.Context, db *mongo.Database) error {
+	return func(ctx context.Context, db *mongo.Database) error {
+		for _, index := range indexes {
+			for _, model := range index.models {
+				_, err := db.Collection(index.collection).Indexes().DropOne(ctx, indexName(model.Keys.(bson.D)))
+				if err != nil && !isIndexNotFound(err) {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// indexName is the name mongo gives an index made of keys, like email_1.
+func indexName(keys bson.D) string {
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = fmt.Sprintf("%s_%v", key.Key, key.Value)
+	}
+	return strings.Join(parts, "_")
+}
+
+func isIndexNotFound(err error) bool {
+	var commandErr mongo.CommandError
+	return errors.As(err, &commandErr) && commandErr.Name == "IndexNotFound"
+}
+
+// legacyPriceCollectionName holds the points of a plain prices collection
+// while they are copied to the time series one.
+const legacyPriceCollectionName = "prices_legacy"
+
+// createPriceCollection creates prices as a time series collection keyed by
+// product. A plain prices collection made before is converted: it is renamed
+// to prices_legacy, its points are copied to the new prices and it is
+// dropped. A time series collection can not be renamed, so the copy is made
+// from the legacy one, and a run stopped midway starts the copy over.
+func createPriceCollection(ctx context.Context, db *mongo.Database) error {
+	specs, err := db.ListCollectionSpecifications(ctx, bson.M{
+		"name": bson.M{"$in": []string{PriceCollectionName, legacyPriceCollectionName}},
+	})
+	if err != nil {
+		return err
+	}
+	kinds := map[string]string{}
+	for _, spec := range specs {
+		kinds[spec.Name] = spec.Type
+	}
+
+	switch {
+	case kinds[legacyPriceCollectionName] != "":
+		// an earlier run stopped while copying
+		if kinds[PriceCollectionName] != "" {
+			err = db.Collection(PriceCollectionName).Drop(ctx)
+		}
+	case kinds[PriceCollectionName] == "timeseries":
+		return createIndexes(priceIndexes)(ctx, db)
+	case kinds[PriceCollectionName] != "":
+		err = db.Client().Database("admin").RunCommand(ctx, bson.D{
+			{Key: "renameCollection", Value: db.Name() + "." + PriceCollectionName},
+			{Key: "to", Value: db.Name() + "." + legacyPriceCollectionName},
+		}).Err()
+		kinds[legacyPriceCollectionName] = kinds[PriceCollectionName]
+	}
+	if err != nil {
+		return err
+	}
+
+	err = db.CreateCollection(ctx, PriceCollectionName, options.CreateCollection().SetTimeSeriesOptions(
+		options.TimeSeries().
+			SetTimeField("created_at").
+			SetMetaField("product").
+			SetGranularity("minutes"),
+	))
+	if err != nil {
+		return err
+	}
+	if kinds[legacyPriceCollectionName] != "" {
+		err = copyLegacyPrices(ctx, db)
+		if err != nil {
+			return fmt.Errorf("copy %s to the time series %s: %w", legacyPriceCollectionName, PriceCollectionName, err)
+		}
+	}
+	return createIndexes(priceIndexes)(ctx, db)
+}
+
+// copyLegacyPrices copies the points of prices_legacy to prices and drops
+// it. A time series needs the time of every point, the points without one
+// fail the migration.
+func copyLegacyPrices(ctx context.Context, db *mongo.Database) error {
+	legacy := db.Collection(legacyPriceCollectionName)
+	missing, err := legacy.CountDocuments(ctx, bson.M{"created_at": bson.M{"$not": bson.M{"$type": "date"}}})
+	if err != nil {
+		return err
+	}
+	if missing > 0 {
+		return fmt.Errorf("%d points have no created_at date, fix or remove them and migrate again", missing)
+	}
+
+	cursor, err := legacy.Find(ctx, bson.M{}, options.Find().SetBatchSize(1000))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	prices := db.Collection(PriceCollectionName)
+	batch := []any{}
+	for cursor.Next(ctx) {
+		// Current is only valid until the next call of Next
+		batch = append(batch, append(bson.Raw{}, cursor.Current...))
+		if len(batch) == 1000 {
+			if _, err = prices.InsertMany(ctx, batch); err != nil {
+				return err
+			}
+			batch = []any{}
+		}
+	}
+	if err = cursor.Err(); err != nil {
+		return err
+	}
+	if len(batch) > 0 {
+		if _, err = prices.InsertMany(ctx, batch); err != nil {
+			return err
+		}
+	}
+	return legacy.Drop(ctx)
+}
+
+// moveTrackingUsers moves the users embedded in the trackings, user_id and
+// the users array, to tracking_subscriptions. The trackings only know when
+// the first user tracked the product, a subscription starts with the first
+// condition the user made on the tracking, which is made when they track it.
+func moveTrackingUsers(ctx context.Context, db *mongo.Database) error {
+	err := createIndexes(trackingSubscriptionIndexes)(ctx, db)
+	if err != nil {
+		return err
+	}
+	trackings := db.Collection(TrackingCollectionName)
+	subscriptions := db.Collection(TrackingSubscriptionCollectionName)
+	conditions := db.Collection(TrackingConditionCollectionName)
+	cursor, err := trackings.Find(ctx, bson.M{"$or": []bson.M{
+		{"users": bson.M{"$exists": true}},
+		{"user_id": bson.M{"$exists": true}},
+	}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var tracking struct {
+			ID        primitive.ObjectID `bson:"_id"`
+			UserID    primitive.ObjectID `bson:"user_id"`
+			Users     []bson.D           `bson:"users"`
+			CreatedAt time.Time          `bson:"created_at"`
+		}
+		if err := cursor.Decode(&tracking); err != nil {
+			return err
+		}
+		userIDs := []primitive.ObjectID{}
+		if !tracking.UserID.IsZero() {
+			userIDs = append(userIDs, tracking.UserID)
+		}
+		for _, user := range tracking.Users {
+			if id, ok := user.Map()["$id"].(primitive.ObjectID); ok {
+				userIDs = append(userIDs, id)
+			}
+		}
+		for _, userID := range userIDs {
+			createdAt := tracking.CreatedAt
+			var first TrackingCondition
+			err := conditions.FindOne(ctx, bson.M{
+				"tracking.$id": tracking.ID,
+				"user.$id":     userID,
+				"created_at":   bson.M{"$exists": true},
+			}, options.FindOne().SetSort(bson.D{{Key: "created_at", Value: 1}})).Decode(&first)
+			if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+				return err
+			}
+			if err == nil && !first.CreatedAt.IsZero() {
+				createdAt = first.CreatedAt
+			}
+			_, err = subscriptions.UpdateOne(ctx, bson.M{
+				"user_id":     userID,
+				"tracking_id": tracking.ID,
+			}, bson.M{"$setOnInsert": bson.M{
+				"archived":   false,
+				"created_at": createdAt,
+				"updated_at": time.Now(),
+			}}, options.Update().SetUpsert(true))
+			if err != nil {
+				return err
+			}
+		}
+		_, err := trackings.UpdateOne(ctx, bson.M{"_id": tracking.ID}, bson.M{
+			"$unset": bson.M{"users": "", "user_id": ""},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// embedTrackingUsers puts the users tracking a tracking back in its users
+// array. The nicknames, notes and archived subscriptions are lost.
+func embedTrackingUsers(ctx context.Context, db *mongo.Database) error {
+	subscriptions := db.Collection(TrackingSubscriptionCollectionName)
+	cursor, err := subscriptions.Find(ctx, bson.M{"archived": false}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var subscription TrackingSubscription
+		if err := cursor.Decode(&subscription); err != nil {
+			return err
+		}
+		_, err := db.Collection(TrackingCollectionName).UpdateOne(ctx, bson.M{"_id": subscription.TrackingID}, bson.M{
+			"$addToSet": bson.M{"users": bson.D{
+				{Key: "$ref", Value: UserCollectionName},
+				{Key: "$id", Value: subscription.UserID},
+			}},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	return subscriptions.Drop(ctx)
+}
+
+// fixPriceProductRef points the price points written with a reference to
+// users at products, the id was the one of the product.
+func fixPriceProductRef(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection(PriceCollectionName).UpdateMany(ctx,
+		bson.M{"product.$ref": UserCollectionName},
+		bson.M{"$set": bson.M{"product.$ref": ProductCollectionName}},
+	)
+	return err
+}
+
+// verifyOwnEmailChannels marks the email channels that go to the verified
+// email of their user as verified, the other addresses must be confirmed.
+func verifyOwnEmailChannels(ctx context.Context, db *mongo.Database) error {
+	own := bson.M{"$and": bson.A{
+		bson.M{"$eq": bson.A{"$$channel.type", CHANNEL_EMAIL}},
+		bson.M{"$eq": bson.A{bson.M{"$toLower": "$$channel.target"}, bson.M{"$toLower": "$email"}}},
+	}}
+	_, err := db.Collection(UserCollectionName).UpdateMany(ctx,
+		bson.M{"verified": true, "channels.type": CHANNEL_EMAIL},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"channels": bson.M{"$map": bson.M{
+			"input": "$channels",
+			"as":    "channel",
+			"in": bson.M{"$cond": bson.A{
+				own,
+				bson.M{"$mergeObjects": bson.A{"$$channel", bson.M{"verified": true}}},
+				"$$channel",
+			}},
+		}}}}}},
+	)
+	return err
+}
@@ -16,8 +16,21 @@ type Shop struct {
 	ShopID     int64              `json:"shop_id,omitempty" bson:"shop_id,omitempty"`
 	Name       string             `json:"name,omitempty" bson:"name,omitempty"`
 	ShopRating float64            `json:"shop_rating,omitempty" bson:"shop_rating,omitempty"`
-	CreatedAt  time.Time          `bson:"created_at,omitempty"`
-	UpdatedAt  time.Time          `bson:"updated_at,omitempty"`
+	// CrawlInterval is the time between two crawls of the shop, in seconds
+	CrawlInterval   int64     `json:"crawl_interval,omitempty" bson:"crawl_interval,omitempty"`
+	NextCrawlAt     time.Time `json:"next_crawl_at,omitempty" bson:"next_crawl_at,omitempty"`
+	LastCrawledAt   time.Time `json:"last_crawled_at,omitempty" bson:"last_crawled_at,omitempty"`
+	Priority        float64   `json:"priority,omitempty" bson:"priority,omitempty"`
+	ActiveTrackings int       `json:"active_trackings,omitempty" bson:"active_trackings,omitempty"`
+	// Volatility is the share of products whose price changed between two
+	// crawls, averaged over the recent crawls
+	Volatility float64 `json:"volatility,omitempty" bson:"volatility,omitempty"`
+	// CrawlFailures counts the failed crawls since the last good one, the
+	// shop is not due before RetryCrawlAt
+	CrawlFailures int       `json:"crawl_failures,omitempty" bson:"crawl_failures,omitempty"`
+	RetryCrawlAt  time.Time `json:"retry_crawl_at,omitempty" bson:"retry_crawl_at,omitempty"`
+	CreatedAt     time.Time `bson:"created_at,omitempty"`
+	UpdatedAt     time.Time `bson:"updated_at,omitempty"`
 }
 
 type ShopRepository interface {
@@ -28,6 +41,9 @@ type ShopRepository interface {
 	FindByName(ctx context.Context, name string) (Shop, error)
 	Remove(ctx context.Context, id string) (bool, error)
 	Update(ctx context.Context, id string, shop Shop) (Shop, error)
+	SetPriority(ctx context.Context, id primitive.ObjectID, priority float64, activeTrackings int, crawlInterval int64) error
+	RecordCrawl(ctx context.Context, id primitive.ObjectID, crawledAt time.Time, nextCrawlAt time.Time, volatility float64) error
+	RecordCrawlFailure(ctx context.Context, id primitive.ObjectID, failures int, retryAt time.Time) error
 }
 
 type MongoShopRepository struct {
@@ -68,7 +84,11 @@ func (r *MongoShopRepository) FindAll(ctx context.Context) ([]Shop, error) {
 
 func (r *MongoShopRepository) FindById(ctx context.Context, id string) (Shop, error) {
 	var shop Shop
-	err := r.collection.FindOne(ctx, id).Decode(&shop)
+	idObj, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return Shop{}, err
+	}
+	err = r.collection.FindOne(ctx, bson.M{"_id": idObj}).Decode(&shop)
 	if err != nil {
 		return Shop{}, err
 	}
@@ -114,6 +134,171 @@ func (r *MongoShopRepository) FindByShopShopeeId(ctx context.Context, id int64)
 	return shop, nil
 }
 
+// SetPriority stores the crawl priority and interval computed by the scheduler.
+func (r *MongoShopRepository) SetPriority(ctx context.Context, id primitive.ObjectID, priority float64, activeTrackings int, crawlInterval int64) error {
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set": bson.M{
+			"priority":         priority,
+			"active_trackings": activeTrackings,
+			"crawl_interval":   crawlInterval,
+			"updated_at":       time.Now(),
+		},
+	})
+	return err
+}
+
+// RecordCrawl stores when the shop was crawled and when it is due again.
+// The failures before are forgotten.
+func (r *MongoShopRepository) RecordCrawl(ctx context.Context, id primitive.ObjectID, crawledAt time.Time, nextCrawlAt time.Time, volatility float64) error {
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set": bson.M{
+			"last_crawled_at": crawledAt,
+			"next_crawl_at":   nextCrawlAt,
+			"volatility":      volatility,
+			"updated_at":      time.Now(),
+		},
+		"$unset": bson.M{"crawl_failures": "", "retry_crawl_at": ""},
+	})
+	return err
+}
+
+// RecordCrawlFailure stores the failed crawls in a row and when the shop is
+// tried again.
+func (r *MongoShopRepository) RecordCrawlFailure(ctx context.Context, id primitive.ObjectID, failures int, retryAt time.Time) error {
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set": bson.M{
+			"crawl_failures": failures,
+			"retry_crawl_at": retryAt,
+			"updated_at":     time.Now(),
+		},
+	})
+	return err
+}
+
+type MemoryShopRepository struct {
+	shops memoryCollection[Shop]
+}
+
+func NewMemoryShopRepository() *MemoryShopRepository {
+	return &MemoryShopRepository{}
+}
+
+func (r *MemoryShopRepository) Insert(ctx context.Context, shop Shop) (Shop, error) {
+	r.shops.mu.Lock()
+	defer r.shops.mu.Unlock()
+	if r.shops.find(func(s Shop) bool { return s.ShopID == shop.ShopID }) >= 0 {
+		return Shop{}, ErrDuplicate
+	}
+	now := time.Now()
+	r.shops.docs = append(r.shops.docs, Shop{
+		ID:         primitive.NewObjectID(),
+		ShopID:     shop.ShopID,
+		Name:       shop.Name,
+		ShopRating: shop.ShopRating,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	})
+	return Shop{
+		ID: r.shops.docs[len(r.shops.docs)-1].ID,
+	}, nil
+}
+
+func (r *MemoryShopRepository) FindAll(ctx context.Context) ([]Shop, error) {
+	r.shops.mu.Lock()
+	defer r.shops.mu.Unlock()
+	return append([]Shop{}, r.shops.docs...), nil
+}
+
+func (r *MemoryShopRepository) FindById(ctx context.Context, id string) (Shop, error) {
+	idObj, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return Shop{}, err
+	}
+	return r.findOne(func(s Shop) bool { return s.ID == idObj })
+}
+
+func (r *MemoryShopRepository) FindByShopShopeeId(ctx context.Context, id int64) (Shop, error) {
+	return r.findOne(func(s Shop) bool { return s.ShopID == id })
+}
+
+func (r *MemoryShopRepository) FindByName(ctx context.Context, name string) (Shop, error) {
+	return r.findOne(func(s Shop) bool { return s.Name == name })
+}
+
+func (r *MemoryShopRepository) findOne(match func(Shop) bool) (Shop, error) {
+	r.shops.mu.Lock()
+	defer r.shops.mu.Unlock()
+	i := r.shops.find(match)
+	if i < 0 {
+		return Shop{}, ErrNotFound
+	}
+	return r.shops.docs[i], nil
+}
+
+func (r *MemoryShopRepository) Remove(ctx context.Context, id string) (bool, error) {
+	idObj, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return false, err
+	}
+	r.shops.mu.Lock()
+	defer r.shops.mu.Unlock()
+	if i := r.shops.find(func(s Shop) bool { return s.ID == idObj }); i >= 0 {
+		r.shops.docs = append(r.shops.docs[:i], r.shops.docs[i+1:]...)
+	}
+	return true, nil
+}
+
+func (r *MemoryShopRepository) Update(ctx context.Context, id string, shop Shop) (Shop, error) {
+	idObj, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return Shop{}, err
+	}
+	r.update(idObj, func(stored *Shop) {
+		shop.ID = stored.ID
+		*stored = shop
+	})
+	return shop, nil
+}
+
+func (r *MemoryShopRepository) SetPriority(ctx context.Context, id primitive.ObjectID, priority float64, activeTrackings int, crawlInterval int64) error {
+	r.update(id, func(shop *Shop) {
+		shop.Priority = priority
+		shop.ActiveTrackings = activeTrackings
+		shop.CrawlInterval = crawlInterval
+		shop.UpdatedAt = time.Now()
+	})
+	return nil
+}
+
+func (r *MemoryShopRepository) RecordCrawl(ctx context.Context, id primitive.ObjectID, crawledAt time.Time, nextCrawlAt time.Time, volatility float64) error {
+	r.update(id, func(shop *Shop) {
+		shop.LastCrawledAt = crawledAt
+		shop.NextCrawlAt = nextCrawlAt
+		shop.Volatility = volatility
+		shop.CrawlFailures = 0
+		shop.RetryCrawlAt = time.Time{}
+		shop.UpdatedAt = time.Now()
+	})
+	return nil
+}
+
+func (r *MemoryShopRepository) RecordCrawlFailure(ctx context.Context, id primitive.ObjectID, failures int, retryAt time.Time) error {
+	r.update(id, func(shop *Shop) {
+		shop.CrawlFailures = failures
+		shop.RetryCrawlAt = retryAt
+		shop.UpdatedAt = time.Now()
+	})
+	return nil
+}
+
+func (r *MemoryShopRepository) update(id primitive.ObjectID, apply func(shop *Shop)) {
+	r.shops.mu.Lock()
+	defer r.shops.mu.Unlock()
+	if i := r.shops.find(func(s Shop) bool { return s.ID == id }); i >= 0 {
+		apply(&r.shops.docs[i])
+	}
+}
+
 type ShopService struct {
 	repo ShopRepository
 }
@@ -133,3 +318,19 @@ func (s *ShopService) FindAll(ctx context.Context) ([]Shop, error) {
 func (s *ShopService) FindByShopShopeeId(ctx context.Context, id int64) (Shop, error) {
 	return s.repo.FindByShopShopeeId(ctx, id)
 }
+
+func (s *ShopService) SetPriority(ctx context.Context, id primitive.ObjectID, priority float64, activeTrackings int, crawlInterval int64) error {
+	return s.repo.SetPriority(ctx, id, priority, activeTrackings, crawlInterval)
+}
+
+func (s *ShopService) RecordCrawl(ctx context.Context, id primitive.ObjectID, crawledAt time.Time, nextCrawlAt time.Time, volatility float64) error {
+	return s.repo.RecordCrawl(ctx, id, crawledAt, nextCrawlAt, volatility)
+}
+
+func (s *ShopService) RecordCrawlFailure(ctx context.Context, id primitive.ObjectID, failures int, retryAt time.Time) error {
+	return s.repo.RecordCrawlFailure(ctx, id, failures, retryAt)
+}
+
+func (s *ShopService) FindById(ctx context.Context, id string) (Shop, error) {
+	return s.repo.FindById(ctx, id)
+}
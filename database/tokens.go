@@ -12,23 +12,44 @@ import (
 const (
 	VerifyEmail         = "verify_email"
 	ResetPassword       = "reset_password"
+	VerifyChannel       = "verify_channel"
 	TokenCollectionName = "tokens"
 )
 
 type Token struct {
-	ID        primitive.ObjectID `json:"_id" bson:"_id"`
-	Token     string             `json:"token,omitempty" bson:"token,omitempty"`
-	Type      string             `json:"type,omitempty" bson:"type,omitempty"`
-	UserId    primitive.ObjectID `json:"user_id,omitempty" bson:"user_id,omitempty"`
-	User      bson.D             `json:"user,omitempty" bson:"user,omitempty"`
-	ExpiredAt time.Time          `json:"expired_at,omitempty" bson:"expired_at,omitempty"`
-	CreatedAt time.Time          `json:"created_at,omitempty" bson:"created_at,omitempty"`
+	ID     primitive.ObjectID `json:"_id" bson:"_id"`
+	Token  string             `json:"token,omitempty" bson:"token,omitempty"`
+	Type   string             `json:"type,omitempty" bson:"type,omitempty"`
+	UserId primitive.ObjectID `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	User   bson.D             `json:"user,omitempty" bson:"user,omitempty"`
+	// Target is the address a verify_channel token confirms
+	Target    string    `json:"target,omitempty" bson:"target,omitempty"`
+	ExpiredAt time.Time `json:"expired_at,omitempty" bson:"expired_at,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitempty" bson:"created_at,omitempty"`
+}
+
+// TokenQuery matches a token, of any type when Type is empty.
+type TokenQuery struct {
+	Token string
+	Type  string
+}
+
+func (q TokenQuery) filter() bson.M {
+	filter := bson.M{"token": q.Token}
+	if q.Type != "" {
+		filter["type"] = q.Type
+	}
+	return filter
+}
+
+func (q TokenQuery) match(token Token) bool {
+	return token.Token == q.Token && (q.Type == "" || token.Type == q.Type)
 }
 
 type TokenRepository interface {
 	Insert(ctx context.Context, token Token) (Token, error)
-	FindOneByFilter(ctx context.Context, filter bson.M) (Token, error)
-	Remove(ctx context.Context, filter bson.M) (bool, error)
+	FindOne(ctx context.Context, query TokenQuery) (Token, error)
+	Remove(ctx context.Context, query TokenQuery) (bool, error)
 }
 
 type MongoTokenRepository struct {
@@ -47,6 +68,7 @@ func (r *MongoTokenRepository) Insert(ctx context.Context, token Token) (Token,
 			{Key: "$id", Value: token.UserId},
 		},
 		"type":       token.Type,
+		"target":     token.Target,
 		"expired_at": token.ExpiredAt,
 		"created_at": time.Now(),
 	})
@@ -56,23 +78,65 @@ func (r *MongoTokenRepository) Insert(ctx context.Context, token Token) (Token,
 	return token, nil
 }
 
-func (r *MongoTokenRepository) FindOneByFilter(ctx context.Context, filter bson.M) (Token, error) {
+func (r *MongoTokenRepository) FindOne(ctx context.Context, query TokenQuery) (Token, error) {
 	var token Token
-	err := r.collection.FindOne(ctx, filter).Decode(&token)
+	err := r.collection.FindOne(ctx, query.filter()).Decode(&token)
 	if err != nil {
 		return Token{}, err
 	}
 	return token, nil
 }
 
-func (r *MongoTokenRepository) Remove(ctx context.Context, filter bson.M) (bool, error) {
-	_, err := r.collection.DeleteOne(ctx, filter)
+func (r *MongoTokenRepository) Remove(ctx context.Context, query TokenQuery) (bool, error) {
+	_, err := r.collection.DeleteOne(ctx, query.filter())
 	if err != nil {
 		return false, err
 	}
 	return true, nil
 }
 
+type MemoryTokenRepository struct {
+	tokens memoryCollection[Token]
+}
+
+func NewMemoryTokenRepository() *MemoryTokenRepository {
+	return &MemoryTokenRepository{}
+}
+
+func (r *MemoryTokenRepository) Insert(ctx context.Context, token Token) (Token, error) {
+	r.tokens.mu.Lock()
+	defer r.tokens.mu.Unlock()
+	r.tokens.docs = append(r.tokens.docs, Token{
+		ID:        primitive.NewObjectID(),
+		Token:     token.Token,
+		Type:      token.Type,
+		User:      dbRef(UserCollectionName, token.UserId),
+		Target:    token.Target,
+		ExpiredAt: token.ExpiredAt,
+		CreatedAt: time.Now(),
+	})
+	return token, nil
+}
+
+func (r *MemoryTokenRepository) FindOne(ctx context.Context, query TokenQuery) (Token, error) {
+	r.tokens.mu.Lock()
+	defer r.tokens.mu.Unlock()
+	i := r.tokens.find(query.match)
+	if i < 0 {
+		return Token{}, ErrNotFound
+	}
+	return r.tokens.docs[i], nil
+}
+
+func (r *MemoryTokenRepository) Remove(ctx context.Context, query TokenQuery) (bool, error) {
+	r.tokens.mu.Lock()
+	defer r.tokens.mu.Unlock()
+	if i := r.tokens.find(query.match); i >= 0 {
+		r.tokens.docs = append(r.tokens.docs[:i], r.tokens.docs[i+1:]...)
+	}
+	return true, nil
+}
+
 type TokenService struct {
 	repo TokenRepository
 }
@@ -85,10 +149,10 @@ func (s *TokenService) Insert(ctx context.Context, token Token) (Token, error) {
 	return s.repo.Insert(ctx, token)
 }
 
-func (s *TokenService) FindOneByFilter(ctx context.Context, filter bson.M) (Token, error) {
-	return s.repo.FindOneByFilter(ctx, filter)
+func (s *TokenService) FindOne(ctx context.Context, query TokenQuery) (Token, error) {
+	return s.repo.FindOne(ctx, query)
 }
 
-func (s *TokenService) Remove(ctx context.Context, filter bson.M) (bool, error) {
-	return s.repo.Remove(ctx, filter)
+func (s *TokenService) Remove(ctx context.Context, query TokenQuery) (bool, error) {
+	return s.repo.Remove(ctx, query)
 }
@@ -14,14 +14,41 @@ const (
 	LESS_THAN                       = "less_than"
 	GREATER_THAN                    = "greater_than"
 	EQUAL                           = "equal"
+	// TARGET_PRICE is met while the price is at or under Price
+	TARGET_PRICE = "target_price"
+	// PERCENT_DROP is met when the price dropped by Percent or more
+	PERCENT_DROP = "percent_drop"
+	// ANY_CHANGE is met on every price change
+	ANY_CHANGE = "any_change"
+	// PERCENT_DROP_WINDOW is met when the price is Percent or more under the
+	// highest price of the last WindowHours
+	PERCENT_DROP_WINDOW = "percent_drop_window"
+	// ALL_TIME_LOW is met when the price is lower than ever since the user
+	// started tracking the product
+	ALL_TIME_LOW = "all_time_low"
+	// BACK_IN_STOCK is met when the stock goes from 0 to more
+	BACK_IN_STOCK = "back_in_stock"
+	// DISCOUNT_ABOVE is met while the discount is over Percent
+	DISCOUNT_ABOVE = "discount_above"
+	// NEAR_TARGET is met while the price is at most Margin over Price
+	NEAR_TARGET = "near_target"
 )
 
 type TrackingCondition struct {
-	ID           string             `json:"id" bson:"_id,omitempty"`
-	TrackingID   primitive.ObjectID `json:"tracking_id" bson:"tracking_id"`
-	Tracking     bson.D             `json:"tracking" bson:"tracking"`
-	Condition    string             `json:"condition" bson:"condition"`
-	Price        int64              `json:"price" bson:"price"`
+	ID          string             `json:"id" bson:"_id,omitempty"`
+	TrackingID  primitive.ObjectID `json:"tracking_id" bson:"tracking_id"`
+	Tracking    bson.D             `json:"tracking" bson:"tracking"`
+	Condition   string             `json:"condition" bson:"condition"`
+	Price       int64              `json:"price" bson:"price"`
+	Percent     float64            `json:"percent" bson:"percent"`
+	Margin      int64              `json:"margin" bson:"margin"`
+	WindowHours int                `json:"window_hours" bson:"window_hours"`
+	// CooldownMinutes is the least time between two notifications, the
+	// default cool-down is used when 0
+	CooldownMinutes int `json:"cooldown_minutes" bson:"cooldown_minutes"`
+	// Fired is set once a level condition notified, it is re-armed when the
+	// condition is not met anymore
+	Fired        bool               `json:"fired" bson:"fired"`
 	UserID       primitive.ObjectID `json:"user_id" bson:"user_id"`
 	User         bson.D             `json:"user" bson:"user"`
 	Active       bool               `json:"active" bson:"active"`
@@ -31,14 +58,122 @@ type TrackingCondition struct {
 	TrackingInfo []Tracking         `json:"tracking_info" bson:"tracking_info"`
 }
 
+// PriceHistory is what a condition is checked against.
+type PriceHistory struct {
+	Latest   Price
+	Previous Price
+	// WindowHigh is the highest price within the window of the condition
+	WindowHigh int64
+	// LowSince is the lowest price since the user started tracking, before
+	// Latest, 0 when there was none
+	LowSince int64
+}
+
+// Window is how far back the condition looks, 0 when it only compares the
+// latest two prices.
+func (c TrackingCondition) Window() time.Duration {
+	if c.Condition != PERCENT_DROP_WINDOW {
+		return 0
+	}
+	return time.Duration(c.WindowHours) * time.Hour
+}
+
+// Level tells whether the condition stays met for as long as the price is
+// past a threshold, rather than being met by a single price move.
+func (c TrackingCondition) Level() bool {
+	switch c.Condition {
+	case EQUAL, TARGET_PRICE, DISCOUNT_ABOVE, NEAR_TARGET:
+		return true
+	}
+	return false
+}
+
+// Met tells whether the condition is met by the price history.
+func (c TrackingCondition) Met(history PriceHistory) bool {
+	latest, previous := history.Latest, history.Previous
+	switch c.Condition {
+	case LESS_THAN:
+		return latest.Price < previous.Price
+	case GREATER_THAN:
+		return latest.Price > previous.Price
+	case EQUAL, TARGET_PRICE:
+		return latest.Price <= c.Price
+	case PERCENT_DROP:
+		return dropPercent(previous.Price, latest.Price) >= c.Percent
+	case ANY_CHANGE:
+		return latest.Price != previous.Price
+	case PERCENT_DROP_WINDOW:
+		return dropPercent(history.WindowHigh, latest.Price) >= c.Percent
+	case ALL_TIME_LOW:
+		return history.LowSince > 0 && latest.Price < history.LowSince
+	case BACK_IN_STOCK:
+		return previous.Stock == 0 && latest.Stock > 0
+	case DISCOUNT_ABOVE:
+		return float64(latest.RawDiscount) > c.Percent
+	case NEAR_TARGET:
+		return latest.Price <= c.Price+c.Margin
+	}
+	return false
+}
+
+// dropPercent is how much lower to is than from, in percent.
+func dropPercent(from int64, to int64) float64 {
+	if from <= 0 {
+		return 0
+	}
+	return float64(from-to) * 100 / float64(from)
+}
+
+// TrackingConditionQuery matches the conditions, every field that is not
+// zero must match.
+type TrackingConditionQuery struct {
+	ID         primitive.ObjectID
+	TrackingID primitive.ObjectID
+	// TrackingIDs matches the conditions of any of the trackings
+	TrackingIDs []primitive.ObjectID
+	UserID      primitive.ObjectID
+	ActiveOnly  bool
+}
+
+func (q TrackingConditionQuery) filter() bson.M {
+	filter := bson.M{}
+	if !q.ID.IsZero() {
+		filter["_id"] = q.ID
+	}
+	if !q.TrackingID.IsZero() {
+		filter["tracking.$id"] = q.TrackingID
+	}
+	if q.TrackingIDs != nil {
+		filter["tracking.$id"] = bson.M{"$in": q.TrackingIDs}
+	}
+	if !q.UserID.IsZero() {
+		filter["user.$id"] = q.UserID
+	}
+	if q.ActiveOnly {
+		filter["active"] = true
+	}
+	return filter
+}
+
+func (q TrackingConditionQuery) match(condition TrackingCondition) bool {
+	return (q.ID.IsZero() || condition.ID == q.ID.Hex()) &&
+		(q.TrackingID.IsZero() || refID(condition.Tracking) == q.TrackingID) &&
+		(q.TrackingIDs == nil || containsID(q.TrackingIDs, refID(condition.Tracking))) &&
+		(q.UserID.IsZero() || refID(condition.User) == q.UserID) &&
+		(!q.ActiveOnly || condition.Active)
+}
+
 type TrackingConditionRepository interface {
 	Insert(ctx context.Context, tracking TrackingCondition) (TrackingCondition, error)
-	FindOneByFilter(ctx context.Context, filter bson.M) (TrackingCondition, error)
-	FindAllByFilter(ctx context.Context, filter bson.M) ([]TrackingCondition, error)
+	FindOne(ctx context.Context, query TrackingConditionQuery) (TrackingCondition, error)
+	FindAll(ctx context.Context, query TrackingConditionQuery) ([]TrackingCondition, error)
 	Remove(ctx context.Context, id primitive.ObjectID) (bool, error)
-	Update(ctx context.Context, id primitive.ObjectID, trackingCondition bson.M) (bool, error)
-	RemoveByFilter(ctx context.Context, filter bson.M) (bool, error)
-	FindAllByFilterWithUser(ctx context.Context, filter bson.M) ([]TrackingCondition, error)
+	// Update sets the rule of the condition and re-arms it, its ids are kept
+	Update(ctx context.Context, id primitive.ObjectID, condition TrackingCondition) (bool, error)
+	SetFired(ctx context.Context, id primitive.ObjectID, fired bool) error
+	RemoveAll(ctx context.Context, query TrackingConditionQuery) (bool, error)
+	// FindAllWithUser also loads the user, without password, and the tracking
+	FindAllWithUser(ctx context.Context, query TrackingConditionQuery) ([]TrackingCondition, error)
 }
 
 type MongoTrackingConditionRepository struct {
@@ -50,32 +185,42 @@ func NewMongoTrackingConditionRepository(collection *mongo.Collection) *MongoTra
 }
 
 func (r *MongoTrackingConditionRepository) Insert(ctx context.Context, trackingCondition TrackingCondition) (TrackingCondition, error) {
-	_, err := r.collection.InsertOne(ctx, bson.M{
-		"tracking":   bson.D{{Key: "$ref", Value: TrackingCollectionName}, {Key: "$id", Value: trackingCondition.TrackingID}},
-		"condition":  trackingCondition.Condition,
-		"user":       bson.D{{Key: "$ref", Value: UserCollectionName}, {Key: "$id", Value: trackingCondition.UserID}},
-		"active":     true,
-		"created_at": time.Now(),
-		"updated_at": time.Now(),
+	now := time.Now()
+	result, err := r.collection.InsertOne(ctx, bson.M{
+		"tracking":         bson.D{{Key: "$ref", Value: TrackingCollectionName}, {Key: "$id", Value: trackingCondition.TrackingID}},
+		"condition":        trackingCondition.Condition,
+		"price":            trackingCondition.Price,
+		"percent":          trackingCondition.Percent,
+		"margin":           trackingCondition.Margin,
+		"window_hours":     trackingCondition.WindowHours,
+		"cooldown_minutes": trackingCondition.CooldownMinutes,
+		"user":             bson.D{{Key: "$ref", Value: UserCollectionName}, {Key: "$id", Value: trackingCondition.UserID}},
+		"active":           true,
+		"created_at":       now,
+		"updated_at":       now,
 	})
 	if err != nil {
 		return TrackingCondition{}, err
 	}
+	trackingCondition.ID = result.InsertedID.(primitive.ObjectID).Hex()
+	trackingCondition.Active = true
+	trackingCondition.CreatedAt = now
+	trackingCondition.UpdatedAt = now
 	return trackingCondition, nil
 }
 
-func (r *MongoTrackingConditionRepository) FindOneByFilter(ctx context.Context, filter bson.M) (TrackingCondition, error) {
+func (r *MongoTrackingConditionRepository) FindOne(ctx context.Context, query TrackingConditionQuery) (TrackingCondition, error) {
 	var trackingCondition TrackingCondition
-	err := r.collection.FindOne(ctx, filter).Decode(&trackingCondition)
+	err := r.collection.FindOne(ctx, query.filter()).Decode(&trackingCondition)
 	if err != nil {
 		return TrackingCondition{}, err
 	}
 	return trackingCondition, nil
 }
 
-func (r *MongoTrackingConditionRepository) FindAllByFilter(ctx context.Context, filter bson.M) ([]TrackingCondition, error) {
+func (r *MongoTrackingConditionRepository) FindAll(ctx context.Context, query TrackingConditionQuery) ([]TrackingCondition, error) {
 	var trackingConditions []TrackingCondition
-	cursor, err := r.collection.Find(ctx, filter)
+	cursor, err := r.collection.Find(ctx, query.filter())
 	if err != nil {
 		return []TrackingCondition{}, err
 	}
@@ -97,9 +242,18 @@ func (r *MongoTrackingConditionRepository) Remove(ctx context.Context, id primit
 	return true, nil
 }
 
-func (r *MongoTrackingConditionRepository) Update(ctx context.Context, id primitive.ObjectID, trackingCondition bson.M) (bool, error) {
+func (r *MongoTrackingConditionRepository) Update(ctx context.Context, id primitive.ObjectID, condition TrackingCondition) (bool, error) {
 	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
-		"$set": trackingCondition,
+		"$set": bson.M{
+			"condition":        condition.Condition,
+			"price":            condition.Price,
+			"percent":          condition.Percent,
+			"margin":           condition.Margin,
+			"window_hours":     condition.WindowHours,
+			"cooldown_minutes": condition.CooldownMinutes,
+			"fired":            false,
+			"updated_at":       time.Now(),
+		},
 	})
 	if err != nil {
 		return false, err
@@ -107,8 +261,15 @@ func (r *MongoTrackingConditionRepository) Update(ctx context.Context, id primit
 	return true, nil
 }
 
-func (r *MongoTrackingConditionRepository) RemoveByFilter(ctx context.Context, filter bson.M) (bool, error) {
-	_, err := r.collection.UpdateOne(ctx, filter, bson.M{
+func (r *MongoTrackingConditionRepository) SetFired(ctx context.Context, id primitive.ObjectID, fired bool) error {
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set": bson.M{"fired": fired, "updated_at": time.Now()},
+	})
+	return err
+}
+
+func (r *MongoTrackingConditionRepository) RemoveAll(ctx context.Context, query TrackingConditionQuery) (bool, error) {
+	_, err := r.collection.UpdateMany(ctx, query.filter(), bson.M{
 		"$set": bson.M{"active": false,
 			"updated_at": time.Now()},
 	})
@@ -120,14 +281,12 @@ func (r *MongoTrackingConditionRepository) RemoveByFilter(ctx context.Context, f
 	return true, nil
 }
 
-func (r *MongoTrackingConditionRepository) FindAllByFilterWithUser(ctx context.Context, filter bson.M) ([]TrackingCondition, error) {
+func (r *MongoTrackingConditionRepository) FindAllWithUser(ctx context.Context, query TrackingConditionQuery) ([]TrackingCondition, error) {
 	var trackingConditions []TrackingCondition
 	// not return password
-	projectStage := bson.D{{Key: "$project", Value: bson.D{{Key: "user_info.email", Value: 1},
-		{Key: "tracking_info.shopee_url", Value: 1},
-	}}}
+	projectStage := bson.D{{Key: "$project", Value: bson.D{{Key: "user_info.password", Value: 0}}}}
 	cursor, err := r.collection.Aggregate(ctx, mongo.Pipeline{
-		bson.D{{Key: "$match", Value: filter}},
+		bson.D{{Key: "$match", Value: query.filter()}},
 		bson.D{{Key: "$lookup", Value: bson.M{
 			"from":         UserCollectionName,
 			"localField":   "user.$id",
@@ -151,6 +310,116 @@ func (r *MongoTrackingConditionRepository) FindAllByFilterWithUser(ctx context.C
 	return trackingConditions, nil
 }
 
+// MemoryTrackingConditionRepository looks the users and trackings up in the
+// in-memory repositories given to it.
+type MemoryTrackingConditionRepository struct {
+	conditions memoryCollection[TrackingCondition]
+	users      *MemoryUserRepository
+	trackings  *MemoryTrackingRepository
+}
+
+func NewMemoryTrackingConditionRepository(users *MemoryUserRepository, trackings *MemoryTrackingRepository) *MemoryTrackingConditionRepository {
+	return &MemoryTrackingConditionRepository{users: users, trackings: trackings}
+}
+
+func (r *MemoryTrackingConditionRepository) Insert(ctx context.Context, trackingCondition TrackingCondition) (TrackingCondition, error) {
+	now := time.Now()
+	trackingCondition.ID = primitive.NewObjectID().Hex()
+	trackingCondition.Active = true
+	trackingCondition.Fired = false
+	trackingCondition.CreatedAt = now
+	trackingCondition.UpdatedAt = now
+	stored := trackingCondition
+	stored.Tracking = dbRef(TrackingCollectionName, trackingCondition.TrackingID)
+	stored.User = dbRef(UserCollectionName, trackingCondition.UserID)
+	stored.TrackingID = primitive.NilObjectID
+	stored.UserID = primitive.NilObjectID
+	stored.UserInfo = nil
+	stored.TrackingInfo = nil
+	r.conditions.mu.Lock()
+	defer r.conditions.mu.Unlock()
+	r.conditions.docs = append(r.conditions.docs, stored)
+	return trackingCondition, nil
+}
+
+func (r *MemoryTrackingConditionRepository) FindOne(ctx context.Context, query TrackingConditionQuery) (TrackingCondition, error) {
+	r.conditions.mu.Lock()
+	defer r.conditions.mu.Unlock()
+	i := r.conditions.find(query.match)
+	if i < 0 {
+		return TrackingCondition{}, ErrNotFound
+	}
+	return r.conditions.docs[i], nil
+}
+
+func (r *MemoryTrackingConditionRepository) FindAll(ctx context.Context, query TrackingConditionQuery) ([]TrackingCondition, error) {
+	r.conditions.mu.Lock()
+	defer r.conditions.mu.Unlock()
+	return r.conditions.filter(query.match), nil
+}
+
+func (r *MemoryTrackingConditionRepository) Remove(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	return r.RemoveAll(ctx, TrackingConditionQuery{ID: id})
+}
+
+func (r *MemoryTrackingConditionRepository) Update(ctx context.Context, id primitive.ObjectID, condition TrackingCondition) (bool, error) {
+	r.update(TrackingConditionQuery{ID: id}, func(stored *TrackingCondition) {
+		stored.Condition = condition.Condition
+		stored.Price = condition.Price
+		stored.Percent = condition.Percent
+		stored.Margin = condition.Margin
+		stored.WindowHours = condition.WindowHours
+		stored.CooldownMinutes = condition.CooldownMinutes
+		stored.Fired = false
+	})
+	return true, nil
+}
+
+func (r *MemoryTrackingConditionRepository) SetFired(ctx context.Context, id primitive.ObjectID, fired bool) error {
+	r.update(TrackingConditionQuery{ID: id}, func(stored *TrackingCondition) {
+		stored.Fired = fired
+	})
+	return nil
+}
+
+func (r *MemoryTrackingConditionRepository) RemoveAll(ctx context.Context, query TrackingConditionQuery) (bool, error) {
+	r.update(query, func(stored *TrackingCondition) {
+		stored.Active = false
+	})
+	return true, nil
+}
+
+// update applies to every condition matching query and sets updated_at.
+func (r *MemoryTrackingConditionRepository) update(query TrackingConditionQuery, apply func(condition *TrackingCondition)) {
+	r.conditions.mu.Lock()
+	defer r.conditions.mu.Unlock()
+	for i := range r.conditions.docs {
+		if query.match(r.conditions.docs[i]) {
+			apply(&r.conditions.docs[i])
+			r.conditions.docs[i].UpdatedAt = time.Now()
+		}
+	}
+}
+
+func (r *MemoryTrackingConditionRepository) FindAllWithUser(ctx context.Context, query TrackingConditionQuery) ([]TrackingCondition, error) {
+	conditions, _ := r.FindAll(ctx, query)
+	for i := range conditions {
+		userID, trackingID := refID(conditions[i].User), refID(conditions[i].Tracking)
+		r.users.users.mu.Lock()
+		users := r.users.users.filter(func(u User) bool { return u.ID == userID })
+		r.users.users.mu.Unlock()
+		for j := range users {
+			users[j].Password = ""
+		}
+		r.trackings.trackings.mu.Lock()
+		trackings := r.trackings.trackings.filter(func(t Tracking) bool { return t.ID == trackingID })
+		r.trackings.trackings.mu.Unlock()
+		conditions[i].UserInfo = users
+		conditions[i].TrackingInfo = trackings
+	}
+	return conditions, nil
+}
+
 type TrackingConditionService struct {
 	repo TrackingConditionRepository
 }
@@ -163,26 +432,30 @@ func (s *TrackingConditionService) Insert(ctx context.Context, trackingCondition
 	return s.repo.Insert(ctx, trackingCondition)
 }
 
-func (s *TrackingConditionService) FindOneByFilter(ctx context.Context, filter bson.M) (TrackingCondition, error) {
-	return s.repo.FindOneByFilter(ctx, filter)
+func (s *TrackingConditionService) FindOne(ctx context.Context, query TrackingConditionQuery) (TrackingCondition, error) {
+	return s.repo.FindOne(ctx, query)
 }
 
-func (s *TrackingConditionService) FindAllByFilter(ctx context.Context, filter bson.M) ([]TrackingCondition, error) {
-	return s.repo.FindAllByFilter(ctx, filter)
+func (s *TrackingConditionService) FindAll(ctx context.Context, query TrackingConditionQuery) ([]TrackingCondition, error) {
+	return s.repo.FindAll(ctx, query)
 }
 
 func (s *TrackingConditionService) Remove(ctx context.Context, id primitive.ObjectID) (bool, error) {
 	return s.repo.Remove(ctx, id)
 }
 
-func (s *TrackingConditionService) Update(ctx context.Context, id primitive.ObjectID, trackingCondition bson.M) (bool, error) {
-	return s.repo.Update(ctx, id, trackingCondition)
+func (s *TrackingConditionService) Update(ctx context.Context, id primitive.ObjectID, condition TrackingCondition) (bool, error) {
+	return s.repo.Update(ctx, id, condition)
+}
+
+func (s *TrackingConditionService) SetFired(ctx context.Context, id primitive.ObjectID, fired bool) error {
+	return s.repo.SetFired(ctx, id, fired)
 }
 
-func (s *TrackingConditionService) RemoveByFilter(ctx context.Context, filter bson.M) (bool, error) {
-	return s.repo.RemoveByFilter(ctx, filter)
+func (s *TrackingConditionService) RemoveAll(ctx context.Context, query TrackingConditionQuery) (bool, error) {
+	return s.repo.RemoveAll(ctx, query)
 }
 
-func (s *TrackingConditionService) FindAllByFilterWithUser(ctx context.Context, filter bson.M) ([]TrackingCondition, error) {
-	return s.repo.FindAllByFilterWithUser(ctx, filter)
+func (s *TrackingConditionService) FindAllWithUser(ctx context.Context, query TrackingConditionQuery) ([]TrackingCondition, error) {
+	return s.repo.FindAllWithUser(ctx, query)
 }
@@ -0,0 +1,98 @@
+package database
+
+import "testing"
+
+func TestTrackingConditionMet(t *testing.T) {
+	price := func(p int64, stock int32, discount float32) Price {
+		return Price{Price: p, Stock: stock, RawDiscount: discount}
+	}
+	for _, test := range []struct {
+		name      string
+		condition TrackingCondition
+		history   PriceHistory
+		met       bool
+		level     bool
+	}{
+		{
+			name:      "percent drop in the window",
+			condition: TrackingCondition{Condition: PERCENT_DROP_WINDOW, Percent: 20, WindowHours: 24},
+			history:   PriceHistory{Latest: price(80, 1, 0), Previous: price(90, 1, 0), WindowHigh: 100},
+			met:       true,
+		},
+		{
+			name:      "percent drop in the window too small",
+			condition: TrackingCondition{Condition: PERCENT_DROP_WINDOW, Percent: 20, WindowHours: 24},
+			history:   PriceHistory{Latest: price(85, 1, 0), Previous: price(90, 1, 0), WindowHigh: 100},
+		},
+		{
+			name:      "percent drop without a window high",
+			condition: TrackingCondition{Condition: PERCENT_DROP_WINDOW, Percent: 20, WindowHours: 24},
+			history:   PriceHistory{Latest: price(80, 1, 0), Previous: price(90, 1, 0)},
+		},
+		{
+			name:      "all-time low",
+			condition: TrackingCondition{Condition: ALL_TIME_LOW},
+			history:   PriceHistory{Latest: price(90, 1, 0), Previous: price(100, 1, 0), LowSince: 95},
+			met:       true,
+		},
+		{
+			name:      "equal to the low is not a new low",
+			condition: TrackingCondition{Condition: ALL_TIME_LOW},
+			history:   PriceHistory{Latest: price(95, 1, 0), Previous: price(100, 1, 0), LowSince: 95},
+		},
+		{
+			name:      "all-time low without an earlier price",
+			condition: TrackingCondition{Condition: ALL_TIME_LOW},
+			history:   PriceHistory{Latest: price(90, 1, 0), Previous: price(100, 1, 0)},
+		},
+		{
+			name:      "back in stock",
+			condition: TrackingCondition{Condition: BACK_IN_STOCK},
+			history:   PriceHistory{Latest: price(100, 3, 0), Previous: price(100, 0, 0)},
+			met:       true,
+		},
+		{
+			name:      "still in stock",
+			condition: TrackingCondition{Condition: BACK_IN_STOCK},
+			history:   PriceHistory{Latest: price(100, 3, 0), Previous: price(100, 5, 0)},
+		},
+		{
+			name:      "still out of stock",
+			condition: TrackingCondition{Condition: BACK_IN_STOCK},
+			history:   PriceHistory{Latest: price(100, 0, 0), Previous: price(100, 0, 0)},
+		},
+		{
+			name:      "discount above",
+			condition: TrackingCondition{Condition: DISCOUNT_ABOVE, Percent: 30},
+			history:   PriceHistory{Latest: price(70, 1, 35), Previous: price(100, 1, 0)},
+			met:       true,
+			level:     true,
+		},
+		{
+			name:      "discount at the threshold",
+			condition: TrackingCondition{Condition: DISCOUNT_ABOVE, Percent: 30},
+			history:   PriceHistory{Latest: price(70, 1, 30), Previous: price(100, 1, 0)},
+			level:     true,
+		},
+		{
+			name:      "near target within the margin",
+			condition: TrackingCondition{Condition: NEAR_TARGET, Price: 100, Margin: 10},
+			history:   PriceHistory{Latest: price(110, 1, 0), Previous: price(120, 1, 0)},
+			met:       true,
+			level:     true,
+		},
+		{
+			name:      "near target past the margin",
+			condition: TrackingCondition{Condition: NEAR_TARGET, Price: 100, Margin: 10},
+			history:   PriceHistory{Latest: price(111, 1, 0), Previous: price(120, 1, 0)},
+			level:     true,
+		},
+	} {
+		if got := test.condition.Met(test.history); got != test.met {
+			t.Errorf("%s: Met = %v, want %v", test.name, got, test.met)
+		}
+		if got := test.condition.Level(); got != test.level {
+			t.Errorf("%s: Level = %v, want %v", test.name, got, test.level)
+		}
+	}
+}
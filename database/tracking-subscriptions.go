@@ -0,0 +1,341 @@
+package database
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const TrackingSubscriptionCollectionName = "tracking_subscriptions"
+
+// TrackingSubscription is a user tracking a product. A tracking is shared by
+// every user of the product, the subscriptions tell who tracks it. Archived
+// subscriptions are kept when the user untracks the product.
+type TrackingSubscription struct {
+	ID         primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	UserID     primitive.ObjectID `json:"user_id" bson:"user_id"`
+	TrackingID primitive.ObjectID `json:"tracking_id" bson:"tracking_id"`
+	Nickname   string             `json:"nickname,omitempty" bson:"nickname,omitempty"`
+	Notes      string             `json:"notes,omitempty" bson:"notes,omitempty"`
+	Archived   bool               `json:"archived" bson:"archived"`
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at,omitempty"`
+	UpdatedAt  time.Time          `json:"updated_at" bson:"updated_at,omitempty"`
+}
+
+type TrackingSubscriptionRepository interface {
+	Subscribe(ctx context.Context, userID primitive.ObjectID, trackingID primitive.ObjectID) (bool, error)
+	Unsubscribe(ctx context.Context, userID primitive.ObjectID, trackingID primitive.ObjectID) (bool, error)
+	Find(ctx context.Context, userID primitive.ObjectID, trackingID primitive.ObjectID) (TrackingSubscription, error)
+	Update(ctx context.Context, userID primitive.ObjectID, trackingID primitive.ObjectID, nickname string, notes string) (bool, error)
+	FindPageByUserID(ctx context.Context, userID primitive.ObjectID, limit int64, page int64) (DataWithPagination[TrackingSubscription], error)
+	FindUserIDs(ctx context.Context, trackingID primitive.ObjectID) ([]primitive.ObjectID, error)
+	CountByTracking(ctx context.Context) (map[primitive.ObjectID]int, error)
+}
+
+type MongoTrackingSubscriptionRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoTrackingSubscriptionRepository(collection *mongo.Collection) *MongoTrackingSubscriptionRepository {
+	return &MongoTrackingSubscriptionRepository{collection}
+}
+
+// Subscribe makes the user track the tracking, again when they archived it.
+// It returns false when the user already tracked it.
+func (r *MongoTrackingSubscriptionRepository) Subscribe(ctx context.Context, userID primitive.ObjectID, trackingID primitive.ObjectID) (bool, error) {
+	now := time.Now()
+	result, err := r.collection.UpdateOne(ctx, bson.M{
+		"user_id":     userID,
+		"tracking_id": trackingID,
+		"archived":    bson.M{"$ne": false},
+	}, bson.M{
+		"$set":         bson.M{"archived": false, "created_at": now, "updated_at": now},
+		"$setOnInsert": bson.M{"user_id": userID, "tracking_id": trackingID},
+	}, options.Update().SetUpsert(true))
+	// the subscription exists and is not archived
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0 || result.UpsertedCount > 0, nil
+}
+
+// Unsubscribe archives the subscription, it returns false when the user did
+// not track it.
+func (r *MongoTrackingSubscriptionRepository) Unsubscribe(ctx context.Context, userID primitive.ObjectID, trackingID primitive.ObjectID) (bool, error) {
+	result, err := r.collection.UpdateOne(ctx, bson.M{
+		"user_id":     userID,
+		"tracking_id": trackingID,
+		"archived":    false,
+	}, bson.M{
+		"$set": bson.M{"archived": true, "updated_at": time.Now()},
+	})
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// Find returns the subscription of the user to the tracking unless it is
+// archived.
+func (r *MongoTrackingSubscriptionRepository) Find(ctx context.Context, userID primitive.ObjectID, trackingID primitive.ObjectID) (TrackingSubscription, error) {
+	var subscription TrackingSubscription
+	err := r.collection.FindOne(ctx, bson.M{
+		"user_id":     userID,
+		"tracking_id": trackingID,
+		"archived":    false,
+	}).Decode(&subscription)
+	if err != nil {
+		return TrackingSubscription{}, err
+	}
+	return subscription, nil
+}
+
+func (r *MongoTrackingSubscriptionRepository) Update(ctx context.Context, userID primitive.ObjectID, trackingID primitive.ObjectID, nickname string, notes string) (bool, error) {
+	result, err := r.collection.UpdateOne(ctx, bson.M{
+		"user_id":     userID,
+		"tracking_id": trackingID,
+		"archived":    false,
+	}, bson.M{
+		"$set": bson.M{"nickname": nickname, "notes": notes, "updated_at": time.Now()},
+	})
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// FindPageByUserID returns a page of the subscriptions of a user, newest
+// first.
+func (r *MongoTrackingSubscriptionRepository) FindPageByUserID(ctx context.Context, userID primitive.ObjectID, limit int64, page int64) (DataWithPagination[TrackingSubscription], error) {
+	filter := bson.M{"user_id": userID, "archived": false}
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return DataWithPagination[TrackingSubscription]{}, err
+	}
+	subscriptions := []TrackingSubscription{}
+	cursor, err := r.collection.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip((page-1)*limit).
+		SetLimit(limit),
+	)
+	if err != nil {
+		return DataWithPagination[TrackingSubscription]{}, err
+	}
+	if err = cursor.All(ctx, &subscriptions); err != nil {
+		return DataWithPagination[TrackingSubscription]{}, err
+	}
+	return DataWithPagination[TrackingSubscription]{
+		Data:        subscriptions,
+		TotalItems:  int(total),
+		TotalPages:  int((total + limit - 1) / limit),
+		CurrentPage: int(page),
+		Limit:       int(limit),
+	}, nil
+}
+
+// FindUserIDs returns the users tracking the tracking.
+func (r *MongoTrackingSubscriptionRepository) FindUserIDs(ctx context.Context, trackingID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	var subscriptions []TrackingSubscription
+	cursor, err := r.collection.Find(ctx, bson.M{"tracking_id": trackingID, "archived": false},
+		options.Find().SetProjection(bson.M{"user_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &subscriptions); err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, len(subscriptions))
+	for i, subscription := range subscriptions {
+		ids[i] = subscription.UserID
+	}
+	return ids, nil
+}
+
+// CountByTracking returns how many users track each tracking.
+func (r *MongoTrackingSubscriptionRepository) CountByTracking(ctx context.Context) (map[primitive.ObjectID]int, error) {
+	cursor, err := r.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"archived": false}}},
+		{{Key: "$group", Value: bson.M{"_id": "$tracking_id", "count": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var results []struct {
+		ID    primitive.ObjectID `bson:"_id"`
+		Count int                `bson:"count"`
+	}
+	if err = cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	counts := map[primitive.ObjectID]int{}
+	for _, result := range results {
+		counts[result.ID] = result.Count
+	}
+	return counts, nil
+}
+
+type MemoryTrackingSubscriptionRepository struct {
+	subscriptions memoryCollection[TrackingSubscription]
+}
+
+func NewMemoryTrackingSubscriptionRepository() *MemoryTrackingSubscriptionRepository {
+	return &MemoryTrackingSubscriptionRepository{}
+}
+
+func (r *MemoryTrackingSubscriptionRepository) Subscribe(ctx context.Context, userID primitive.ObjectID, trackingID primitive.ObjectID) (bool, error) {
+	r.subscriptions.mu.Lock()
+	defer r.subscriptions.mu.Unlock()
+	now := time.Now()
+	i := r.subscriptions.find(func(s TrackingSubscription) bool {
+		return s.UserID == userID && s.TrackingID == trackingID
+	})
+	if i < 0 {
+		r.subscriptions.docs = append(r.subscriptions.docs, TrackingSubscription{
+			ID:         primitive.NewObjectID(),
+			UserID:     userID,
+			TrackingID: trackingID,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		})
+		return true, nil
+	}
+	subscription := &r.subscriptions.docs[i]
+	if !subscription.Archived {
+		return false, nil
+	}
+	subscription.Archived = false
+	subscription.CreatedAt = now
+	subscription.UpdatedAt = now
+	return true, nil
+}
+
+func (r *MemoryTrackingSubscriptionRepository) Unsubscribe(ctx context.Context, userID primitive.ObjectID, trackingID primitive.ObjectID) (bool, error) {
+	return r.update(userID, trackingID, func(subscription *TrackingSubscription) {
+		subscription.Archived = true
+	}), nil
+}
+
+func (r *MemoryTrackingSubscriptionRepository) Find(ctx context.Context, userID primitive.ObjectID, trackingID primitive.ObjectID) (TrackingSubscription, error) {
+	r.subscriptions.mu.Lock()
+	defer r.subscriptions.mu.Unlock()
+	i := r.subscriptions.find(func(s TrackingSubscription) bool {
+		return s.UserID == userID && s.TrackingID == trackingID && !s.Archived
+	})
+	if i < 0 {
+		return TrackingSubscription{}, ErrNotFound
+	}
+	return r.subscriptions.docs[i], nil
+}
+
+func (r *MemoryTrackingSubscriptionRepository) Update(ctx context.Context, userID primitive.ObjectID, trackingID primitive.ObjectID, nickname string, notes string) (bool, error) {
+	return r.update(userID, trackingID, func(subscription *TrackingSubscription) {
+		subscription.Nickname = nickname
+		subscription.Notes = notes
+	}), nil
+}
+
+// update applies to the subscription unless it is archived, it returns
+// whether there was one.
+func (r *MemoryTrackingSubscriptionRepository) update(userID primitive.ObjectID, trackingID primitive.ObjectID, apply func(subscription *TrackingSubscription)) bool {
+	r.subscriptions.mu.Lock()
+	defer r.subscriptions.mu.Unlock()
+	i := r.subscriptions.find(func(s TrackingSubscription) bool {
+		return s.UserID == userID && s.TrackingID == trackingID && !s.Archived
+	})
+	if i < 0 {
+		return false
+	}
+	apply(&r.subscriptions.docs[i])
+	r.subscriptions.docs[i].UpdatedAt = time.Now()
+	return true
+}
+
+func (r *MemoryTrackingSubscriptionRepository) FindPageByUserID(ctx context.Context, userID primitive.ObjectID, limit int64, page int64) (DataWithPagination[TrackingSubscription], error) {
+	r.subscriptions.mu.Lock()
+	subscriptions := r.subscriptions.filter(func(s TrackingSubscription) bool {
+		return s.UserID == userID && !s.Archived
+	})
+	r.subscriptions.mu.Unlock()
+	sort.SliceStable(subscriptions, func(i, j int) bool {
+		a, b := subscriptions[i], subscriptions[j]
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.ID.Hex() > b.ID.Hex()
+	})
+	return paginate(subscriptions, limit, page), nil
+}
+
+func (r *MemoryTrackingSubscriptionRepository) FindUserIDs(ctx context.Context, trackingID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	r.subscriptions.mu.Lock()
+	defer r.subscriptions.mu.Unlock()
+	ids := []primitive.ObjectID{}
+	for _, subscription := range r.subscriptions.docs {
+		if subscription.TrackingID == trackingID && !subscription.Archived {
+			ids = append(ids, subscription.UserID)
+		}
+	}
+	return ids, nil
+}
+
+func (r *MemoryTrackingSubscriptionRepository) CountByTracking(ctx context.Context) (map[primitive.ObjectID]int, error) {
+	r.subscriptions.mu.Lock()
+	defer r.subscriptions.mu.Unlock()
+	counts := map[primitive.ObjectID]int{}
+	for _, subscription := range r.subscriptions.docs {
+		if !subscription.Archived {
+			counts[subscription.TrackingID]++
+		}
+	}
+	return counts, nil
+}
+
+type TrackingSubscriptionService struct {
+	repo TrackingSubscriptionRepository
+}
+
+func NewTrackingSubscriptionService(repo TrackingSubscriptionRepository) *TrackingSubscriptionService {
+	return &TrackingSubscriptionService{repo}
+}
+
+func (s *TrackingSubscriptionService) Subscribe(ctx context.Context, userID primitive.ObjectID, trackingID primitive.ObjectID) (bool, error) {
+	return s.repo.Subscribe(ctx, userID, trackingID)
+}
+
+func (s *TrackingSubscriptionService) Unsubscribe(ctx context.Context, userID primitive.ObjectID, trackingID primitive.ObjectID) (bool, error) {
+	return s.repo.Unsubscribe(ctx, userID, trackingID)
+}
+
+func (s *TrackingSubscriptionService) Find(ctx context.Context, userID primitive.ObjectID, trackingID primitive.ObjectID) (TrackingSubscription, error) {
+	return s.repo.Find(ctx, userID, trackingID)
+}
+
+// Exists tells whether the user tracks the tracking.
+func (s *TrackingSubscriptionService) Exists(ctx context.Context, userID primitive.ObjectID, trackingID primitive.ObjectID) bool {
+	_, err := s.repo.Find(ctx, userID, trackingID)
+	return err == nil
+}
+
+func (s *TrackingSubscriptionService) Update(ctx context.Context, userID primitive.ObjectID, trackingID primitive.ObjectID, nickname string, notes string) (bool, error) {
+	return s.repo.Update(ctx, userID, trackingID, nickname, notes)
+}
+
+func (s *TrackingSubscriptionService) FindPageByUserID(ctx context.Context, userID primitive.ObjectID, limit int64, page int64) (DataWithPagination[TrackingSubscription], error) {
+	return s.repo.FindPageByUserID(ctx, userID, limit, page)
+}
+
+func (s *TrackingSubscriptionService) FindUserIDs(ctx context.Context, trackingID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	return s.repo.FindUserIDs(ctx, trackingID)
+}
+
+func (s *TrackingSubscriptionService) CountByTracking(ctx context.Context) (map[primitive.ObjectID]int, error) {
+	return s.repo.CountByTracking(ctx)
+}
@@ -12,29 +12,54 @@ import (
 
 const TrackingCollectionName = "trackings"
 
+// Tracking is a product tracked by one or more users, who tracks it is in
+// tracking_subscriptions.
 type Tracking struct {
 	ID        primitive.ObjectID `json:"_id" bson:"_id"`
 	Product   bson.D             `json:"product,omitempty" bson:"product,omitempty"`
 	IDShopee  int64              `json:"id_shopee,omitempty" bson:"id_shopee,omitempty"`
-	UserID    primitive.ObjectID `json:"user_id,omitempty" bson:"user_id,omitempty"`
-	Users     []bson.D           `json:"users,omitempty" bson:"users,omitempty"`
 	ShopeeUrl string             `json:"shopee_url,omitempty" bson:"shopee_url,omitempty"`
 	Status    bool               `json:"status,omitempty" bson:"status,omitempty"`
 	CreatedAt time.Time          `bson:"created_at,omitempty"`
 	UpdatedAt time.Time          `bson:"updated_at,omitempty"`
 }
 
+// TrackingUpdate sets the fields that are not zero.
+type TrackingUpdate struct {
+	ProductID primitive.ObjectID
+	Status    *bool
+}
+
+func (u TrackingUpdate) set() bson.M {
+	set := bson.M{"updated_at": time.Now()}
+	if !u.ProductID.IsZero() {
+		set["product"] = dbRef(ProductCollectionName, u.ProductID)
+	}
+	if u.Status != nil {
+		set["status"] = *u.Status
+	}
+	return set
+}
+
+func (u TrackingUpdate) apply(tracking *Tracking) {
+	tracking.UpdatedAt = time.Now()
+	if !u.ProductID.IsZero() {
+		tracking.Product = dbRef(ProductCollectionName, u.ProductID)
+	}
+	if u.Status != nil {
+		tracking.Status = *u.Status
+	}
+}
+
 type TrackingRepository interface {
 	Insert(ctx context.Context, tracking Tracking) (any, error)
 	FindByIDShopee(ctx context.Context, id int64) (Tracking, error)
-	FindByUserID(ctx context.Context, id primitive.ObjectID) ([]Tracking, error)
 	Remove(ctx context.Context, id primitive.ObjectID) (bool, error)
-	Update(ctx context.Context, id primitive.ObjectID, tracking bson.M) (Tracking, error)
+	Update(ctx context.Context, id primitive.ObjectID, update TrackingUpdate) (Tracking, error)
 	FindAll(ctx context.Context, limit int64, page int64) (DataWithPagination[Tracking], error)
-	AddNewUserToTracking(ctx context.Context, id primitive.ObjectID, user_id primitive.ObjectID) (Tracking, error)
-	CheckUserInTracking(ctx context.Context, id primitive.ObjectID, user_id primitive.ObjectID) (bool, error)
-	UnTracking(ctx context.Context, id primitive.ObjectID, user_id primitive.ObjectID) (bool, error)
 	FindById(ctx context.Context, id primitive.ObjectID) (Tracking, error)
+	FindActive(ctx context.Context) ([]Tracking, error)
+	FindByIDs(ctx context.Context, ids []primitive.ObjectID) ([]Tracking, error)
 }
 
 type MongoTrackingRepository struct {
@@ -51,9 +76,6 @@ func (r *MongoTrackingRepository) Insert(ctx context.Context, tracking Tracking)
 		"status":     tracking.Status,
 		"shopee_url": tracking.ShopeeUrl,
 		"product":    tracking.Product,
-		"users": []bson.D{
-			{{Key: "$ref", Value: UserCollectionName}, {Key: "$id", Value: tracking.UserID}},
-		},
 		"created_at": time.Now(),
 		"updated_at": time.Now(),
 	})
@@ -73,18 +95,6 @@ func (r *MongoTrackingRepository) FindByIDShopee(ctx context.Context, id int64)
 	return tracking, nil
 }
 
-func (r *MongoTrackingRepository) FindByUserID(ctx context.Context, id primitive.ObjectID) ([]Tracking, error) {
-	var trackings []Tracking
-	cursor, err := r.collection.Find(ctx, bson.M{"user_id": id})
-	if err != nil {
-		return nil, err
-	}
-	if err = cursor.All(ctx, &trackings); err != nil {
-		return nil, err
-	}
-	return trackings, nil
-}
-
 func (r *MongoTrackingRepository) Remove(ctx context.Context, id primitive.ObjectID) (bool, error) {
 	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
 	if err != nil {
@@ -93,9 +103,9 @@ func (r *MongoTrackingRepository) Remove(ctx context.Context, id primitive.Objec
 	return true, nil
 }
 
-func (r *MongoTrackingRepository) Update(ctx context.Context, id primitive.ObjectID, tracking bson.M) (Tracking, error) {
+func (r *MongoTrackingRepository) Update(ctx context.Context, id primitive.ObjectID, update TrackingUpdate) (Tracking, error) {
 	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
-		"$set": tracking,
+		"$set": update.set(),
 	})
 	if err != nil {
 		return Tracking{}, err
@@ -133,58 +143,113 @@ func (r *MongoTrackingRepository) FindAll(ctx context.Context, limit int64, page
 	}, nil
 }
 
-func (r *MongoTrackingRepository) AddNewUserToTracking(ctx context.Context, id primitive.ObjectID, user_id primitive.ObjectID) (Tracking, error) {
-	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
-		"$push": bson.M{
-			"users": bson.D{
-				{Key: "$ref", Value: UserCollectionName},
-				{Key: "$id", Value: user_id},
-			},
-		},
-	})
-	if err != nil {
-		return Tracking{}, err
-	}
-
+func (r *MongoTrackingRepository) FindById(ctx context.Context, id primitive.ObjectID) (Tracking, error) {
 	var tracking Tracking
-	err = r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&tracking)
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&tracking)
 	if err != nil {
 		return Tracking{}, err
 	}
 	return tracking, nil
 }
 
-func (r *MongoTrackingRepository) CheckUserInTracking(ctx context.Context, id primitive.ObjectID, user_id primitive.ObjectID) (bool, error) {
-	var tracking Tracking
-	err := r.collection.FindOne(ctx, bson.M{"_id": id, "users": bson.D{{Key: "$ref", Value: UserCollectionName}, {Key: "$id", Value: user_id}}}).Decode(&tracking)
+func (r *MongoTrackingRepository) FindActive(ctx context.Context) ([]Tracking, error) {
+	var trackings []Tracking
+	cursor, err := r.collection.Find(ctx, bson.M{"status": true})
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-	return true, nil
+	if err = cursor.All(ctx, &trackings); err != nil {
+		return nil, err
+	}
+	return trackings, nil
 }
 
-func (r *MongoTrackingRepository) UnTracking(ctx context.Context, id primitive.ObjectID, user_id primitive.ObjectID) (bool, error) {
-	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
-		"$pull": bson.M{
-			"users": bson.D{
-				{Key: "$ref", Value: UserCollectionName},
-				{Key: "$id", Value: user_id},
-			},
-		},
-	})
+// FindByIDs returns the trackings with the given ids, in no given order.
+func (r *MongoTrackingRepository) FindByIDs(ctx context.Context, ids []primitive.ObjectID) ([]Tracking, error) {
+	trackings := []Tracking{}
+	cursor, err := r.collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
 	if err != nil {
-		return false, err
+		return nil, err
+	}
+	if err = cursor.All(ctx, &trackings); err != nil {
+		return nil, err
+	}
+	return trackings, nil
+}
+
+type MemoryTrackingRepository struct {
+	trackings memoryCollection[Tracking]
+}
+
+func NewMemoryTrackingRepository() *MemoryTrackingRepository {
+	return &MemoryTrackingRepository{}
+}
+
+func (r *MemoryTrackingRepository) Insert(ctx context.Context, tracking Tracking) (any, error) {
+	r.trackings.mu.Lock()
+	defer r.trackings.mu.Unlock()
+	now := time.Now()
+	tracking.ID = primitive.NewObjectID()
+	tracking.CreatedAt = now
+	tracking.UpdatedAt = now
+	r.trackings.docs = append(r.trackings.docs, tracking)
+	return tracking.ID, nil
+}
+
+func (r *MemoryTrackingRepository) FindByIDShopee(ctx context.Context, id int64) (Tracking, error) {
+	return r.findOne(func(t Tracking) bool { return t.IDShopee == id })
+}
+
+func (r *MemoryTrackingRepository) FindById(ctx context.Context, id primitive.ObjectID) (Tracking, error) {
+	return r.findOne(func(t Tracking) bool { return t.ID == id })
+}
+
+func (r *MemoryTrackingRepository) findOne(match func(Tracking) bool) (Tracking, error) {
+	r.trackings.mu.Lock()
+	defer r.trackings.mu.Unlock()
+	i := r.trackings.find(match)
+	if i < 0 {
+		return Tracking{}, ErrNotFound
+	}
+	return r.trackings.docs[i], nil
+}
+
+func (r *MemoryTrackingRepository) Remove(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	r.trackings.mu.Lock()
+	defer r.trackings.mu.Unlock()
+	if i := r.trackings.find(func(t Tracking) bool { return t.ID == id }); i >= 0 {
+		r.trackings.docs = append(r.trackings.docs[:i], r.trackings.docs[i+1:]...)
 	}
 	return true, nil
 }
 
-func (r *MongoTrackingRepository) FindById(ctx context.Context, id primitive.ObjectID) (Tracking, error) {
-	var tracking Tracking
-	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&tracking)
-	if err != nil {
-		return Tracking{}, err
+func (r *MemoryTrackingRepository) Update(ctx context.Context, id primitive.ObjectID, update TrackingUpdate) (Tracking, error) {
+	r.trackings.mu.Lock()
+	defer r.trackings.mu.Unlock()
+	if i := r.trackings.find(func(t Tracking) bool { return t.ID == id }); i >= 0 {
+		update.apply(&r.trackings.docs[i])
 	}
-	return tracking, nil
+	return Tracking{
+		ID: id,
+	}, nil
+}
+
+func (r *MemoryTrackingRepository) FindAll(ctx context.Context, limit int64, page int64) (DataWithPagination[Tracking], error) {
+	r.trackings.mu.Lock()
+	defer r.trackings.mu.Unlock()
+	return paginate(r.trackings.docs, limit, page), nil
+}
+
+func (r *MemoryTrackingRepository) FindActive(ctx context.Context) ([]Tracking, error) {
+	r.trackings.mu.Lock()
+	defer r.trackings.mu.Unlock()
+	return r.trackings.filter(func(t Tracking) bool { return t.Status }), nil
+}
+
+func (r *MemoryTrackingRepository) FindByIDs(ctx context.Context, ids []primitive.ObjectID) ([]Tracking, error) {
+	r.trackings.mu.Lock()
+	defer r.trackings.mu.Unlock()
+	return r.trackings.filter(func(t Tracking) bool { return containsID(ids, t.ID) }), nil
 }
 
 type TrackingService struct {
@@ -203,34 +268,26 @@ func (s *TrackingService) FindByIDShopee(ctx context.Context, id int64) (Trackin
 	return s.repository.FindByIDShopee(ctx, id)
 }
 
-func (s *TrackingService) FindByUserID(ctx context.Context, id primitive.ObjectID) ([]Tracking, error) {
-	return s.repository.FindByUserID(ctx, id)
-}
-
 func (s *TrackingService) Remove(ctx context.Context, id primitive.ObjectID) (bool, error) {
 	return s.repository.Remove(ctx, id)
 }
 
-func (s *TrackingService) Update(ctx context.Context, id primitive.ObjectID, tracking bson.M) (Tracking, error) {
-	return s.repository.Update(ctx, id, tracking)
+func (s *TrackingService) Update(ctx context.Context, id primitive.ObjectID, update TrackingUpdate) (Tracking, error) {
+	return s.repository.Update(ctx, id, update)
 }
 
 func (s *TrackingService) FindAll(ctx context.Context, limit int64, page int64) (DataWithPagination[Tracking], error) {
 	return s.repository.FindAll(ctx, limit, page)
 }
 
-func (s *TrackingService) AddNewUserToTracking(ctx context.Context, id primitive.ObjectID, user_id primitive.ObjectID) (Tracking, error) {
-	return s.repository.AddNewUserToTracking(ctx, id, user_id)
-}
-
-func (s *TrackingService) CheckUserInTracking(ctx context.Context, id primitive.ObjectID, user_id primitive.ObjectID) (bool, error) {
-	return s.repository.CheckUserInTracking(ctx, id, user_id)
+func (s *TrackingService) FindById(ctx context.Context, id primitive.ObjectID) (Tracking, error) {
+	return s.repository.FindById(ctx, id)
 }
 
-func (s *TrackingService) UnTracking(ctx context.Context, id primitive.ObjectID, user_id primitive.ObjectID) (bool, error) {
-	return s.repository.UnTracking(ctx, id, user_id)
+func (s *TrackingService) FindActive(ctx context.Context) ([]Tracking, error) {
+	return s.repository.FindActive(ctx)
 }
 
-func (s *TrackingService) FindById(ctx context.Context, id primitive.ObjectID) (Tracking, error) {
-	return s.repository.FindById(ctx, id)
+func (s *TrackingService) FindByIDs(ctx context.Context, ids []primitive.ObjectID) ([]Tracking, error) {
+	return s.repository.FindByIDs(ctx, ids)
 }
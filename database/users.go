@@ -2,7 +2,10 @@ package database
 
 import (
 	"context"
+	"strings"
 	"time"
+	// the timezones of the users work without tzdata on the host
+	_ "time/tzdata"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -22,15 +25,149 @@ const (
 
 const UserCollectionName = "users"
 
+const (
+	DIGEST_INSTANT = "instant"
+	DIGEST_HOURLY  = "hourly"
+	DIGEST_DAILY   = "daily"
+	// DEFAULT_TIMEZONE is used when the user did not set one
+	DEFAULT_TIMEZONE = "Asia/Ho_Chi_Minh"
+)
+
+// NotificationChannel is where a user gets alerts. Target is the email
+// address, the webhook url, the telegram chat id or the push endpoint.
+type NotificationChannel struct {
+	Type   string `json:"type" bson:"type"`
+	Target string `json:"target" bson:"target"`
+	// Secret signs the webhook bodies
+	Secret  string `json:"secret,omitempty" bson:"secret,omitempty"`
+	Enabled bool   `json:"enabled" bson:"enabled"`
+	// Verified is set on an email channel once its address is confirmed
+	Verified bool `json:"verified" bson:"verified,omitempty"`
+	// Conditions limits the channel to these condition types, all when empty
+	Conditions []string `json:"conditions,omitempty" bson:"conditions,omitempty"`
+}
+
+// Reachable tells whether alerts can go to the channel: it is enabled and,
+// for email, its address is confirmed.
+func (c NotificationChannel) Reachable() bool {
+	return c.Enabled && (c.Type != CHANNEL_EMAIL || c.Verified)
+}
+
+// Accepts tells whether the channel wants alerts of the condition type.
+func (c NotificationChannel) Accepts(condition string) bool {
+	if !c.Reachable() {
+		return false
+	}
+	if len(c.Conditions) == 0 {
+		return true
+	}
+	for _, accepted := range c.Conditions {
+		if accepted == condition {
+			return true
+		}
+	}
+	return false
+}
+
 type User struct {
-	ID        primitive.ObjectID `json:"_id" bson:"_id"`
-	Email     string             `json:"email,omitempty" bson:"email,omitempty"`
-	Password  string             `json:"password,omitempty" bson:"password,omitempty"`
-	Role      string             `json:"role,omitempty" bson:"role,omitempty"`
-	Verified  bool               `json:"verified,omitempty" bson:"verified,omitempty"`
-	Status    string             `json:"status,omitempty" bson:"status,omitempty"`
-	CreatedAt time.Time          `bson:"created_at,omitempty"`
-	UpdatedAt time.Time          `bson:"updated_at,omitempty"`
+	ID       primitive.ObjectID `json:"_id" bson:"_id"`
+	Email    string             `json:"email,omitempty" bson:"email,omitempty"`
+	Password string             `json:"password,omitempty" bson:"password,omitempty"`
+	Role     string             `json:"role,omitempty" bson:"role,omitempty"`
+	Verified bool               `json:"verified,omitempty" bson:"verified,omitempty"`
+	Status   string             `json:"status,omitempty" bson:"status,omitempty"`
+	// Locale is the language of the emails, "en" or "vi"
+	Locale string `json:"locale,omitempty" bson:"locale,omitempty"`
+	// Digest is how often the user gets alerts, instant when empty
+	Digest string `json:"digest,omitempty" bson:"digest,omitempty"`
+	// Timezone is an IANA name, DEFAULT_TIMEZONE when empty
+	Timezone string `json:"timezone,omitempty" bson:"timezone,omitempty"`
+	// QuietStart and QuietEnd are "15:04" in the timezone of the user, no
+	// alert is sent in between
+	QuietStart   string    `json:"quiet_start,omitempty" bson:"quiet_start,omitempty"`
+	QuietEnd     string    `json:"quiet_end,omitempty" bson:"quiet_end,omitempty"`
+	LastDigestAt time.Time `json:"last_digest_at,omitempty" bson:"last_digest_at,omitempty"`
+	// Channels are where the user gets alerts, their email when empty
+	Channels  []NotificationChannel `json:"channels,omitempty" bson:"channels,omitempty"`
+	CreatedAt time.Time             `bson:"created_at,omitempty"`
+	UpdatedAt time.Time             `bson:"updated_at,omitempty"`
+}
+
+// UserUpdate holds the fields of a user to change, nil fields are left as
+// they are.
+type UserUpdate struct {
+	Verified     *bool
+	Password     *string
+	Locale       *string
+	Digest       *string
+	Timezone     *string
+	QuietStart   *string
+	QuietEnd     *string
+	LastDigestAt *time.Time
+	Channels     *[]NotificationChannel
+}
+
+func (u UserUpdate) set() bson.M {
+	set := bson.M{"updated_at": time.Now()}
+	if u.Verified != nil {
+		set["verified"] = *u.Verified
+	}
+	if u.Password != nil {
+		set["password"] = *u.Password
+	}
+	if u.Locale != nil {
+		set["locale"] = *u.Locale
+	}
+	if u.Digest != nil {
+		set["digest"] = *u.Digest
+	}
+	if u.Timezone != nil {
+		set["timezone"] = *u.Timezone
+	}
+	if u.QuietStart != nil {
+		set["quiet_start"] = *u.QuietStart
+	}
+	if u.QuietEnd != nil {
+		set["quiet_end"] = *u.QuietEnd
+	}
+	if u.LastDigestAt != nil {
+		set["last_digest_at"] = *u.LastDigestAt
+	}
+	if u.Channels != nil {
+		set["channels"] = *u.Channels
+	}
+	return set
+}
+
+func (u UserUpdate) apply(user *User) {
+	if u.Verified != nil {
+		user.Verified = *u.Verified
+	}
+	if u.Password != nil {
+		user.Password = *u.Password
+	}
+	if u.Locale != nil {
+		user.Locale = *u.Locale
+	}
+	if u.Digest != nil {
+		user.Digest = *u.Digest
+	}
+	if u.Timezone != nil {
+		user.Timezone = *u.Timezone
+	}
+	if u.QuietStart != nil {
+		user.QuietStart = *u.QuietStart
+	}
+	if u.QuietEnd != nil {
+		user.QuietEnd = *u.QuietEnd
+	}
+	if u.LastDigestAt != nil {
+		user.LastDigestAt = *u.LastDigestAt
+	}
+	if u.Channels != nil {
+		user.Channels = append([]NotificationChannel{}, *u.Channels...)
+	}
+	user.UpdatedAt = time.Now()
 }
 
 type UserRepository interface {
@@ -39,7 +176,10 @@ type UserRepository interface {
 	FindById(ctx context.Context, id string) (User, error)
 	FindByEmail(ctx context.Context, email string) (User, error)
 	Remove(ctx context.Context, id string) (bool, error)
-	Update(ctx context.Context, id string, user bson.M) error
+	Update(ctx context.Context, id string, update UserUpdate) error
+	// SetChannelEnabled turns the channel of the user with the type and the
+	// target of channel on or off without touching the others.
+	SetChannelEnabled(ctx context.Context, id string, channel NotificationChannel, enabled bool) error
 }
 
 type MongoUserRepository struct {
@@ -56,6 +196,7 @@ func (r *MongoUserRepository) Insert(ctx context.Context, user User) (any, error
 		"password":   user.Password,
 		"role":       user.Role,
 		"verified":   user.Verified,
+		"locale":     user.Locale,
 		"status":     PENDING_STATUS,
 		"created_at": time.Now(),
 		"updated_at": time.Now(),
@@ -112,18 +253,210 @@ func (r *MongoUserRepository) Remove(ctx context.Context, id string) (bool, erro
 	return true, nil
 }
 
-func (r *MongoUserRepository) Update(ctx context.Context, id string, user bson.M) error {
+func (r *MongoUserRepository) Update(ctx context.Context, id string, update UserUpdate) error {
 	objectId, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return err
 	}
-	_, err = r.collection.UpdateOne(ctx, bson.M{"_id": objectId}, bson.M{"$set": user})
+	_, err = r.collection.UpdateOne(ctx, bson.M{"_id": objectId}, bson.M{"$set": update.set()})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *MongoUserRepository) SetChannelEnabled(ctx context.Context, id string, channel NotificationChannel, enabled bool) error {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	_, err = r.collection.UpdateOne(ctx, bson.M{
+		"_id": objectId,
+		"channels": bson.M{"$elemMatch": bson.M{
+			"type":   channel.Type,
+			"target": channel.Target,
+		}},
+	}, bson.M{"$set": bson.M{
+		"channels.$.enabled": enabled,
+		"updated_at":         time.Now(),
+	}})
+	return err
+}
+
+type MemoryUserRepository struct {
+	users memoryCollection[User]
+}
+
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{}
+}
+
+func (r *MemoryUserRepository) Insert(ctx context.Context, user User) (any, error) {
+	r.users.mu.Lock()
+	defer r.users.mu.Unlock()
+	if r.users.find(func(u User) bool { return u.Email == user.Email }) >= 0 {
+		return nil, ErrDuplicate
+	}
+	now := time.Now()
+	r.users.docs = append(r.users.docs, User{
+		ID:        primitive.NewObjectID(),
+		Email:     user.Email,
+		Password:  user.Password,
+		Role:      user.Role,
+		Verified:  user.Verified,
+		Locale:    user.Locale,
+		Status:    PENDING_STATUS,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	return r.users.docs[len(r.users.docs)-1].ID, nil
+}
+
+func (r *MemoryUserRepository) FindAll(ctx context.Context) ([]User, error) {
+	r.users.mu.Lock()
+	defer r.users.mu.Unlock()
+	return append([]User{}, r.users.docs...), nil
+}
+
+func (r *MemoryUserRepository) FindById(ctx context.Context, id string) (User, error) {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return User{}, err
+	}
+	return r.findOne(func(u User) bool { return u.ID == objectId })
+}
+
+func (r *MemoryUserRepository) FindByEmail(ctx context.Context, email string) (User, error) {
+	return r.findOne(func(u User) bool { return u.Email == email })
+}
+
+func (r *MemoryUserRepository) findOne(match func(User) bool) (User, error) {
+	r.users.mu.Lock()
+	defer r.users.mu.Unlock()
+	i := r.users.find(match)
+	if i < 0 {
+		return User{}, ErrNotFound
+	}
+	return r.users.docs[i], nil
+}
+
+func (r *MemoryUserRepository) Remove(ctx context.Context, id string) (bool, error) {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return false, err
+	}
+	r.users.mu.Lock()
+	defer r.users.mu.Unlock()
+	if i := r.users.find(func(u User) bool { return u.ID == objectId }); i >= 0 {
+		r.users.docs = append(r.users.docs[:i], r.users.docs[i+1:]...)
+	}
+	return true, nil
+}
+
+func (r *MemoryUserRepository) Update(ctx context.Context, id string, update UserUpdate) error {
+	return r.update(id, update.apply)
+}
+
+func (r *MemoryUserRepository) SetChannelEnabled(ctx context.Context, id string, channel NotificationChannel, enabled bool) error {
+	return r.update(id, func(user *User) {
+		for i, c := range user.Channels {
+			if c.Type == channel.Type && c.Target == channel.Target {
+				// the users found before keep their channels
+				user.Channels = append([]NotificationChannel{}, user.Channels...)
+				user.Channels[i].Enabled = enabled
+				user.UpdatedAt = time.Now()
+				return
+			}
+		}
+	})
+}
+
+func (r *MemoryUserRepository) update(id string, apply func(user *User)) error {
+	objectId, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return err
 	}
+	r.users.mu.Lock()
+	defer r.users.mu.Unlock()
+	if i := r.users.find(func(u User) bool { return u.ID == objectId }); i >= 0 {
+		apply(&r.users.docs[i])
+	}
 	return nil
 }
 
+// NotificationChannels returns the channels of the user, their email when
+// they did not set any.
+func (u User) NotificationChannels() []NotificationChannel {
+	if len(u.Channels) > 0 {
+		return u.Channels
+	}
+	return []NotificationChannel{{Type: CHANNEL_EMAIL, Target: u.Email, Enabled: true, Verified: u.Verified}}
+}
+
+// OwnsAddress tells whether the address is the verified email of the user.
+func (u User) OwnsAddress(address string) bool {
+	return u.Verified && strings.EqualFold(address, u.Email)
+}
+
+// Location is the timezone of the user.
+func (u User) Location() *time.Location {
+	if u.Timezone == "" {
+		return loadLocation(DEFAULT_TIMEZONE)
+	}
+	return loadLocation(u.Timezone)
+}
+
+// loadLocation is UTC when the timezone is unknown.
+func loadLocation(name string) *time.Location {
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// Quiet tells whether now is in the quiet hours of the user.
+func (u User) Quiet(now time.Time) bool {
+	start, errStart := time.Parse("15:04", u.QuietStart)
+	end, errEnd := time.Parse("15:04", u.QuietEnd)
+	if errStart != nil || errEnd != nil || start.Equal(end) {
+		return false
+	}
+	local := now.In(u.Location())
+	minute := local.Hour()*60 + local.Minute()
+	from, to := start.Hour()*60+start.Minute(), end.Hour()*60+end.Minute()
+	if from < to {
+		return minute >= from && minute < to
+	}
+	// the quiet hours go past midnight
+	return minute >= from || minute < to
+}
+
+// Instant tells whether an alert is sent right away rather than waiting for
+// a digest.
+func (u User) Instant(now time.Time) bool {
+	return (u.Digest == "" || u.Digest == DIGEST_INSTANT) && !u.Quiet(now)
+}
+
+// DigestDue tells whether the alerts waiting for the user can be sent: an
+// hour after the last digest for hourly, once a day from digestHour in the
+// timezone of the user for daily, and outside of the quiet hours.
+func (u User) DigestDue(now time.Time, digestHour int) bool {
+	if u.Quiet(now) {
+		return false
+	}
+	switch u.Digest {
+	case DIGEST_HOURLY:
+		return now.Sub(u.LastDigestAt) >= time.Hour
+	case DIGEST_DAILY:
+		local := now.In(u.Location())
+		today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+		return local.Hour() >= digestHour && u.LastDigestAt.Before(today)
+	}
+	// instant alerts held back by the quiet hours
+	return true
+}
+
 type UserService struct {
 	repository UserRepository
 }
@@ -144,8 +477,12 @@ func (s *UserService) FindByEmail(ctx context.Context, email string) (User, erro
 	return s.repository.FindByEmail(ctx, email)
 }
 
-func (s *UserService) Update(ctx context.Context, id string, user bson.M) error {
-	return s.repository.Update(ctx, id, user)
+func (s *UserService) Update(ctx context.Context, id string, update UserUpdate) error {
+	return s.repository.Update(ctx, id, update)
+}
+
+func (s *UserService) SetChannelEnabled(ctx context.Context, id string, channel NotificationChannel, enabled bool) error {
+	return s.repository.SetChannelEnabled(ctx, id, channel, enabled)
 }
 
 func (s *UserService) FindById(ctx context.Context, id string) (User, error) {
@@ -0,0 +1,50 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUserQuiet(t *testing.T) {
+	user := User{Timezone: "Asia/Ho_Chi_Minh", QuietStart: "22:00", QuietEnd: "07:00"}
+	for hour, want := range map[int]bool{
+		// UTC hours, the user is 7 hours ahead
+		14: false,
+		15: true,
+		23: true,
+		0:  false,
+		3:  false,
+	} {
+		now := time.Date(2024, time.March, 5, hour, 0, 0, 0, time.UTC)
+		if got := user.Quiet(now); got != want {
+			t.Errorf("Quiet at %d:00 UTC = %v, want %v", hour, got, want)
+		}
+	}
+	if (User{}).Quiet(time.Now()) {
+		t.Error("no quiet hours by default")
+	}
+}
+
+func TestUserDigestDue(t *testing.T) {
+	// 9:00 in Ho Chi Minh City
+	now := time.Date(2024, time.March, 5, 2, 0, 0, 0, time.UTC)
+	daily := User{Digest: DIGEST_DAILY}
+	if !daily.DigestDue(now, 8) {
+		t.Error("the first daily digest is due")
+	}
+	daily.LastDigestAt = now.Add(-time.Hour)
+	if daily.DigestDue(now, 8) {
+		t.Error("the daily digest was sent today")
+	}
+	if daily.DigestDue(now.Add(-2*time.Hour), 8) {
+		t.Error("the daily digest is not due before the digest hour")
+	}
+
+	hourly := User{Digest: DIGEST_HOURLY, LastDigestAt: now.Add(-30 * time.Minute)}
+	if hourly.DigestDue(now, 8) || !hourly.DigestDue(now.Add(30*time.Minute), 8) {
+		t.Error("the hourly digest is due an hour after the last one")
+	}
+	if !(User{}).Instant(now) || hourly.Instant(now) {
+		t.Error("only instant users get alerts right away")
+	}
+}
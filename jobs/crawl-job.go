@@ -2,259 +2,118 @@ package jobs
 
 import (
 	"context"
-	"fmt"
-	"log"
+	"errors"
 	"strconv"
-	"sync"
 	"time"
 
 	"github.com/bonnguyenitc/shopee-stracks/back-end-go/crawl"
 	"github.com/bonnguyenitc/shopee-stracks/back-end-go/database"
-	"github.com/bonnguyenitc/shopee-stracks/back-end-go/templates"
-	"github.com/bonnguyenitc/shopee-stracks/back-end-go/utils"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/logs"
+	"github.com/sirupsen/logrus"
 )
 
-func crawlShop() {
-	// get all shop
-	shopService := database.NewShopService(database.NewMongoShopRepository(database.MongoDB.Collection(database.ShopCollectionName)))
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	shops, err := shopService.FindAll(ctx)
+// crawlShop fetches the products of one shop, records the price of the
+// products we know and schedules the next crawl of the shop.
+func crawlShop(ctx context.Context, shopId int64) error {
+	idString := strconv.FormatInt(shopId, 10)
+	source, err := crawl.DefaultSource()
 	if err != nil {
-		return
+		return err
 	}
-	for _, shop := range shops {
-		shopId := shop.ShopID
-		idString := strconv.FormatInt(shopId, 10)
-		products, err := crawl.GetProductsByShopID(idString)
+	products, err := source.FetchShopProducts(ctx, idString)
 
-		if err != nil {
-			fmt.Println(err)
-			continue
-		}
-
-		if len(products) == 0 {
-			continue
-		}
-
-		priceService := database.NewPriceService(database.NewMongoPriceRepository(database.MongoDB.Collection(database.PriceCollectionName)))
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-
-		for _, product := range products {
-			// check product exist in database
-			productService := database.NewProductService(database.NewMongoProductRepository(database.MongoDB.Collection(database.ProductCollectionName)))
-			prod, err := productService.FindByIdShopee(ctx, product.IDShopee)
-			if err != nil {
-				continue
-			}
-			now := time.Now()
-			startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
-			endOfDay := startOfDay.Add(24 * time.Hour)
-
-			//
-			p, err := priceService.FindOneByFilter(ctx, bson.M{
-				"product.$id": prod.ID,
-				"created_at":  bson.M{"$gte": startOfDay, "$lt": endOfDay},
-			})
-
-			if err != nil {
-				// insert product to database
-				_, err := priceService.Insert(ctx, database.Price{
-					ProductID:              prod.ID,
-					Stock:                  product.Stock,
-					Sold:                   product.Sold,
-					HistoricalSold:         product.HistoricalSold,
-					LikedCount:             product.LikedCount,
-					CmtCount:               product.CmtCount,
-					Price:                  product.Price,
-					PriceMin:               product.PriceMin,
-					PriceMax:               product.PriceMax,
-					PriceMinBeforeDiscount: product.PriceMinBeforeDiscount,
-					PriceMaxBeforeDiscount: product.PriceMaxBeforeDiscount,
-					PriceBeforeDiscount:    product.PriceBeforeDiscount,
-					RawDiscount:            product.RawDiscount,
-				})
-				if err != nil {
-					continue
-				}
-			} else {
-				// update product to database
-				_, err := priceService.Update(ctx, p.ID.Hex(), database.Price{
-					Stock:                  product.Stock,
-					Sold:                   product.Sold,
-					HistoricalSold:         product.HistoricalSold,
-					LikedCount:             product.LikedCount,
-					CmtCount:               product.CmtCount,
-					Price:                  product.Price,
-					PriceMin:               product.PriceMin,
-					PriceMax:               product.PriceMax,
-					PriceMinBeforeDiscount: product.PriceMinBeforeDiscount,
-					PriceMaxBeforeDiscount: product.PriceMaxBeforeDiscount,
-					PriceBeforeDiscount:    product.PriceBeforeDiscount,
-					RawDiscount:            product.RawDiscount,
-				})
-				if err != nil {
-					continue
-				}
-			}
-		}
-	}
-}
-
-func notifyPriceChangeJob() {
-	// get all tracking
-	trackingService := database.NewTrackingService(database.NewMongoTrackingRepository(database.MongoDB.Collection(database.TrackingCollectionName)))
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	trackings, err := trackingService.FindAll(ctx, 20, 1)
-
-	if err != nil {
-		return
+	if err != nil && !crawl.IsPartial(err) {
+		return errors.Join(err, scheduleRetryCrawl(ctx, shopId))
 	}
 
-	trackingsPassed := utils.Filter[database.Tracking](trackings.Data, func(tracking database.Tracking) bool {
-		return tracking.Status
-	})
-
-	for _, tracking := range trackingsPassed {
-		// get all price
-		priceService := database.NewPriceService(database.NewMongoPriceRepository(database.MongoDB.Collection(database.PriceCollectionName)))
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-
-		productID := tracking.Product.Map()["$id"].(primitive.ObjectID)
-		prices, err := priceService.FindByProductID(ctx, productID)
+	priceService := database.NewPriceService(database.Repos.Prices)
+	productService := database.NewProductService(database.Repos.Products)
 
+	changed, known, recorded := 0, 0, 0
+	var recordErr error
+	for _, product := range products {
+		// check product exist in database
+		prod, err := productService.FindByIdShopee(ctx, product.IDShopee)
 		if err != nil {
 			continue
 		}
 
-		if len(prices) <= 1 {
+		// every change is kept, so short flash sales show in the history
+		latest, written, err := priceService.Record(ctx, database.Price{
+			ProductID:              prod.ID,
+			Stock:                  product.Stock,
+			Sold:                   product.Sold,
+			HistoricalSold:         product.HistoricalSold,
+			LikedCount:             product.LikedCount,
+			CmtCount:               product.CmtCount,
+			Price:                  product.Price,
+			PriceMin:               product.PriceMin,
+			PriceMax:               product.PriceMax,
+			PriceMinBeforeDiscount: product.PriceMinBeforeDiscount,
+			PriceMaxBeforeDiscount: product.PriceMaxBeforeDiscount,
+			PriceBeforeDiscount:    product.PriceBeforeDiscount,
+			RawDiscount:            product.RawDiscount,
+		})
+		if err != nil {
+			logs.LogWarning(logrus.Fields{
+				"product": prod.ID.Hex(),
+				"data":    err.Error(),
+			}, "record crawled price")
+			recordErr = err
 			continue
 		}
-
-		// compare price
-		// get all condition per condition
-		conditionService := database.NewTrackingConditionService(database.NewMongoTrackingConditionRepository(database.MongoDB.Collection(database.TrackingConditionCollectionName)))
-
-		var wg sync.WaitGroup
-
-		wg.Add(1)
-		go func() {
-			// for less than
-			ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
-			defer cancel()
-			conditions, err := conditionService.FindAllByFilterWithUser(ctx, bson.M{
-				"tracking":  bson.D{{Key: "$ref", Value: database.TrackingCollectionName}, {Key: "$id", Value: tracking.ID}},
-				"condition": database.LESS_THAN,
-				"active":    true,
-			})
-
-			if err != nil {
-				wg.Done()
-				return
-			}
-			latestPrice := prices[0]
-			previousPrice := prices[1]
-			// check condition for less than
-			if latestPrice.Price < previousPrice.Price {
-				// send email to user if price less than condition
-				for _, condition := range conditions {
-					email := condition.UserInfo[0].Email
-					url := condition.TrackingInfo[0].ShopeeUrl
-					log.Println(utils.SendEmail(email, templates.CreateEmailNotifyPriceTemplate(templates.InfoEmailNotifyPrice{
-						Email:         email,
-						Price:         latestPrice.Price,
-						PricePrevious: previousPrice.Price,
-						Title:         "Notify price",
-						LinkProduct:   url,
-					})))
-				}
+		recorded++
+		// keep the latest crawl on the product for the products list
+		if _, err = productService.Update(ctx, prod.ID.Hex(), product); err != nil {
+			logs.LogWarning(logrus.Fields{
+				"product": prod.ID.Hex(),
+				"data":    err.Error(),
+			}, "update crawled product")
+		}
+		if !latest.ID.IsZero() {
+			known++
+			if written {
+				changed++
 			}
-			wg.Done()
-		}()
+		}
+	}
 
-		wg.Add(1)
-		go func() {
-			// for greater than
-			ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
-			defer cancel()
-			conditions, err := conditionService.FindAllByFilter(ctx, bson.M{
-				"tracking":  bson.D{{Key: "$ref", Value: database.TrackingCollectionName}, {Key: "$id", Value: tracking.ID}},
-				"condition": database.GREATER_THAN,
-				"active":    true,
-			})
-			if err != nil {
-				wg.Done()
-				return
-			}
-			latestPrice := prices[0]
-			previousPrice := prices[1]
-			// check condition for greater than
-			if latestPrice.Price > previousPrice.Price {
-				// send email to user if price greater than condition
-				for _, condition := range conditions {
-					email := condition.UserInfo[0].Email
-					url := condition.TrackingInfo[0].ShopeeUrl
-					log.Println(utils.SendEmail(email, templates.CreateEmailNotifyPriceTemplate(templates.InfoEmailNotifyPrice{
-						Email:         email,
-						Price:         latestPrice.Price,
-						PricePrevious: previousPrice.Price,
-						Title:         "Notify price",
-						LinkProduct:   url,
-					})))
-				}
-			}
-			wg.Done()
-		}()
+	// not a single price was kept, the crawl is retried like a failed fetch
+	if recordErr != nil && recorded == 0 {
+		return errors.Join(recordErr, scheduleRetryCrawl(ctx, shopId))
+	}
+	return scheduleNextCrawl(ctx, shopId, changed, known)
+}
 
-		wg.Add(1)
-		go func() {
-			// for equal
-			ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
-			defer cancel()
-			conditions, err := conditionService.FindAllByFilter(ctx, bson.M{
-				"tracking":  bson.D{{Key: "$ref", Value: database.TrackingCollectionName}, {Key: "$id", Value: tracking.ID}},
-				"condition": database.EQUAL,
-				"active":    true,
-			})
-			if err != nil {
-				wg.Done()
-				return
-			}
-			latestPrice := prices[0]
-			// check condition for equal
-			for _, condition := range conditions {
-				if latestPrice.Price <= condition.Price {
-					// send email to user if price equal condition
-					email := condition.UserInfo[0].Email
-					url := condition.TrackingInfo[0].ShopeeUrl
-					log.Println(utils.SendEmail(email, templates.CreateEmailNotifyPriceTemplate(templates.InfoEmailNotifyPrice{
-						Email:         email,
-						Price:         latestPrice.Price,
-						PricePrevious: latestPrice.Price,
-						Title:         "Notify price",
-						LinkProduct:   url,
-					})))
-				}
-			}
-			wg.Done()
-		}()
-		// wait for all goroutine done
-		wg.Wait()
-		// END
+// scheduleRetryCrawl records a failed crawl of a shop we know, so the
+// scheduler waits for the backoff before queuing it again.
+func scheduleRetryCrawl(ctx context.Context, shopId int64) error {
+	shopService := database.NewShopService(database.Repos.Shops)
+	shop, err := shopService.FindByShopShopeeId(ctx, shopId)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
 	}
+	failures := shop.CrawlFailures + 1
+	return shopService.RecordCrawlFailure(ctx, shop.ID, failures, time.Now().Add(crawlFailureBackoff(failures)))
 }
 
-func RunCronJobs() {
-	go func() {
-		for {
-			crawlShop()
-			notifyPriceChangeJob()
-			<-time.After(10 * time.Minute)
-		}
-	}()
+// scheduleNextCrawl records the crawl of a shop we know.
+func scheduleNextCrawl(ctx context.Context, shopId int64, changed int, known int) error {
+	shopService := database.NewShopService(database.Repos.Shops)
+	shop, err := shopService.FindByShopShopeeId(ctx, shopId)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	interval := time.Duration(shop.CrawlInterval) * time.Second
+	if interval == 0 {
+		interval = crawlInterval(shop.Priority)
+	}
+	now := time.Now()
+	return shopService.RecordCrawl(ctx, shop.ID, now, now.Add(interval), nextVolatility(shop.Volatility, changed, known))
 }
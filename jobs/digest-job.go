@@ -0,0 +1,155 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/database"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/logs"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/notify"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/templates"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// digestHour is the hour of the day the daily digests are sent at, in the
+// timezone of each user, DIGEST_HOUR overrides it.
+func digestHour() int {
+	if hour, err := strconv.Atoi(os.Getenv("DIGEST_HOUR")); err == nil && hour >= 0 && hour < 24 {
+		return hour
+	}
+	return 8
+}
+
+// digestLimit is the most alerts in one digest, the rest wait for the next.
+const digestLimit = 200
+
+// sendDigests sends the alerts waiting for a digest to the users whose
+// digest is due, one message per channel. Only the alerts of the due users
+// are loaded, so the users waiting for a later digest hold no one back.
+func sendDigests(ctx context.Context) error {
+	notificationService := database.NewNotificationService(database.Repos.Notifications)
+	userService := database.NewUserService(database.Repos.Users)
+
+	userIDs, err := notificationService.FindDigestUsers(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	hour := digestHour()
+	notifiers := notify.DefaultNotifiers().WithOutbox(newEmailService())
+	for _, userID := range userIDs {
+		user, err := userService.FindById(ctx, userID.Hex())
+		if err != nil {
+			logs.LogWarning(logrus.Fields{"user": userID.Hex(), "data": err.Error()}, "digest user")
+			continue
+		}
+		if !user.DigestDue(now, hour) {
+			continue
+		}
+		alerts, err := notificationService.FindDigestByUser(ctx, userID, digestLimit)
+		if err != nil {
+			return err
+		}
+		err = sendDigest(ctx, notificationService, notifiers, user, alerts)
+		if err != nil {
+			// the digest is due again on the next run, with the alerts kept
+			logs.LogWarning(logrus.Fields{"user": userID.Hex(), "data": err.Error()}, "send digest")
+			continue
+		}
+		err = userService.Update(ctx, userID.Hex(), database.UserUpdate{LastDigestAt: &now})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendDigest sends the alerts of the user on the channels they were made
+// for.
+func sendDigest(ctx context.Context, notificationService *database.NotificationService, notifier notify.Notifier, user database.User, alerts []database.Notification) error {
+	byChannel := map[string][]database.Notification{}
+	for _, alert := range alerts {
+		byChannel[alert.Channel] = append(byChannel[alert.Channel], alert)
+	}
+
+	var errs []error
+	for _, channel := range user.NotificationChannels() {
+		channelAlerts, ok := byChannel[channel.Type]
+		if !ok {
+			continue
+		}
+		delete(byChannel, channel.Type)
+		ids := notificationIDs(channelAlerts)
+		if !channel.Reachable() {
+			errs = append(errs, notificationService.UpdateStatusMany(ctx, ids, database.NOTIFICATION_FAILED, "channel disabled or not verified"))
+			continue
+		}
+
+		message, err := digestMessage(user, channelAlerts)
+		if err == nil {
+			err = notifier.Notify(ctx, channel, message)
+		}
+		if errors.Is(err, notify.ErrGone) {
+			errs = append(errs, notificationService.UpdateStatusMany(ctx, ids, database.NOTIFICATION_FAILED, err.Error()))
+			errs = append(errs, disableGoneChannel(ctx, user, channel, err))
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", channel.Type, err))
+			errs = append(errs, notificationService.RetryDigest(ctx, ids, err.Error()))
+			continue
+		}
+		errs = append(errs, notificationService.UpdateStatusMany(ctx, ids, database.NOTIFICATION_SENT, ""))
+	}
+	// the user removed the channel since
+	for _, channelAlerts := range byChannel {
+		errs = append(errs, notificationService.UpdateStatusMany(ctx, notificationIDs(channelAlerts), database.NOTIFICATION_FAILED, "channel removed"))
+	}
+	return errors.Join(errs...)
+}
+
+// digestMessage groups the alerts in one message, the biggest drop first.
+func digestMessage(user database.User, alerts []database.Notification) (notify.Message, error) {
+	items := make([]templates.DigestItem, len(alerts))
+	for i, alert := range alerts {
+		items[i] = templates.DigestItem{
+			ProductName:   alert.ProductName,
+			ProductImage:  alert.ProductImage,
+			LinkProduct:   alert.Link,
+			Price:         alert.Price,
+			PricePrevious: alert.PricePrevious,
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Change() < items[j].Change()
+	})
+	email, err := templates.CreateEmailDigestTemplate(templates.InfoEmailDigest{
+		Locale: templates.Locale(user.Locale),
+		Email:  user.Email,
+		Items:  items,
+	})
+	if err != nil {
+		return notify.Message{}, err
+	}
+	return notify.Message{
+		Title: email.Subject,
+		Text:  email.Text,
+		HTML:  email.HTML,
+		Data:  items,
+	}, nil
+}
+
+func notificationIDs(notifications []database.Notification) []primitive.ObjectID {
+	ids := make([]primitive.ObjectID, len(notifications))
+	for i, notification := range notifications {
+		ids[i] = notification.ID
+	}
+	return ids
+}
@@ -0,0 +1,74 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/database"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/logs"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/notify"
+	"github.com/sirupsen/logrus"
+)
+
+// emailRateLimit is how many emails a recipient gets per hour at most,
+// EMAIL_RATE_LIMIT overrides it.
+func emailRateLimit() int64 {
+	if limit, err := strconv.ParseInt(os.Getenv("EMAIL_RATE_LIMIT"), 10, 64); err == nil && limit > 0 {
+		return limit
+	}
+	return 10
+}
+
+func newEmailService() *database.EmailService {
+	return database.NewEmailService(database.Repos.Emails)
+}
+
+// sendEmails sends the due messages of the outbox until there are none left,
+// for a few minutes at most so the job fits in its lease. owner leases the
+// messages so that two senders never send the same one.
+func sendEmails(ctx context.Context, owner string) error {
+	outbox := newEmailService()
+	sender := notify.NewEmailNotifierFromEnv()
+	limit := emailRateLimit()
+	stopAt := time.Now().Add(3 * time.Minute)
+	for time.Now().Before(stopAt) {
+		email, err := outbox.Lease(ctx, owner, 2*time.Minute)
+		if errors.Is(err, database.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		sent, err := outbox.CountSentSince(ctx, email.To, time.Now().Add(-time.Hour))
+		if err != nil {
+			return err
+		}
+		if sent >= limit {
+			if err := outbox.Defer(ctx, email.ID, owner, time.Now().Add(10*time.Minute)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		sendErr := sender.Send(ctx, email.To, notify.Message{Title: email.Subject, HTML: email.HTML, Text: email.Text})
+		if sendErr == nil {
+			err = outbox.MarkSent(ctx, email.ID, owner)
+		} else {
+			logs.LogWarning(logrus.Fields{
+				"email":    email.ID.Hex(),
+				"kind":     email.Kind,
+				"attempts": email.Attempts,
+				"data":     sendErr.Error(),
+			}, "send email")
+			err = outbox.Fail(ctx, email, owner, sendErr, notify.IsPermanent(sendErr))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
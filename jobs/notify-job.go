@@ -0,0 +1,351 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/database"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/logs"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/notify"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/templates"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// defaultCooldown is the least time between two notifications of a
+// condition, NOTIFY_COOLDOWN overrides it.
+func defaultCooldown() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("NOTIFY_COOLDOWN")); err == nil {
+		return d
+	}
+	return 6 * time.Hour
+}
+
+// notifyPriceChange checks the conditions of every active tracking against
+// the latest prices and notifies the users whose condition is met.
+func notifyPriceChange(ctx context.Context) error {
+	trackingService := database.NewTrackingService(database.Repos.Trackings)
+	priceService := database.NewPriceService(database.Repos.Prices)
+	conditionService := database.NewTrackingConditionService(database.Repos.TrackingConditions)
+	notificationService := database.NewNotificationService(database.Repos.Notifications)
+	productService := database.NewProductService(database.Repos.Products)
+	subscriptionService := database.NewTrackingSubscriptionService(database.Repos.TrackingSubscriptions)
+
+	trackings, err := trackingService.FindActive(ctx)
+	if err != nil {
+		return err
+	}
+	// emails go through the outbox so they are retried
+	notifiers := notify.DefaultNotifiers().WithOutbox(newEmailService())
+
+	for _, tracking := range trackings {
+		productID, ok := tracking.Product.Map()["$id"].(primitive.ObjectID)
+		if !ok {
+			continue
+		}
+		// only the users tracking the product get its alerts
+		userIDs, err := subscriptionService.FindUserIDs(ctx, tracking.ID)
+		if err != nil {
+			logTrackingError(tracking, err, "find tracking subscribers")
+			continue
+		}
+		if len(userIDs) == 0 {
+			continue
+		}
+		subscribers := map[primitive.ObjectID]bool{}
+		for _, userID := range userIDs {
+			subscribers[userID] = true
+		}
+		prices, err := priceService.FindRecent(ctx, productID, 2)
+		if err != nil {
+			logTrackingError(tracking, err, "find recent prices")
+			continue
+		}
+		if len(prices) <= 1 {
+			continue
+		}
+
+		// check every active condition of the tracking
+		conditions, err := conditionService.FindAllWithUser(ctx, database.TrackingConditionQuery{
+			TrackingID: tracking.ID,
+			ActiveOnly: true,
+		})
+		if err != nil {
+			logTrackingError(tracking, err, "find tracking conditions")
+			continue
+		}
+		latestPrice := prices[0]
+		previousPrice := prices[1]
+		// only loaded when an alert is sent
+		product := sync.OnceValue(func() productDetails {
+			return findProductDetails(ctx, productService, priceService, productID)
+		})
+		for _, condition := range conditions {
+			if len(condition.UserInfo) == 0 || len(condition.TrackingInfo) == 0 || !subscribers[condition.UserInfo[0].ID] {
+				continue
+			}
+			// an all-time low counts from when the user started tracking
+			since := condition.CreatedAt
+			if condition.Condition == database.ALL_TIME_LOW {
+				subscription, err := subscriptionService.Find(ctx, condition.UserInfo[0].ID, tracking.ID)
+				if err != nil {
+					logTrackingError(tracking, err, "find tracking subscription")
+					continue
+				}
+				since = subscription.CreatedAt
+			}
+			history := priceHistory(ctx, priceService, productID, condition, since, latestPrice, previousPrice)
+			err := notifyCondition(ctx, conditionService, notificationService, notifiers, condition, history, product)
+			if err != nil {
+				logs.LogWarning(logrus.Fields{
+					"condition": condition.ID,
+					"data":      err.Error(),
+				}, "notify condition")
+			}
+		}
+	}
+	return nil
+}
+
+// logTrackingError logs what failed for one tracking, the others are still
+// checked.
+func logTrackingError(tracking database.Tracking, err error, message string) {
+	logs.LogWarning(logrus.Fields{
+		"tracking": tracking.ID.Hex(),
+		"data":     err.Error(),
+	}, message)
+}
+
+// notifyCondition sends the notification of a met condition once per price
+// event, keeps to its cool-down and re-arms it once it is not met anymore.
+func notifyCondition(ctx context.Context, conditionService *database.TrackingConditionService, notificationService *database.NotificationService, notifier notify.Notifier, condition database.TrackingCondition, history database.PriceHistory, product func() productDetails) error {
+	conditionID, err := primitive.ObjectIDFromHex(condition.ID)
+	if err != nil {
+		return err
+	}
+
+	if !condition.Met(history) {
+		if condition.Fired {
+			return conditionService.SetFired(ctx, conditionID, false)
+		}
+		return nil
+	}
+	// the price did not move back past the threshold since the last alert
+	if condition.Level() && condition.Fired {
+		return nil
+	}
+
+	cooldown := defaultCooldown()
+	if condition.CooldownMinutes > 0 {
+		cooldown = time.Duration(condition.CooldownMinutes) * time.Minute
+	}
+	inCooldown, err := notificationService.InCooldown(ctx, conditionID, cooldown)
+	if err != nil || inCooldown {
+		return err
+	}
+
+	user := condition.UserInfo[0]
+	details := product()
+	message, err := priceMessage(user, condition, history, details)
+	if err != nil {
+		return err
+	}
+	alert := alertNotification(conditionID, condition, history, details)
+	// outside of instant delivery the alert waits for the digest of the user
+	instant := user.Instant(time.Now())
+	var errs []error
+	sent := false
+	for _, channel := range user.NotificationChannels() {
+		if !channel.Accepts(condition.Condition) {
+			continue
+		}
+		ok, err := notifyChannel(ctx, notificationService, notifier, alert, channel, message, instant)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", channel.Type, err))
+		}
+		errs = append(errs, disableGoneChannel(ctx, user, channel, err))
+		sent = sent || ok
+	}
+	if sent {
+		errs = append(errs, conditionService.SetFired(ctx, conditionID, true))
+	}
+	return errors.Join(errs...)
+}
+
+// alertNotification is the notification of a met condition, before it is
+// given a channel.
+func alertNotification(conditionID primitive.ObjectID, condition database.TrackingCondition, history database.PriceHistory, details productDetails) database.Notification {
+	userID, _ := condition.User.Map()["$id"].(primitive.ObjectID)
+	trackingID, _ := condition.Tracking.Map()["$id"].(primitive.ObjectID)
+	notification := database.Notification{
+		ConditionID:   conditionID,
+		UserID:        userID,
+		TrackingID:    trackingID,
+		PriceID:       history.Latest.ID,
+		Price:         history.Latest.Price,
+		PricePrevious: history.Previous.Price,
+		Condition:     condition.Condition,
+		ProductName:   details.Name,
+		Link:          condition.TrackingInfo[0].ShopeeUrl,
+		Discount:      float64(history.Latest.RawDiscount),
+	}
+	if len(details.Images) > 0 {
+		notification.ProductImage = details.Images[0]
+	}
+	return notification
+}
+
+// notificationStale is how long a notification can stay pending before it is
+// taken for dead and sent again, longer than a job lease.
+const notificationStale = 10 * time.Minute
+
+// notifyChannel sends the message on one channel of the user, once per price
+// event, or queues it for the digest when it is not instant. A message that
+// failed, or was left pending by a worker that died, is sent again by the
+// next run while the price event is the latest. It returns whether the
+// message was sent or queued.
+func notifyChannel(ctx context.Context, notificationService *database.NotificationService, notifier notify.Notifier, notification database.Notification, channel database.NotificationChannel, message notify.Message, instant bool) (bool, error) {
+	notification.Channel = channel.Type
+	if !instant {
+		notification.Status = database.NOTIFICATION_DIGEST
+	}
+	inserted, err := notificationService.Insert(ctx, notification)
+	if database.IsDuplicate(err) && instant {
+		inserted, err = notificationService.Reclaim(ctx, notification, time.Now().Add(-notificationStale))
+	}
+	// this price event was already handled on this channel
+	if database.IsDuplicate(err) || errors.Is(err, database.ErrNotFound) {
+		return false, nil
+	}
+	notification = inserted
+	if err != nil {
+		return false, err
+	}
+	if !instant {
+		return true, nil
+	}
+
+	sendErr := notifier.Notify(ctx, channel, message)
+	if sendErr != nil {
+		err := notificationService.UpdateStatus(ctx, notification.ID, database.NOTIFICATION_FAILED, sendErr.Error())
+		return false, errors.Join(sendErr, err)
+	}
+	return true, notificationService.UpdateStatus(ctx, notification.ID, database.NOTIFICATION_SENT, "")
+}
+
+// disableGoneChannel turns off the channel of the user when it does not
+// exist anymore, e.g. an expired push subscription.
+func disableGoneChannel(ctx context.Context, user database.User, channel database.NotificationChannel, err error) error {
+	if !errors.Is(err, notify.ErrGone) || len(user.Channels) == 0 {
+		return nil
+	}
+	userService := database.NewUserService(database.Repos.Users)
+	return userService.SetChannelEnabled(ctx, user.ID.Hex(), channel, false)
+}
+
+// priceMessage is the alert of a met condition, in the language of the user.
+func priceMessage(user database.User, condition database.TrackingCondition, history database.PriceHistory, product productDetails) (notify.Message, error) {
+	tracking := condition.TrackingInfo[0]
+	link := tracking.ShopeeUrl
+	info := templates.InfoEmailNotifyPrice{
+		Locale:        templates.Locale(user.Locale),
+		Email:         user.Email,
+		ProductName:   product.Name,
+		LinkProduct:   link,
+		Price:         history.Latest.Price,
+		PricePrevious: history.Previous.Price,
+		Discount:      float64(history.Latest.RawDiscount),
+		History:       product.History,
+	}
+	if len(product.Images) > 0 {
+		info.ProductImage = product.Images[0]
+	}
+	email, err := templates.CreateEmailNotifyPriceTemplate(info)
+	if err != nil {
+		return notify.Message{}, err
+	}
+	return notify.Message{
+		Title: email.Subject,
+		Text:  email.Text,
+		HTML:  email.HTML,
+		Url:   link,
+		Data: map[string]any{
+			"condition_id":   condition.ID,
+			"condition":      condition.Condition,
+			"tracking_id":    tracking.ID,
+			"product_name":   product.Name,
+			"price":          history.Latest.Price,
+			"price_previous": history.Previous.Price,
+			"created_at":     history.Latest.CreatedAt,
+		},
+	}, nil
+}
+
+// productDetails is what the alerts show of the product.
+type productDetails struct {
+	database.Product
+	// History is the last days of prices, the oldest first
+	History []templates.HistoryPoint
+}
+
+// findProductDetails loads the product and its prices of the last week. The
+// alert is still sent without them when they can not be loaded.
+func findProductDetails(ctx context.Context, productService *database.ProductService, priceService *database.PriceService, productID primitive.ObjectID) productDetails {
+	details := productDetails{}
+	details.Product, _ = productService.FindById(ctx, productID)
+	// today and the 6 days before it
+	now := time.Now()
+	buckets, err := priceService.Rollup(ctx, productID, now.AddDate(0, 0, -6), now, database.RESOLUTION_DAY, 7, 1)
+	if err != nil {
+		return details
+	}
+	for _, bucket := range buckets.Data {
+		details.History = append(details.History, templates.HistoryPoint{
+			Date:    bucket.Start,
+			Lowest:  bucket.Min,
+			Highest: bucket.Max,
+			Closing: bucket.Last,
+		})
+	}
+	return details
+}
+
+// priceHistory fills what the condition needs beyond the latest two prices,
+// the all-time low is looked for since since.
+func priceHistory(ctx context.Context, priceService *database.PriceService, productID primitive.ObjectID, condition database.TrackingCondition, since time.Time, latest database.Price, previous database.Price) database.PriceHistory {
+	history := database.PriceHistory{Latest: latest, Previous: previous}
+	switch condition.Condition {
+	case database.PERCENT_DROP_WINDOW:
+		prices := pricesSince(ctx, priceService, productID, latest.CreatedAt.Add(-condition.Window()), latest.CreatedAt)
+		for _, price := range prices {
+			if price.Price > history.WindowHigh {
+				history.WindowHigh = price.Price
+			}
+		}
+	case database.ALL_TIME_LOW:
+		prices := pricesSince(ctx, priceService, productID, since, latest.CreatedAt)
+		for _, price := range prices {
+			if price.Price > 0 && (history.LowSince == 0 || price.Price < history.LowSince) {
+				history.LowSince = price.Price
+			}
+		}
+	}
+	return history
+}
+
+// pricesSince returns the price in effect at from and the points after it,
+// to excluded.
+func pricesSince(ctx context.Context, priceService *database.PriceService, productID primitive.ObjectID, from time.Time, to time.Time) []database.Price {
+	prices, err := priceService.FindRange(ctx, productID, from, to)
+	if err != nil {
+		return nil
+	}
+	if start, err := priceService.FindAt(ctx, productID, from); err == nil && start.CreatedAt.Before(from) {
+		prices = append(prices, start)
+	}
+	return prices
+}
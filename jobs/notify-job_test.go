@@ -0,0 +1,112 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/database"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/notify"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// countingNotifier records the messages it is given.
+type countingNotifier struct {
+	sent int
+}
+
+func (n *countingNotifier) Notify(ctx context.Context, channel database.NotificationChannel, message notify.Message) error {
+	n.sent++
+	return nil
+}
+
+func TestNotifyCondition(t *testing.T) {
+	ctx := context.Background()
+	// only the cool-down a condition sets applies
+	t.Setenv("NOTIFY_COOLDOWN", "0s")
+	repos := database.NewMemoryRepositories()
+	conditionService := database.NewTrackingConditionService(repos.TrackingConditions)
+	notificationService := database.NewNotificationService(repos.Notifications)
+
+	id, _ := repos.Users.Insert(ctx, database.User{Email: "a@example.com", Password: "secret"})
+	userID := id.(primitive.ObjectID)
+	repos.Users.Update(ctx, userID.Hex(), database.UserUpdate{Channels: &[]database.NotificationChannel{
+		{Type: database.CHANNEL_WEBHOOK, Target: "https://example.com/hook", Enabled: true},
+	}})
+	id, _ = repos.Trackings.Insert(ctx, database.Tracking{IDShopee: 1, Status: true})
+	trackingID := id.(primitive.ObjectID)
+
+	newCondition := func(condition database.TrackingCondition) primitive.ObjectID {
+		condition.TrackingID, condition.UserID = trackingID, userID
+		inserted, err := repos.TrackingConditions.Insert(ctx, condition)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conditionID, _ := primitive.ObjectIDFromHex(inserted.ID)
+		return conditionID
+	}
+	point := func(price int64) database.Price {
+		return database.Price{ID: primitive.NewObjectID(), Price: price, Stock: 1}
+	}
+	// check runs the condition as it is stored against a move from the
+	// previous to the latest price and returns how many messages were sent
+	check := func(conditionID primitive.ObjectID, previous database.Price, latest database.Price) int {
+		conditions, err := conditionService.FindAllWithUser(ctx, database.TrackingConditionQuery{ID: conditionID})
+		if err != nil || len(conditions) != 1 {
+			t.Fatalf("condition %s: %v", conditionID.Hex(), err)
+		}
+		notifier := &countingNotifier{}
+		history := database.PriceHistory{Latest: latest, Previous: previous}
+		err = notifyCondition(ctx, conditionService, notificationService, notifier, conditions[0], history, func() productDetails {
+			return productDetails{}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return notifier.sent
+	}
+
+	t.Run("once per price event", func(t *testing.T) {
+		conditionID := newCondition(database.TrackingCondition{Condition: database.ANY_CHANGE})
+		first, second := point(100), point(90)
+		if sent := check(conditionID, first, second); sent != 1 {
+			t.Fatalf("first alert sent %d messages, want 1", sent)
+		}
+		if sent := check(conditionID, first, second); sent != 0 {
+			t.Errorf("the same price point alerted again")
+		}
+		if sent := check(conditionID, second, point(80)); sent != 1 {
+			t.Errorf("a new price point sent %d messages, want 1", sent)
+		}
+	})
+
+	t.Run("cool-down", func(t *testing.T) {
+		conditionID := newCondition(database.TrackingCondition{Condition: database.ANY_CHANGE, CooldownMinutes: 60})
+		first, second := point(100), point(90)
+		if sent := check(conditionID, first, second); sent != 1 {
+			t.Fatalf("first alert sent %d messages, want 1", sent)
+		}
+		if sent := check(conditionID, second, point(80)); sent != 0 {
+			t.Errorf("a new price point alerted within the cool-down")
+		}
+	})
+
+	t.Run("re-arming", func(t *testing.T) {
+		conditionID := newCondition(database.TrackingCondition{Condition: database.TARGET_PRICE, Price: 100})
+		if sent := check(conditionID, point(120), point(90)); sent != 1 {
+			t.Fatalf("first alert sent %d messages, want 1", sent)
+		}
+		if sent := check(conditionID, point(90), point(95)); sent != 0 {
+			t.Errorf("a fired level condition alerted while still met")
+		}
+		if sent := check(conditionID, point(95), point(120)); sent != 0 {
+			t.Errorf("a condition that is not met alerted")
+		}
+		condition, _ := conditionService.FindOne(ctx, database.TrackingConditionQuery{ID: conditionID})
+		if condition.Fired {
+			t.Fatal("the condition was not re-armed once it was not met")
+		}
+		if sent := check(conditionID, point(120), point(90)); sent != 1 {
+			t.Errorf("a re-armed condition sent %d messages, want 1", sent)
+		}
+	})
+}
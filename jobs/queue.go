@@ -0,0 +1,259 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/crawl"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/database"
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/logs"
+	"github.com/sirupsen/logrus"
+)
+
+// handlers runs a leased job of each type.
+var handlers = map[string]func(ctx context.Context, job database.CrawlJob) error{
+	database.JOB_CRAWL_SHOP: func(ctx context.Context, job database.CrawlJob) error {
+		return crawlShop(ctx, job.ShopID)
+	},
+	database.JOB_NOTIFY_PRICE: func(ctx context.Context, job database.CrawlJob) error {
+		return notifyPriceChange(ctx)
+	},
+	database.JOB_CLEANUP: func(ctx context.Context, job database.CrawlJob) error {
+		return cleanupJobs(ctx)
+	},
+	database.JOB_SEND_EMAIL: func(ctx context.Context, job database.CrawlJob) error {
+		return sendEmails(ctx, job.LeaseOwner)
+	},
+	database.JOB_SEND_DIGEST: func(ctx context.Context, job database.CrawlJob) error {
+		return sendDigests(ctx)
+	},
+}
+
+// jobNames maps the names used on the command line to job types.
+var jobNames = map[string]string{
+	"crawl":   database.JOB_CRAWL_SHOP,
+	"notify":  database.JOB_NOTIFY_PRICE,
+	"cleanup": database.JOB_CLEANUP,
+	"email":   database.JOB_SEND_EMAIL,
+	"digest":  database.JOB_SEND_DIGEST,
+}
+
+// JobTypes turns names like "crawl" or "notify" into job types.
+func JobTypes(names []string) ([]string, error) {
+	types := []string{}
+	for _, name := range names {
+		jobType, ok := jobNames[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown job %q", name)
+		}
+		types = append(types, jobType)
+	}
+	return types, nil
+}
+
+// cleanupJobs removes the jobs that were done more than a day ago.
+func cleanupJobs(ctx context.Context) error {
+	deleted, err := newCrawlJobService().DeleteDone(ctx, time.Now().Add(-24*time.Hour))
+	if err != nil {
+		return err
+	}
+	logs.LogInfo(logrus.Fields{"deleted": deleted}, "cleanup done jobs")
+	return nil
+}
+
+func newCrawlJobService() *database.CrawlJobService {
+	return database.NewCrawlJobService(database.Repos.CrawlJobs)
+}
+
+// EnqueueJobs queues a crawl for every shop that is due, one price
+// notification, one run of the digest and email senders and a cleanup. Jobs that are
+// already queued are not queued twice, so several replicas can run it at the
+// same time.
+func EnqueueJobs(ctx context.Context) error {
+	shops, err := dueShops(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	queue := newCrawlJobService()
+	for _, shop := range shops {
+		_, err := queue.Enqueue(ctx, database.CrawlJob{
+			Type:     database.JOB_CRAWL_SHOP,
+			ShopID:   shop.ShopID,
+			Priority: shop.Priority,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	_, err = queue.Enqueue(ctx, database.CrawlJob{
+		Type: database.JOB_NOTIFY_PRICE,
+		// let the crawls of this round go first
+		RunAt: time.Now().Add(time.Minute),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = queue.Enqueue(ctx, database.CrawlJob{Type: database.JOB_SEND_DIGEST})
+	if err != nil {
+		return err
+	}
+	_, err = queue.Enqueue(ctx, database.CrawlJob{
+		Type: database.JOB_SEND_EMAIL,
+		// the outbox is drained every round, sooner than anything else
+		Priority: 100,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = queue.Enqueue(ctx, database.CrawlJob{Type: database.JOB_CLEANUP})
+	return err
+}
+
+// RunScheduler queues the jobs every interval until ctx is done.
+func RunScheduler(ctx context.Context, interval time.Duration) {
+	for {
+		enqueueCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		err := EnqueueJobs(enqueueCtx)
+		cancel()
+		if err != nil {
+			logs.LogWarning(logrus.Fields{"data": err.Error()}, "enqueue jobs")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// RunProxyStatsPublisher publishes the stats of the proxy pool of the worker
+// every interval until ctx is done, the API shows them.
+func RunProxyStatsPublisher(ctx context.Context, worker string, interval time.Duration) {
+	pool := crawl.DefaultProxyPool()
+	if pool.Len() == 0 {
+		return
+	}
+	service := database.NewProxyStatService(database.Repos.ProxyStats)
+	for {
+		publishCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		err := pool.Publish(publishCtx, service, worker)
+		cancel()
+		if err != nil {
+			logs.LogWarning(logrus.Fields{"worker": worker, "data": err.Error()}, "publish proxy stats")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// WorkerID is the id of the worker process, hostname-pid unless one is given.
+func WorkerID(id string) string {
+	if id != "" {
+		return id
+	}
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// Worker leases jobs of the given types from the queue and runs them.
+type Worker struct {
+	ID           string
+	Types        []string
+	Visibility   time.Duration
+	PollInterval time.Duration
+	queue        *database.CrawlJobService
+}
+
+func NewWorker(id string, types []string) *Worker {
+	return &Worker{
+		ID:    id,
+		Types: types,
+		// the stop grace period of the worker in docker-compose.yml is longer
+		Visibility:   5 * time.Minute,
+		PollInterval: 10 * time.Second,
+		queue:        newCrawlJobService(),
+	}
+}
+
+// Run works until ctx is done. A job that is running when ctx is done is
+// finished first.
+func (w *Worker) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		worked, err := w.RunOnce(ctx)
+		if err != nil {
+			logs.LogWarning(logrus.Fields{"worker": w.ID, "data": err.Error()}, "run job")
+		}
+		if worked {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(w.PollInterval):
+		}
+	}
+}
+
+// RunOnce leases and runs one job, it reports whether there was one.
+func (w *Worker) RunOnce(ctx context.Context) (bool, error) {
+	leaseCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	job, err := w.queue.Lease(leaseCtx, w.ID, w.Types, w.Visibility)
+	cancel()
+	if errors.Is(err, database.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// the job keeps running on shutdown, it only has to fit in its lease
+	jobCtx, cancel := context.WithTimeout(context.Background(), w.Visibility)
+	defer cancel()
+
+	handler, ok := handlers[job.Type]
+	if !ok {
+		return true, w.queue.Fail(jobCtx, job, w.ID, fmt.Errorf("unknown job type %s", job.Type))
+	}
+
+	err = handler(jobCtx, job)
+	if err == nil {
+		return true, w.queue.Complete(jobCtx, job.ID, w.ID)
+	}
+
+	logs.LogWarning(logrus.Fields{
+		"job":      job.ID.Hex(),
+		"type":     job.Type,
+		"shopID":   job.ShopID,
+		"attempts": job.Attempts,
+		"data":     err.Error(),
+	}, "job failed")
+
+	// a blocked source is not the fault of the job, do not burn its attempts
+	if crawl.IsUnavailable(err) {
+		return true, w.queue.Defer(jobCtx, job, w.ID, err)
+	}
+	return true, w.queue.Fail(jobCtx, job, w.ID, err)
+}
+
+// RunWorkers runs concurrency workers until ctx is done and waits for the
+// jobs they are running to finish.
+func RunWorkers(ctx context.Context, id string, types []string, concurrency int) {
+	id = WorkerID(id)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		worker := NewWorker(fmt.Sprintf("%s-%d", id, i), types)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			worker.Run(ctx)
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,155 @@
+package jobs
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/database"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	minCrawlInterval = 5 * time.Minute
+	maxCrawlInterval = 6 * time.Hour
+	// weight of the last crawl in the volatility of a shop
+	volatilityWeight = 0.3
+)
+
+// shopPriority grows with the users tracking products of the shop and with
+// how often its prices move. A shop nobody tracks has no priority.
+func shopPriority(activeTrackings int, volatility float64) float64 {
+	return float64(activeTrackings) * (1 + 4*volatility)
+}
+
+// crawlInterval shrinks from maxCrawlInterval for cold shops down to
+// minCrawlInterval for the hottest ones.
+func crawlInterval(priority float64) time.Duration {
+	interval := time.Duration(float64(maxCrawlInterval) / (1 + priority))
+	if interval < minCrawlInterval {
+		return minCrawlInterval
+	}
+	if interval > maxCrawlInterval {
+		return maxCrawlInterval
+	}
+	return interval
+}
+
+// nextVolatility mixes the share of changed prices of the last crawl into
+// the volatility of the shop.
+func nextVolatility(volatility float64, changed int, known int) float64 {
+	if known == 0 {
+		return volatility
+	}
+	return (1-volatilityWeight)*volatility + volatilityWeight*float64(changed)/float64(known)
+}
+
+// crawlFailureBackoff doubles from minCrawlInterval with every failed crawl
+// in a row, up to maxCrawlInterval.
+func crawlFailureBackoff(failures int) time.Duration {
+	backoff := minCrawlInterval
+	for i := 1; i < failures && backoff < maxCrawlInterval; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxCrawlInterval)
+}
+
+// dueAt is when the shop has to be crawled again, a shop whose interval got
+// shorter since its last crawl is due earlier. A shop whose crawls fail is
+// not due before its retry.
+func dueAt(shop database.Shop) time.Time {
+	due := shop.NextCrawlAt
+	if !shop.LastCrawledAt.IsZero() {
+		if sooner := shop.LastCrawledAt.Add(time.Duration(shop.CrawlInterval) * time.Second); sooner.Before(due) {
+			due = sooner
+		}
+	}
+	if shop.RetryCrawlAt.After(due) {
+		due = shop.RetryCrawlAt
+	}
+	return due
+}
+
+// activeTrackingsByShop counts the users of the active trackings of every shop.
+func activeTrackingsByShop(ctx context.Context) (map[primitive.ObjectID]int, error) {
+	trackingService := database.NewTrackingService(database.Repos.Trackings)
+	productService := database.NewProductService(database.Repos.Products)
+	subscriptionService := database.NewTrackingSubscriptionService(database.Repos.TrackingSubscriptions)
+
+	trackings, err := trackingService.FindActive(ctx)
+	if err != nil {
+		return nil, err
+	}
+	subscribers, err := subscriptionService.CountByTracking(ctx)
+	if err != nil {
+		return nil, err
+	}
+	usersByProduct := map[primitive.ObjectID]int{}
+	productIDs := []primitive.ObjectID{}
+	for _, tracking := range trackings {
+		productID, ok := tracking.Product.Map()["$id"].(primitive.ObjectID)
+		if !ok {
+			continue
+		}
+		if _, seen := usersByProduct[productID]; !seen {
+			productIDs = append(productIDs, productID)
+		}
+		usersByProduct[productID] += subscribers[tracking.ID]
+	}
+	if len(productIDs) == 0 {
+		return map[primitive.ObjectID]int{}, nil
+	}
+
+	products, err := productService.FindByIDs(ctx, productIDs)
+	if err != nil {
+		return nil, err
+	}
+	counts := map[primitive.ObjectID]int{}
+	for _, product := range products {
+		shopID, ok := product.Shop.Map()["$id"].(primitive.ObjectID)
+		if !ok {
+			continue
+		}
+		counts[shopID] += usersByProduct[product.ID]
+	}
+	return counts, nil
+}
+
+// dueShops refreshes the priority of every shop and returns the shops due
+// for a crawl, highest priority first.
+func dueShops(ctx context.Context, now time.Time) ([]database.Shop, error) {
+	shopService := database.NewShopService(database.Repos.Shops)
+	shops, err := shopService.FindAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	counts, err := activeTrackingsByShop(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	due := []database.Shop{}
+	for _, shop := range shops {
+		active := counts[shop.ID]
+		priority := shopPriority(active, shop.Volatility)
+		interval := int64(crawlInterval(priority).Seconds())
+		if priority != shop.Priority || active != shop.ActiveTrackings || interval != shop.CrawlInterval {
+			err := shopService.SetPriority(ctx, shop.ID, priority, active, interval)
+			if err != nil {
+				return nil, err
+			}
+			shop.Priority, shop.ActiveTrackings, shop.CrawlInterval = priority, active, interval
+		}
+		if !dueAt(shop).After(now) {
+			due = append(due, shop)
+		}
+	}
+
+	sort.SliceStable(due, func(i, j int) bool {
+		if due[i].Priority != due[j].Priority {
+			return due[i].Priority > due[j].Priority
+		}
+		return dueAt(due[i]).Before(dueAt(due[j]))
+	})
+	return due, nil
+}
@@ -0,0 +1,149 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/database"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestActiveTrackingsByShop(t *testing.T) {
+	ctx := context.Background()
+	database.Repos = database.NewMemoryRepositories()
+	shopID := primitive.NewObjectID()
+	id, _ := database.Repos.Products.Insert(ctx, database.Product{IDShopee: 1, ShopID: shopID})
+	productID := id.(primitive.ObjectID)
+
+	id, _ = database.Repos.Trackings.Insert(ctx, database.Tracking{IDShopee: 1, Status: true})
+	trackingID := id.(primitive.ObjectID)
+	database.Repos.Trackings.Update(ctx, trackingID, database.TrackingUpdate{ProductID: productID})
+	// a stopped tracking does not count
+	id, _ = database.Repos.Trackings.Insert(ctx, database.Tracking{IDShopee: 1})
+	stoppedID := id.(primitive.ObjectID)
+	database.Repos.Trackings.Update(ctx, stoppedID, database.TrackingUpdate{ProductID: productID})
+
+	for _, tracking := range []primitive.ObjectID{trackingID, trackingID, stoppedID} {
+		database.Repos.TrackingSubscriptions.Subscribe(ctx, primitive.NewObjectID(), tracking)
+	}
+
+	counts, err := activeTrackingsByShop(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts[shopID] != 2 {
+		t.Errorf("shop has %d active trackings, want 2", counts[shopID])
+	}
+}
+
+func TestShopPriority(t *testing.T) {
+	for _, test := range []struct {
+		active     int
+		volatility float64
+		want       float64
+	}{
+		{0, 1, 0},
+		{1, 0, 1},
+		{2, 0.5, 6},
+		{3, 1, 15},
+	} {
+		if got := shopPriority(test.active, test.volatility); got != test.want {
+			t.Errorf("shopPriority(%d, %v) = %v, want %v", test.active, test.volatility, got, test.want)
+		}
+	}
+}
+
+func TestCrawlInterval(t *testing.T) {
+	for _, test := range []struct {
+		priority float64
+		want     time.Duration
+	}{
+		{0, maxCrawlInterval},
+		{-0.5, maxCrawlInterval},
+		{1, 3 * time.Hour},
+		{5, time.Hour},
+		{1000, minCrawlInterval},
+	} {
+		if got := crawlInterval(test.priority); got != test.want {
+			t.Errorf("crawlInterval(%v) = %v, want %v", test.priority, got, test.want)
+		}
+	}
+}
+
+func TestNextVolatility(t *testing.T) {
+	for _, test := range []struct {
+		volatility     float64
+		changed, known int
+		want           float64
+	}{
+		{0.5, 0, 0, 0.5},
+		{0, 10, 10, 0.3},
+		{1, 0, 10, 0.7},
+		{0.5, 5, 10, 0.5},
+	} {
+		if got := nextVolatility(test.volatility, test.changed, test.known); got < test.want-1e-9 || got > test.want+1e-9 {
+			t.Errorf("nextVolatility(%v, %d, %d) = %v, want %v", test.volatility, test.changed, test.known, got, test.want)
+		}
+	}
+}
+
+func TestCrawlFailureBackoff(t *testing.T) {
+	for _, test := range []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, minCrawlInterval},
+		{2, 2 * minCrawlInterval},
+		{4, 8 * minCrawlInterval},
+		{100, maxCrawlInterval},
+	} {
+		if got := crawlFailureBackoff(test.failures); got != test.want {
+			t.Errorf("crawlFailureBackoff(%d) = %v, want %v", test.failures, got, test.want)
+		}
+	}
+}
+
+func TestDueAt(t *testing.T) {
+	now := time.Date(2024, time.March, 5, 12, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		name string
+		shop database.Shop
+		want time.Time
+	}{
+		{"never crawled", database.Shop{}, time.Time{}},
+		{"next crawl", database.Shop{LastCrawledAt: now, NextCrawlAt: now.Add(time.Hour), CrawlInterval: 3600}, now.Add(time.Hour)},
+		{"interval got shorter", database.Shop{LastCrawledAt: now, NextCrawlAt: now.Add(6 * time.Hour), CrawlInterval: 600}, now.Add(10 * time.Minute)},
+		{"failing", database.Shop{LastCrawledAt: now.Add(-time.Hour), NextCrawlAt: now, CrawlInterval: 600, CrawlFailures: 2, RetryCrawlAt: now.Add(10 * time.Minute)}, now.Add(10 * time.Minute)},
+		{"retry passed", database.Shop{LastCrawledAt: now, NextCrawlAt: now.Add(time.Hour), CrawlInterval: 3600, RetryCrawlAt: now.Add(-time.Minute)}, now.Add(time.Hour)},
+	} {
+		if got := dueAt(test.shop); !got.Equal(test.want) {
+			t.Errorf("%s: dueAt = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestFailedCrawlIsNotDueAgain(t *testing.T) {
+	ctx := context.Background()
+	database.Repos = database.NewMemoryRepositories()
+	shop, _ := database.Repos.Shops.Insert(ctx, database.Shop{ShopID: 7})
+	now := time.Now()
+
+	if err := scheduleRetryCrawl(ctx, 7); err != nil {
+		t.Fatal(err)
+	}
+	if err := scheduleRetryCrawl(ctx, 7); err != nil {
+		t.Fatal(err)
+	}
+	due, err := dueShops(ctx, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 0 {
+		t.Errorf("a failing shop is due right away: %+v", due)
+	}
+	failed, _ := database.Repos.Shops.FindById(ctx, shop.ID.Hex())
+	if failed.CrawlFailures != 2 || failed.RetryCrawlAt.Before(now.Add(2*minCrawlInterval)) {
+		t.Errorf("shop after two failures = %+v", failed)
+	}
+}
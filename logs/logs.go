@@ -8,3 +8,8 @@ func LogWarning(data logger.Fields, message string) {
 	logger.SetLevel(logger.WarnLevel)
 	logger.WithFields(data).Warn(message)
 }
+
+func LogInfo(data logger.Fields, message string) {
+	logger.SetLevel(logger.InfoLevel)
+	logger.WithFields(data).Info(message)
+}
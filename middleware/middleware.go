@@ -22,6 +22,7 @@ type Claims struct {
 
 type ConditionAuth struct {
 	NeedVerify bool
+	NeedAdmin  bool
 }
 
 // for use on route (using a http.HandlerFunc)
@@ -70,6 +71,12 @@ func AuthMiddleware(next http.HandlerFunc, condition ConditionAuth) http.Handler
 			return
 		}
 
+		if user.Role != database.ADMIN_ROLE && condition.NeedAdmin {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(common.ReturnErrorApi(http.StatusForbidden, common.ForbiddenCode, common.ForbiddenMsg))
+			return
+		}
+
 		// write user_id to context
 		ctx = context.WithValue(r.Context(), "user_id", userID)
 
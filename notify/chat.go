@@ -0,0 +1,71 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/database"
+)
+
+const telegramBaseUrl = "https://api.telegram.org"
+
+// TelegramNotifier sends the message with a bot to the chat id of the channel.
+type TelegramNotifier struct {
+	client  *http.Client
+	token   string
+	baseUrl string
+}
+
+func NewTelegramNotifier(client *http.Client, token string) *TelegramNotifier {
+	return &TelegramNotifier{client, token, telegramBaseUrl}
+}
+
+func (n *TelegramNotifier) Notify(ctx context.Context, channel database.NotificationChannel, message Message) error {
+	err := postJSON(ctx, n.client, n.baseUrl+"/bot"+n.token+"/sendMessage", map[string]any{
+		"chat_id": channel.Target,
+		"text":    chatText(message),
+	})
+	// the token is in the url, keep it out of the error that gets logged and
+	// stored with the notification
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		urlErr.URL = n.baseUrl + "/bot<token>/sendMessage"
+	}
+	return err
+}
+
+// ChatWebhookNotifier posts the message to a Discord or Slack incoming
+// webhook, the url of the channel.
+type ChatWebhookNotifier struct {
+	client *http.Client
+	// field is where the text goes in the body
+	field string
+}
+
+func NewDiscordNotifier(client *http.Client) *ChatWebhookNotifier {
+	return &ChatWebhookNotifier{client, "content"}
+}
+
+func NewSlackNotifier(client *http.Client) *ChatWebhookNotifier {
+	return &ChatWebhookNotifier{client, "text"}
+}
+
+func (n *ChatWebhookNotifier) Notify(ctx context.Context, channel database.NotificationChannel, message Message) error {
+	return postJSON(ctx, n.client, channel.Target, map[string]any{
+		n.field: chatText(message),
+	})
+}
+
+// chatText puts the title, the text and the link of the message together.
+func chatText(message Message) string {
+	parts := []string{}
+	for _, part := range []string{message.Title, message.Text, message.Url} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,195 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/database"
+)
+
+// EMAIL_TIMEOUT bounds a whole SMTP exchange when the context has no
+// deadline.
+const EMAIL_TIMEOUT = 30 * time.Second
+
+// EmailNotifier sends messages through an SMTP server.
+type EmailNotifier struct {
+	addr string
+	host string
+	auth smtp.Auth
+	from string
+}
+
+// NewEmailNotifier sends through addr (host:port). No auth is used when
+// username is empty.
+func NewEmailNotifier(addr string, username string, password string, from string) *EmailNotifier {
+	host := addr
+	if i := strings.LastIndex(addr, ":"); i >= 0 {
+		host = addr[:i]
+	}
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &EmailNotifier{addr, host, auth, from}
+}
+
+// NewEmailNotifierFromEnv reads SMTP_SERVER, SMTP_PORT, UR_MAIL, PW_MAIL and
+// HOST_MAIL.
+func NewEmailNotifierFromEnv() *EmailNotifier {
+	return NewEmailNotifier(os.Getenv("SMTP_SERVER")+":"+os.Getenv("SMTP_PORT"), os.Getenv("UR_MAIL"), os.Getenv("PW_MAIL"), os.Getenv("HOST_MAIL"))
+}
+
+func (n *EmailNotifier) Notify(ctx context.Context, channel database.NotificationChannel, message Message) error {
+	return n.Send(ctx, channel.Target, message)
+}
+
+// Send sends the message to the address right away. The exchange stops at
+// the deadline of the context, or after EMAIL_TIMEOUT, so a stalled server
+// does not hold the sender.
+func (n *EmailNotifier) Send(ctx context.Context, to string, message Message) error {
+	if strings.ContainsAny(to, "\r\n") {
+		return fmt.Errorf("%w: bad address", ErrDelivery)
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(EMAIL_TIMEOUT)
+	}
+	var dialer net.Dialer
+	dialCtx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	conn, err := dialer.DialContext(dialCtx, "tcp", n.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err = conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+	// a canceled context unblocks the exchange
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	client, err := smtp.NewClient(conn, n.host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err = client.StartTLS(&tls.Config{ServerName: n.host}); err != nil {
+			return err
+		}
+	}
+	if n.auth != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+		if err = client.Auth(n.auth); err != nil {
+			return err
+		}
+	}
+	if err = client.Mail(n.from); err != nil {
+		return err
+	}
+	if err = client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(buildEmail(n.from, to, message, time.Now())); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// IsPermanent tells whether the SMTP server refused the message for good, a
+// 5xx reply like an unknown mailbox. Sending it again will not help.
+func IsPermanent(err error) bool {
+	var reply *textproto.Error
+	return errors.As(err, &reply) && reply.Code >= 500
+}
+
+// OutboxNotifier queues the emails in the outbox instead of sending them,
+// the sender job sends them with retries.
+type OutboxNotifier struct {
+	outbox *database.EmailService
+}
+
+func NewOutboxNotifier(outbox *database.EmailService) *OutboxNotifier {
+	return &OutboxNotifier{outbox}
+}
+
+func (n *OutboxNotifier) Notify(ctx context.Context, channel database.NotificationChannel, message Message) error {
+	_, err := n.outbox.Queue(ctx, database.Email{
+		Kind:    database.EMAIL_ALERT,
+		To:      channel.Target,
+		Subject: message.Title,
+		HTML:    message.HTML,
+		Text:    message.Text,
+	})
+	return err
+}
+
+// buildEmail writes the headers and the body of the message. A message with
+// both HTML and text is sent as multipart/alternative so the mail clients
+// pick the one they can show.
+func buildEmail(from string, to string, message Message, now time.Time) []byte {
+	var email bytes.Buffer
+	fmt.Fprintf(&email, "From: %s\r\n", from)
+	fmt.Fprintf(&email, "To: %s\r\n", to)
+	fmt.Fprintf(&email, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", message.Title))
+	fmt.Fprintf(&email, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	email.WriteString("MIME-Version: 1.0\r\n")
+
+	if message.HTML == "" || message.Text == "" {
+		body, contentType := message.HTML, "text/html"
+		if body == "" {
+			body, contentType = message.Text, "text/plain"
+		}
+		fmt.Fprintf(&email, "Content-Type: %s; charset=\"utf-8\"\r\n", contentType)
+		email.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		writeQuotedPrintable(&email, body)
+		return email.Bytes()
+	}
+
+	parts := multipart.NewWriter(&email)
+	fmt.Fprintf(&email, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", parts.Boundary())
+	// the last part is the preferred one
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain", message.Text},
+		{"text/html", message.HTML},
+	} {
+		w, _ := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType + "; charset=\"utf-8\""},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		writeQuotedPrintable(w, part.body)
+	}
+	parts.Close()
+	return email.Bytes()
+}
+
+// writeQuotedPrintable keeps the lines short enough for SMTP whatever the
+// body is.
+func writeQuotedPrintable(w io.Writer, body string) {
+	qp := quotedprintable.NewWriter(w)
+	qp.Write([]byte(body))
+	qp.Close()
+}
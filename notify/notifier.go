@@ -0,0 +1,115 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/database"
+)
+
+var (
+	ErrUnknownChannel = errors.New("unknown notification channel")
+	ErrDelivery       = errors.New("notification not delivered")
+	// ErrGone means the channel does not exist anymore, e.g. an expired push
+	// subscription, and should be disabled
+	ErrGone = errors.New("notification channel gone")
+)
+
+// Message is an alert ready to be sent on any channel.
+type Message struct {
+	Title string `json:"title"`
+	// Text is the plain text body, HTML is used by the channels that can
+	Text string `json:"text"`
+	HTML string `json:"-"`
+	Url  string `json:"url,omitempty"`
+	// Data is the alert itself, for the webhooks
+	Data any `json:"data,omitempty"`
+}
+
+// Notifier delivers a message on one kind of channel.
+type Notifier interface {
+	Notify(ctx context.Context, channel database.NotificationChannel, message Message) error
+}
+
+// Notifiers picks the notifier of a channel by its type.
+type Notifiers map[string]Notifier
+
+func (n Notifiers) Notify(ctx context.Context, channel database.NotificationChannel, message Message) error {
+	notifier, ok := n[channel.Type]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownChannel, channel.Type)
+	}
+	return notifier.Notify(ctx, channel, message)
+}
+
+// WithOutbox returns the notifiers with the emails queued in the outbox.
+func (n Notifiers) WithOutbox(outbox *database.EmailService) Notifiers {
+	notifiers := Notifiers{}
+	for channel, notifier := range n {
+		notifiers[channel] = notifier
+	}
+	notifiers[database.CHANNEL_EMAIL] = NewOutboxNotifier(outbox)
+	return notifiers
+}
+
+// NewNotifiersFromEnv builds every notifier from the env. Telegram and web
+// push are left out when their keys are not set.
+func NewNotifiersFromEnv() Notifiers {
+	// the targets are set by the users
+	client := NewPublicClient(10 * time.Second)
+	notifiers := Notifiers{
+		database.CHANNEL_EMAIL:   NewEmailNotifierFromEnv(),
+		database.CHANNEL_WEBHOOK: NewWebhookNotifier(client),
+		database.CHANNEL_DISCORD: NewDiscordNotifier(client),
+		database.CHANNEL_SLACK:   NewSlackNotifier(client),
+	}
+	if token := os.Getenv("TELEGRAM_BOT_TOKEN"); token != "" {
+		notifiers[database.CHANNEL_TELEGRAM] = NewTelegramNotifier(client, token)
+	}
+	if webPush, err := NewWebPushNotifierFromEnv(client); err == nil {
+		notifiers[database.CHANNEL_WEB_PUSH] = webPush
+	}
+	return notifiers
+}
+
+var (
+	defaultNotifiers     Notifiers
+	defaultNotifiersOnce sync.Once
+)
+
+// DefaultNotifiers are the notifiers made from the env.
+func DefaultNotifiers() Notifiers {
+	defaultNotifiersOnce.Do(func() {
+		defaultNotifiers = NewNotifiersFromEnv()
+	})
+	return defaultNotifiers
+}
+
+var (
+	// hookGone are the answers of the push services and the chat hooks when
+	// the subscription or the hook was deleted
+	hookGone = []int{http.StatusNotFound, http.StatusGone}
+	// webhookGone are the answers of the webhooks of the users when they are
+	// removed, a 404 is often a deploy or a routing mistake on their side
+	webhookGone = []int{http.StatusGone}
+)
+
+// checkResponse turns a non 2xx answer into an error, ErrGone for the gone
+// statuses.
+func checkResponse(resp *http.Response, gone []int) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if slices.Contains(gone, resp.StatusCode) {
+		return fmt.Errorf("%w: status %d", ErrGone, resp.StatusCode)
+	}
+	return fmt.Errorf("%w: status %d: %s", ErrDelivery, resp.StatusCode, body)
+}
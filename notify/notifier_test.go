@@ -0,0 +1,307 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/database"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var testMessage = Message{Title: "Giá đã giảm", Text: "Now 90.000đ", Url: "https://shopee.vn/p"}
+
+// receiver records the requests made to a local HTTP server.
+type receiver struct {
+	server   *httptest.Server
+	requests chan receivedRequest
+}
+
+type receivedRequest struct {
+	path   string
+	header http.Header
+	body   []byte
+}
+
+func newReceiver(t *testing.T, status int) *receiver {
+	r := &receiver{requests: make(chan receivedRequest, 1)}
+	r.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.requests <- receivedRequest{req.URL.Path, req.Header, body}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(r.server.Close)
+	return r
+}
+
+func (r *receiver) next(t *testing.T) receivedRequest {
+	select {
+	case req := <-r.requests:
+		return req
+	case <-time.After(5 * time.Second):
+		t.Fatal("no request received")
+	}
+	return receivedRequest{}
+}
+
+func TestWebhookSignature(t *testing.T) {
+	r := newReceiver(t, http.StatusOK)
+	notifier := NewWebhookNotifier(r.server.Client())
+	notifier.now = func() time.Time { return time.Unix(1700000000, 0) }
+
+	channel := database.NotificationChannel{Type: database.CHANNEL_WEBHOOK, Target: r.server.URL + "/hook", Secret: "s3cret"}
+	if err := notifier.Notify(context.Background(), channel, testMessage); err != nil {
+		t.Fatal(err)
+	}
+	req := r.next(t)
+	if got := req.header.Get(TimestampHeader); got != "1700000000" {
+		t.Fatalf("timestamp %q", got)
+	}
+	if got, want := req.header.Get(SignatureHeader), Sign("s3cret", "1700000000", req.body); got != want {
+		t.Fatalf("signature %q, want %q", got, want)
+	}
+	var message Message
+	if err := json.Unmarshal(req.body, &message); err != nil || message.Title != testMessage.Title {
+		t.Fatalf("body %s: %v", req.body, err)
+	}
+}
+
+func TestChatNotifiers(t *testing.T) {
+	r := newReceiver(t, http.StatusNoContent)
+	telegram := NewTelegramNotifier(r.server.Client(), "123:abc")
+	telegram.baseUrl = r.server.URL
+
+	if err := telegram.Notify(context.Background(), database.NotificationChannel{Target: "42"}, testMessage); err != nil {
+		t.Fatal(err)
+	}
+	req := r.next(t)
+	var body map[string]string
+	json.Unmarshal(req.body, &body)
+	if req.path != "/bot123:abc/sendMessage" || body["chat_id"] != "42" || !strings.Contains(body["text"], testMessage.Text) {
+		t.Fatalf("telegram %s %s", req.path, req.body)
+	}
+
+	// a failed request does not give the token away
+	down := NewTelegramNotifier(r.server.Client(), "123:abc")
+	down.baseUrl = "http://127.0.0.1:0"
+	if err := down.Notify(context.Background(), database.NotificationChannel{Target: "42"}, testMessage); err == nil || strings.Contains(err.Error(), "123:abc") {
+		t.Fatalf("telegram error %v", err)
+	}
+
+	for field, notifier := range map[string]Notifier{
+		"content": NewDiscordNotifier(r.server.Client()),
+		"text":    NewSlackNotifier(r.server.Client()),
+	} {
+		if err := notifier.Notify(context.Background(), database.NotificationChannel{Target: r.server.URL}, testMessage); err != nil {
+			t.Fatal(err)
+		}
+		body := map[string]string{}
+		json.Unmarshal(r.next(t).body, &body)
+		if !strings.Contains(body[field], testMessage.Url) {
+			t.Fatalf("%s missing in %v", field, body)
+		}
+	}
+}
+
+func TestWebPush(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	d := make([]byte, 32)
+	key.D.FillBytes(d)
+
+	r := newReceiver(t, http.StatusCreated)
+	notifier, err := NewWebPushNotifier(r.server.Client(), base64.RawURLEncoding.EncodeToString(d), "mailto:admin@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := notifier.Notify(context.Background(), database.NotificationChannel{Target: r.server.URL + "/push/1"}, testMessage); err != nil {
+		t.Fatal(err)
+	}
+	req := r.next(t)
+	auth := strings.TrimPrefix(req.header.Get("Authorization"), "vapid t=")
+	token, publicKey, _ := strings.Cut(auth, ", k=")
+	if publicKey != notifier.PublicKey() {
+		t.Fatalf("public key %q", publicKey)
+	}
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (any, error) { return &key.PublicKey, nil }); err != nil {
+		t.Fatal(err)
+	}
+	if claims["aud"] != r.server.URL {
+		t.Fatalf("audience %v", claims["aud"])
+	}
+
+	for _, status := range []int{http.StatusNotFound, http.StatusGone} {
+		gone := newReceiver(t, status)
+		err = notifier.Notify(context.Background(), database.NotificationChannel{Target: gone.server.URL}, testMessage)
+		if !errors.Is(err, ErrGone) {
+			t.Fatalf("status %d: expected gone, got %v", status, err)
+		}
+	}
+}
+
+func TestWebhookGone(t *testing.T) {
+	notifier := NewWebhookNotifier(http.DefaultClient)
+	// a webhook answering 404 is kept, it may be a deploy on the receiver
+	missing := newReceiver(t, http.StatusNotFound)
+	err := notifier.Notify(context.Background(), database.NotificationChannel{Target: missing.server.URL}, testMessage)
+	if !errors.Is(err, ErrDelivery) || errors.Is(err, ErrGone) {
+		t.Fatalf("404: expected a failed delivery, got %v", err)
+	}
+	gone := newReceiver(t, http.StatusGone)
+	err = notifier.Notify(context.Background(), database.NotificationChannel{Target: gone.server.URL}, testMessage)
+	if !errors.Is(err, ErrGone) {
+		t.Fatalf("410: expected gone, got %v", err)
+	}
+}
+
+// fakeSMTP accepts one mail and sends its data on the channel. The
+// recipient is answered with rcptReply.
+func fakeSMTP(t *testing.T, rcptReply string) (string, chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	mails := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		reply("220 localhost")
+		var data strings.Builder
+		inData := false
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					mails <- data.String()
+					reply("250 OK")
+					continue
+				}
+				data.WriteString(line)
+				continue
+			}
+			switch command := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(command, "RCPT"):
+				reply(rcptReply)
+			case command == "DATA":
+				inData = true
+				reply("354 go ahead")
+			case command == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+	return listener.Addr().String(), mails
+}
+
+func TestEmailNotifier(t *testing.T) {
+	addr, mails := fakeSMTP(t, "250 OK")
+	notifier := NewEmailNotifier(addr, "", "", "alerts@example.com")
+	message := testMessage
+	message.HTML = "<p>Now 90.000đ</p>"
+
+	channel := database.NotificationChannel{Type: database.CHANNEL_EMAIL, Target: "user@example.com"}
+	if err := notifier.Notify(context.Background(), channel, message); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case mail := <-mails:
+		for _, want := range []string{"To: user@example.com", "MIME-Version: 1.0", "multipart/alternative", "Content-Type: text/plain", "Content-Type: text/html", "Subject: =?utf-8?q?", "<p>Now 90.000=C4=91</p>"} {
+			if !strings.Contains(mail, want) {
+				t.Fatalf("%q missing in\n%s", want, mail)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no mail received")
+	}
+}
+
+func TestEmailBounce(t *testing.T) {
+	addr, _ := fakeSMTP(t, "550 no such user")
+	err := NewEmailNotifier(addr, "", "", "alerts@example.com").Send(context.Background(), "nobody@example.com", testMessage)
+	if !IsPermanent(err) {
+		t.Fatalf("expected a permanent failure, got %v", err)
+	}
+	if IsPermanent(errors.New("connection refused")) {
+		t.Fatal("a network error is not permanent")
+	}
+}
+
+func TestEmailStalledServer(t *testing.T) {
+	// the server accepts the connection and never greets
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = NewEmailNotifier(listener.Addr().String(), "", "", "alerts@example.com").Send(ctx, "user@example.com", testMessage)
+	if err == nil || time.Since(start) > 5*time.Second {
+		t.Fatalf("send to a stalled server = %v after %v, want a timeout", err, time.Since(start))
+	}
+}
+
+func TestCheckTarget(t *testing.T) {
+	ctx := context.Background()
+	for _, target := range []string{
+		"http://1.1.1.1/hook",
+		"https://localhost/hook",
+		"https://127.0.0.1/hook",
+		"https://10.0.0.8/hook",
+		"https://169.254.169.254/latest/meta-data",
+		"https://[::1]/hook",
+		"https://[::ffff:192.168.1.1]/hook",
+		"https://100.64.0.1/hook",
+		"https://metadata.google.internal/hook",
+	} {
+		if err := CheckTarget(ctx, target); err == nil {
+			t.Errorf("CheckTarget(%q) = nil, want an error", target)
+		}
+	}
+	if err := CheckTarget(ctx, "https://1.1.1.1/hook"); err != nil {
+		t.Errorf("CheckTarget of a public address = %v", err)
+	}
+}
+
+func TestPublicClientRefusesLocalServer(t *testing.T) {
+	r := newReceiver(t, http.StatusOK)
+	err := NewWebhookNotifier(NewPublicClient(time.Second)).Notify(context.Background(), database.NotificationChannel{Target: r.server.URL}, testMessage)
+	if !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("notify a loopback server = %v, want ErrPrivateAddress", err)
+	}
+}
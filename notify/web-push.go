@@ -0,0 +1,79 @@
+package notify
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/database"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrVapidKey = errors.New("invalid vapid key")
+
+// WebPushNotifier wakes up the push subscription of the channel, the Target
+// is the endpoint of the subscription. The push has no payload so it needs
+// no encryption keys: the service worker fetches the latest alerts of the
+// user from GET /api/notifications.
+type WebPushNotifier struct {
+	client  *http.Client
+	key     *ecdsa.PrivateKey
+	subject string
+	now     func() time.Time
+}
+
+// NewWebPushNotifier takes the VAPID private key as base64url, the format
+// the usual key generators print.
+func NewWebPushNotifier(client *http.Client, privateKey string, subject string) (*WebPushNotifier, error) {
+	d, err := base64.RawURLEncoding.DecodeString(privateKey)
+	if err != nil || len(d) != 32 {
+		return nil, ErrVapidKey
+	}
+	curve := elliptic.P256()
+	key := &ecdsa.PrivateKey{D: new(big.Int).SetBytes(d)}
+	key.PublicKey.Curve = curve
+	key.PublicKey.X, key.PublicKey.Y = curve.ScalarBaseMult(d)
+	return &WebPushNotifier{client, key, subject, time.Now}, nil
+}
+
+// NewWebPushNotifierFromEnv reads VAPID_PRIVATE_KEY and VAPID_SUBJECT.
+func NewWebPushNotifierFromEnv(client *http.Client) (*WebPushNotifier, error) {
+	return NewWebPushNotifier(client, os.Getenv("VAPID_PRIVATE_KEY"), os.Getenv("VAPID_SUBJECT"))
+}
+
+// PublicKey is the application server key the browsers subscribe with.
+func (n *WebPushNotifier) PublicKey() string {
+	return base64.RawURLEncoding.EncodeToString(elliptic.Marshal(n.key.Curve, n.key.X, n.key.Y))
+}
+
+func (n *WebPushNotifier) Notify(ctx context.Context, channel database.NotificationChannel, message Message) error {
+	endpoint, err := url.Parse(channel.Target)
+	if err != nil || endpoint.Host == "" {
+		return errors.Join(ErrDelivery, err)
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		// the push services want a single audience, not an array
+		"aud": endpoint.Scheme + "://" + endpoint.Host,
+		"exp": n.now().Add(12 * time.Hour).Unix(),
+		"sub": n.subject,
+	}).SignedString(n.key)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, channel.Target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("TTL", "86400")
+	req.Header.Set("Urgency", "normal")
+	req.Header.Set("Authorization", "vapid t="+token+", k="+n.PublicKey())
+	// a 404 or a 410 means the subscription expired, RFC 8030
+	return postRequest(n.client, req, hookGone)
+}
@@ -0,0 +1,81 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bonnguyenitc/shopee-stracks/back-end-go/database"
+)
+
+const (
+	SignatureHeader = "X-Stracks-Signature"
+	TimestampHeader = "X-Stracks-Timestamp"
+)
+
+// WebhookNotifier posts the message as JSON to the url of the channel. The
+// body is signed with the secret of the channel.
+type WebhookNotifier struct {
+	client *http.Client
+	now    func() time.Time
+}
+
+func NewWebhookNotifier(client *http.Client) *WebhookNotifier {
+	return &WebhookNotifier{client, time.Now}
+}
+
+// Sign returns the signature of a webhook body: the hex HMAC-SHA256 of
+// "<timestamp>.<body>" with the secret.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, channel database.NotificationChannel, message Message) error {
+	timestamp := strconv.FormatInt(n.now().Unix(), 10)
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, channel.Target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimestampHeader, timestamp)
+	if channel.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(channel.Secret, timestamp, body))
+	}
+	return postRequest(n.client, req, webhookGone)
+}
+
+// postJSON posts body as JSON to url, a chat hook.
+func postJSON(ctx context.Context, client *http.Client, url string, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return postRequest(client, req, hookGone)
+}
+
+func postRequest(client *http.Client, req *http.Request, gone []int) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkResponse(resp, gone)
+}
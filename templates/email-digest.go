@@ -0,0 +1,76 @@
+package templates
+
+import "math"
+
+// DigestItem is one alert of a digest.
+type DigestItem struct {
+	ProductName   string
+	ProductImage  string
+	LinkProduct   string
+	Price         int64
+	PricePrevious int64
+	// Currency is found from LinkProduct when empty
+	Currency string
+}
+
+// Change is the price change in percent, negative for a drop.
+func (i DigestItem) Change() float64 {
+	if i.PricePrevious <= 0 {
+		return 0
+	}
+	change := float64(i.Price-i.PricePrevious) * 100 / float64(i.PricePrevious)
+	return math.Round(change*10) / 10
+}
+
+type InfoEmailDigest struct {
+	Locale string
+	Email  string
+	// Items are shown in this order
+	Items []DigestItem
+}
+
+const TEMPLATE_EMAIL_DIGEST = `
+<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<title>{{t "digest_subject" (len .Items)}}</title>
+</head>
+<body>
+	<p>{{t "hi" .Email}}</p>
+	<p>{{t "digest_intro"}}</p>
+	<table cellpadding="4" style="border-collapse: collapse">
+		<tr><th></th><th align="left">{{t "product"}}</th><th align="right">{{t "before"}}</th><th align="right">{{t "now"}}</th><th align="right">{{t "change"}}</th></tr>
+		{{range .Items}}<tr>
+			<td>{{if .ProductImage}}<img src="{{.ProductImage}}" alt="" width="48">{{end}}</td>
+			<td><a href="{{.LinkProduct}}">{{.ProductName}}</a></td>
+			<td align="right">{{money .PricePrevious .Currency}}</td>
+			<td align="right">{{money .Price .Currency}}</td>
+			<td align="right">{{percent .Change}}%</td>
+		</tr>
+		{{end}}
+	</table>
+	<p>{{t "thanks"}}</p>
+</body>
+</html>
+`
+
+const TEMPLATE_TEXT_DIGEST = `{{t "hi" .Email}}
+
+{{t "digest_intro"}}
+
+{{range .Items}}- {{.ProductName}}: {{money .PricePrevious .Currency}} -> {{money .Price .Currency}} ({{percent .Change}}%)
+  {{.LinkProduct}}
+{{end}}
+{{t "thanks"}}
+`
+
+func CreateEmailDigestTemplate(info InfoEmailDigest) (Email, error) {
+	for i := range info.Items {
+		if info.Items[i].Currency == "" {
+			info.Items[i].Currency = CurrencyFromUrl(info.Items[i].LinkProduct)
+		}
+	}
+	subject := Translate(info.Locale, "digest_subject", len(info.Items))
+	return render(subject, TEMPLATE_EMAIL_DIGEST, TEMPLATE_TEXT_DIGEST, info.Locale, DEFAULT_CURRENCY, info)
+}
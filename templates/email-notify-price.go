@@ -1,45 +1,74 @@
 package templates
 
 import (
-	"bytes"
-	"html/template"
-	"log"
+	"time"
 )
 
+// HistoryPoint is a day of the price history of the product.
+type HistoryPoint struct {
+	Date    time.Time
+	Lowest  int64
+	Highest int64
+	Closing int64
+}
+
 type InfoEmailNotifyPrice struct {
-	Title         string
+	Locale        string
+	Currency      string
 	Email         string
+	ProductName   string
+	ProductImage  string
+	LinkProduct   string
 	Price         int64
 	PricePrevious int64
-	LinkProduct   string
+	// Discount is in percent, 0 hides it
+	Discount float64
+	History  []HistoryPoint
 }
 
 const TEMPLATE_EMAIL_NOTIFY_PRICE = `
 <!DOCTYPE html>
 <html>
 <head>
-	<title>{{.Title}}</title>
+	<meta charset="utf-8">
+	<title>{{t "price_subject" .ProductName}}</title>
 </head>
 <body>
-	<p>Hi {{.Email}},</p>
-	<p>Price of product you are tracking has changed from {{.PricePrevious}} to {{.Price}}.</p>
-	<p>Click <a href="{{.LinkProduct}}">here</a> to view product.</p>
-	<p>Thanks,</p>
+	<p>{{t "hi" .Email}}</p>
+	{{if .ProductImage}}<p><a href="{{.LinkProduct}}"><img src="{{.ProductImage}}" alt="{{.ProductName}}" width="160"></a></p>{{end}}
+	<p>{{t "price_changed" .ProductName (price .PricePrevious) (price .Price)}}</p>
+	{{if .Discount}}<p>{{t "discount" (percent .Discount)}}</p>{{end}}
+	{{if .History}}
+	<h4>{{t "history"}}</h4>
+	<table cellpadding="4" style="border-collapse: collapse">
+		<tr><th align="left">{{t "date"}}</th><th align="right">{{t "lowest"}}</th><th align="right">{{t "highest"}}</th><th align="right">{{t "closing"}}</th></tr>
+		{{range .History}}<tr><td>{{date .Date}}</td><td align="right">{{price .Lowest}}</td><td align="right">{{price .Highest}}</td><td align="right">{{price .Closing}}</td></tr>
+		{{end}}
+	</table>
+	{{end}}
+	<p><a href="{{.LinkProduct}}">{{t "view_product"}}</a></p>
+	<p>{{t "thanks"}}</p>
 </body>
 </html>
 `
 
-func CreateEmailNotifyPriceTemplate(info InfoEmailNotifyPrice) string {
-	tmpl, err := template.New("email").Parse(TEMPLATE_EMAIL_NOTIFY_PRICE)
-	if err != nil {
-		log.Println("Error parse template email notify price", err)
-		return ""
-	}
+const TEMPLATE_TEXT_NOTIFY_PRICE = `{{t "hi" .Email}}
 
-	var email bytes.Buffer
-	if err := tmpl.Execute(&email, info); err != nil {
-		return ""
-	}
+{{t "price_changed" .ProductName (price .PricePrevious) (price .Price)}}
+{{if .Discount}}{{t "discount" (percent .Discount)}}
+{{end}}{{if .History}}
+{{t "history"}}:
+{{range .History}}- {{date .Date}}: {{price .Lowest}} - {{price .Highest}}, {{t "closing"}} {{price .Closing}}
+{{end}}{{end}}
+{{t "view_product"}}: {{.LinkProduct}}
+
+{{t "thanks"}}
+`
 
-	return email.String()
+func CreateEmailNotifyPriceTemplate(info InfoEmailNotifyPrice) (Email, error) {
+	if info.Currency == "" {
+		info.Currency = CurrencyFromUrl(info.LinkProduct)
+	}
+	subject := Translate(info.Locale, "price_subject", info.ProductName)
+	return render(subject, TEMPLATE_EMAIL_NOTIFY_PRICE, TEMPLATE_TEXT_NOTIFY_PRICE, info.Locale, info.Currency, info)
 }
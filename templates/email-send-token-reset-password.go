@@ -1,13 +1,7 @@
 package templates
 
-import (
-	"bytes"
-	"log"
-	"text/template"
-)
-
 type InfoEmailSendTokenResetPassword struct {
-	Title    string
+	Locale   string
 	Email    string
 	UrlToken string
 }
@@ -16,29 +10,31 @@ const TEMPLATE_EMAIL_SEND_TOKEN_RESET_PASSWORD = `
 <!DOCTYPE html>
 <html>
 <head>
-	<title>{{.Title}}</title>
+	<meta charset="utf-8">
+	<title>{{t "reset_subject"}}</title>
 </head>
 <body>
-	<p>Hi {{.Email}},</p>
-	<p>Click <a href="{{.UrlToken}}">here</a> to reset your password.</p>
-	<p>Token will be expired in 6 hours.</p>
-	<p>If you did not request this, please ignore this email.</p>
-	<p>Thanks,</p>
+	<p>{{t "hi" .Email}}</p>
+	<p>{{t "reset_body"}}</p>
+	<p><a href="{{.UrlToken}}">{{t "reset_action"}}</a></p>
+	<p>{{t "expires"}}</p>
+	<p>{{t "ignore"}}</p>
+	<p>{{t "thanks"}}</p>
 </body>
 </html>
 `
 
-func CreateEmailSendTokenResetPasswordTemplate(info InfoEmailSendTokenResetPassword) string {
-	tmpl, err := template.New("email").Parse(TEMPLATE_EMAIL_SEND_TOKEN_RESET_PASSWORD)
-	if err != nil {
-		log.Println("Error parse template email send token verify user", err)
-		return ""
-	}
+const TEMPLATE_TEXT_SEND_TOKEN_RESET_PASSWORD = `{{t "hi" .Email}}
+
+{{t "reset_body"}}
+{{.UrlToken}}
 
-	var email bytes.Buffer
-	if err := tmpl.Execute(&email, info); err != nil {
-		return ""
-	}
+{{t "expires"}}
+{{t "ignore"}}
+
+{{t "thanks"}}
+`
 
-	return email.String()
+func CreateEmailSendTokenResetPasswordTemplate(info InfoEmailSendTokenResetPassword) (Email, error) {
+	return render(Translate(info.Locale, "reset_subject"), TEMPLATE_EMAIL_SEND_TOKEN_RESET_PASSWORD, TEMPLATE_TEXT_SEND_TOKEN_RESET_PASSWORD, info.Locale, DEFAULT_CURRENCY, info)
 }
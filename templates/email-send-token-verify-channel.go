@@ -0,0 +1,43 @@
+package templates
+
+// InfoEmailSendTokenVerifyChannel is sent to the email target of a channel
+// before any alert goes to it. Owner is the email of the account.
+type InfoEmailSendTokenVerifyChannel struct {
+	Locale   string
+	Email    string
+	Owner    string
+	UrlToken string
+}
+
+const TEMPLATE_EMAIL_SEND_TOKEN_VERIFY_CHANNEL = `
+<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<title>{{t "channel_subject"}}</title>
+</head>
+<body>
+	<p>{{t "hi" .Email}}</p>
+	<p>{{t "channel_body" .Owner}}</p>
+	<p><a href="{{.UrlToken}}">{{t "channel_action"}}</a></p>
+	<p>{{t "expires"}}</p>
+	<p>{{t "ignore"}}</p>
+	<p>{{t "thanks"}}</p>
+</body>
+</html>
+`
+
+const TEMPLATE_TEXT_SEND_TOKEN_VERIFY_CHANNEL = `{{t "hi" .Email}}
+
+{{t "channel_body" .Owner}}
+{{.UrlToken}}
+
+{{t "expires"}}
+{{t "ignore"}}
+
+{{t "thanks"}}
+`
+
+func CreateEmailSendTokenVerifyChannelTemplate(info InfoEmailSendTokenVerifyChannel) (Email, error) {
+	return render(Translate(info.Locale, "channel_subject"), TEMPLATE_EMAIL_SEND_TOKEN_VERIFY_CHANNEL, TEMPLATE_TEXT_SEND_TOKEN_VERIFY_CHANNEL, info.Locale, DEFAULT_CURRENCY, info)
+}
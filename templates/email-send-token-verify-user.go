@@ -1,13 +1,7 @@
 package templates
 
-import (
-	"bytes"
-	"log"
-	"text/template"
-)
-
 type InfoEmailSendTokenVerifyUser struct {
-	Title    string
+	Locale   string
 	Email    string
 	UrlToken string
 }
@@ -16,29 +10,31 @@ const TEMPLATE_EMAIL_SEND_TOKEN_VERIFY_USER = `
 <!DOCTYPE html>
 <html>
 <head>
-	<title>{{.Title}}</title>
+	<meta charset="utf-8">
+	<title>{{t "verify_subject"}}</title>
 </head>
 <body>
-	<p>Hi {{.Email}},</p>
-	<p>Click <a href="{{.UrlToken}}">here</a> to verify your account.</p>
-	<p>Token will be expired in 6 hours.</p>
-	<p>If you did not request this, please ignore this email.</p>
-	<p>Thanks,</p>
+	<p>{{t "hi" .Email}}</p>
+	<p>{{t "verify_body"}}</p>
+	<p><a href="{{.UrlToken}}">{{t "verify_action"}}</a></p>
+	<p>{{t "expires"}}</p>
+	<p>{{t "ignore"}}</p>
+	<p>{{t "thanks"}}</p>
 </body>
 </html>
 `
 
-func CreateEmailSendTokenVerifyUserTemplate(info InfoEmailSendTokenVerifyUser) string {
-	tmpl, err := template.New("email").Parse(TEMPLATE_EMAIL_SEND_TOKEN_VERIFY_USER)
-	if err != nil {
-		log.Println("Error parse template email send token verify user", err)
-		return ""
-	}
+const TEMPLATE_TEXT_SEND_TOKEN_VERIFY_USER = `{{t "hi" .Email}}
+
+{{t "verify_body"}}
+{{.UrlToken}}
 
-	var email bytes.Buffer
-	if err := tmpl.Execute(&email, info); err != nil {
-		return ""
-	}
+{{t "expires"}}
+{{t "ignore"}}
+
+{{t "thanks"}}
+`
 
-	return email.String()
+func CreateEmailSendTokenVerifyUserTemplate(info InfoEmailSendTokenVerifyUser) (Email, error) {
+	return render(Translate(info.Locale, "verify_subject"), TEMPLATE_EMAIL_SEND_TOKEN_VERIFY_USER, TEMPLATE_TEXT_SEND_TOKEN_VERIFY_USER, info.Locale, DEFAULT_CURRENCY, info)
 }
@@ -0,0 +1,57 @@
+package templates
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"strconv"
+	texttemplate "text/template"
+	"time"
+)
+
+// Email is a rendered email, HTML with its plain text alternative.
+type Email struct {
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// funcs are the helpers of the templates, bound to a locale and a currency.
+func funcs(locale string, currency string) map[string]any {
+	return map[string]any{
+		"t": func(key string, args ...any) string {
+			return Translate(locale, key, args...)
+		},
+		"price": func(price int64) string {
+			return FormatPrice(price, currency)
+		},
+		"money": func(price int64, currency string) string {
+			return FormatPrice(price, currency)
+		},
+		"percent": func(value float64) string {
+			return strconv.FormatFloat(value, 'f', -1, 64)
+		},
+		"date": func(t time.Time) string {
+			return formatDate(locale, t)
+		},
+	}
+}
+
+// render renders the HTML and the text template with the same data.
+func render(subject string, html string, text string, locale string, currency string, data any) (Email, error) {
+	htmlTmpl, err := htmltemplate.New("html").Funcs(funcs(locale, currency)).Parse(html)
+	if err != nil {
+		return Email{}, err
+	}
+	textTmpl, err := texttemplate.New("text").Funcs(funcs(locale, currency)).Parse(text)
+	if err != nil {
+		return Email{}, err
+	}
+	var htmlBody, textBody bytes.Buffer
+	if err := htmlTmpl.Execute(&htmlBody, data); err != nil {
+		return Email{}, err
+	}
+	if err := textTmpl.Execute(&textBody, data); err != nil {
+		return Email{}, err
+	}
+	return Email{Subject: subject, HTML: htmlBody.String(), Text: textBody.String()}, nil
+}
@@ -0,0 +1,51 @@
+package templates
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateEmailNotifyPriceTemplate(t *testing.T) {
+	email, err := CreateEmailNotifyPriceTemplate(InfoEmailNotifyPrice{
+		Locale:        LOCALE_VI,
+		Email:         "user@example.com",
+		ProductName:   "Áo <thun>",
+		ProductImage:  "https://down-vn.img.susercontent.com/file/abc",
+		LinkProduct:   "https://shopee.vn/product-i.1.2",
+		Price:         11900000000,
+		PricePrevious: 12900000000,
+		Discount:      15,
+		History: []HistoryPoint{
+			{Date: time.Date(2024, time.March, 5, 0, 0, 0, 0, time.UTC), Lowest: 11900000000, Highest: 12900000000, Closing: 11900000000},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if email.Subject != "Thông báo giá: Áo <thun>" {
+		t.Fatalf("subject %q", email.Subject)
+	}
+	for _, want := range []string{"từ 129.000₫ thành 119.000₫", "Giảm giá: 15%", "05/03", "Áo &lt;thun&gt;"} {
+		if !strings.Contains(email.HTML, want) {
+			t.Errorf("%q missing in the html", want)
+		}
+	}
+	for _, want := range []string{"từ 129.000₫ thành 119.000₫", "Áo <thun>", "https://shopee.vn/product-i.1.2"} {
+		if !strings.Contains(email.Text, want) {
+			t.Errorf("%q missing in the text", want)
+		}
+	}
+}
+
+func TestLocale(t *testing.T) {
+	for tag, want := range map[string]string{
+		"vi-VN,vi;q=0.9,en;q=0.8": LOCALE_VI,
+		"fr-FR,en;q=0.5":          LOCALE_EN,
+		"":                        DEFAULT_LOCALE,
+	} {
+		if got := Locale(tag); got != want {
+			t.Errorf("Locale(%q) = %s, want %s", tag, got, want)
+		}
+	}
+}
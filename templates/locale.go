@@ -0,0 +1,116 @@
+package templates
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	LOCALE_EN      = "en"
+	LOCALE_VI      = "vi"
+	DEFAULT_LOCALE = LOCALE_EN
+)
+
+// messages are the texts of the emails in every locale. The values are
+// fmt formats.
+var messages = map[string]map[string]string{
+	LOCALE_EN: {
+		"hi":              "Hi %s,",
+		"thanks":          "Thanks,",
+		"ignore":          "If you did not request this, please ignore this email.",
+		"expires":         "The link expires in 6 hours.",
+		"verify_subject":  "Verify your email",
+		"verify_body":     "Click the link below to verify your account.",
+		"verify_action":   "Verify my email",
+		"channel_subject": "Confirm your price alerts",
+		"channel_body":    "Click the link below to receive the price alerts of %s at this address.",
+		"channel_action":  "Confirm this address",
+		"reset_subject":   "Reset your password",
+		"reset_body":      "Click the link below to reset your password.",
+		"reset_action":    "Reset my password",
+		"price_subject":   "Price alert: %s",
+		"price_changed":   "The price of %s has changed from %s to %s.",
+		"discount":        "Discount: %s%%",
+		"history":         "Price history",
+		"date":            "Date",
+		"lowest":          "Lowest",
+		"highest":         "Highest",
+		"closing":         "Closing",
+		"view_product":    "View product",
+		"digest_subject":  "%d price alerts",
+		"digest_intro":    "Here are the price changes of the products you track:",
+		"product":         "Product",
+		"before":          "Before",
+		"now":             "Now",
+		"change":          "Change",
+	},
+	LOCALE_VI: {
+		"hi":              "Xin chào %s,",
+		"thanks":          "Cảm ơn bạn,",
+		"ignore":          "Nếu bạn không yêu cầu, vui lòng bỏ qua email này.",
+		"expires":         "Liên kết sẽ hết hạn sau 6 giờ.",
+		"verify_subject":  "Xác minh email của bạn",
+		"verify_body":     "Nhấn vào liên kết bên dưới để xác minh tài khoản.",
+		"verify_action":   "Xác minh email",
+		"channel_subject": "Xác nhận nhận thông báo giá",
+		"channel_body":    "Nhấn vào liên kết bên dưới để nhận thông báo giá của %s tại địa chỉ này.",
+		"channel_action":  "Xác nhận địa chỉ",
+		"reset_subject":   "Đặt lại mật khẩu",
+		"reset_body":      "Nhấn vào liên kết bên dưới để đặt lại mật khẩu.",
+		"reset_action":    "Đặt lại mật khẩu",
+		"price_subject":   "Thông báo giá: %s",
+		"price_changed":   "Giá của %s đã thay đổi từ %s thành %s.",
+		"discount":        "Giảm giá: %s%%",
+		"history":         "Lịch sử giá",
+		"date":            "Ngày",
+		"lowest":          "Thấp nhất",
+		"highest":         "Cao nhất",
+		"closing":         "Cuối ngày",
+		"view_product":    "Xem sản phẩm",
+		"digest_subject":  "%d thông báo giá",
+		"digest_intro":    "Đây là các thay đổi giá của sản phẩm bạn theo dõi:",
+		"product":         "Sản phẩm",
+		"before":          "Trước",
+		"now":             "Hiện tại",
+		"change":          "Thay đổi",
+	},
+}
+
+// dateLayouts is how a day is written in every locale.
+var dateLayouts = map[string]string{
+	LOCALE_EN: "Jan 2",
+	LOCALE_VI: "02/01",
+}
+
+// Locale returns the supported locale of a language tag like "vi-VN" or an
+// Accept-Language header, DEFAULT_LOCALE when there is none.
+func Locale(tag string) string {
+	for _, part := range strings.Split(tag, ",") {
+		language, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		language, _, _ = strings.Cut(strings.ToLower(language), "-")
+		if _, ok := messages[language]; ok {
+			return language
+		}
+	}
+	return DEFAULT_LOCALE
+}
+
+// Translate returns the text of key in the locale, in English when the
+// locale does not have it.
+func Translate(locale string, key string, args ...any) string {
+	format, ok := messages[locale][key]
+	if !ok {
+		format = messages[DEFAULT_LOCALE][key]
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// formatDate writes the day of t in the locale.
+func formatDate(locale string, t time.Time) string {
+	layout, ok := dateLayouts[locale]
+	if !ok {
+		layout = dateLayouts[DEFAULT_LOCALE]
+	}
+	return t.Format(layout)
+}
@@ -0,0 +1,99 @@
+package templates
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// PRICE_UNIT is what Shopee multiplies the prices by.
+const PRICE_UNIT = 100000
+
+const DEFAULT_CURRENCY = "VND"
+
+// Currency tells how to write an amount of a currency.
+type Currency struct {
+	Symbol string
+	// Prefix puts the symbol before the amount
+	Prefix   bool
+	Decimals int
+	Thousand string
+	Decimal  string
+}
+
+// Currencies are the currencies of the Shopee regions.
+var Currencies = map[string]Currency{
+	"VND": {Symbol: "₫", Decimals: 0, Thousand: ".", Decimal: ","},
+	"IDR": {Symbol: "Rp", Prefix: true, Decimals: 0, Thousand: ".", Decimal: ","},
+	"THB": {Symbol: "฿", Prefix: true, Decimals: 2, Thousand: ",", Decimal: "."},
+	"MYR": {Symbol: "RM", Prefix: true, Decimals: 2, Thousand: ",", Decimal: "."},
+	"PHP": {Symbol: "₱", Prefix: true, Decimals: 2, Thousand: ",", Decimal: "."},
+	"SGD": {Symbol: "S$", Prefix: true, Decimals: 2, Thousand: ",", Decimal: "."},
+	"TWD": {Symbol: "NT$", Prefix: true, Decimals: 0, Thousand: ",", Decimal: "."},
+	"BRL": {Symbol: "R$", Prefix: true, Decimals: 2, Thousand: ".", Decimal: ","},
+}
+
+// shopeeDomains maps the Shopee sites to their currency.
+var shopeeDomains = map[string]string{
+	"shopee.vn":     "VND",
+	"shopee.co.id":  "IDR",
+	"shopee.co.th":  "THB",
+	"shopee.com.my": "MYR",
+	"shopee.ph":     "PHP",
+	"shopee.sg":     "SGD",
+	"shopee.tw":     "TWD",
+	"shopee.com.br": "BRL",
+}
+
+// CurrencyFromUrl returns the currency of the Shopee site of a product url,
+// DEFAULT_CURRENCY when it is not known.
+func CurrencyFromUrl(productUrl string) string {
+	u, err := url.Parse(productUrl)
+	if err != nil {
+		return DEFAULT_CURRENCY
+	}
+	host := strings.TrimPrefix(u.Hostname(), "www.")
+	if currency, ok := shopeeDomains[host]; ok {
+		return currency
+	}
+	return DEFAULT_CURRENCY
+}
+
+// FormatPrice writes a Shopee price, in PRICE_UNIT, in the currency, e.g.
+// 12900000000 in VND is "129.000₫".
+func FormatPrice(price int64, currency string) string {
+	c, ok := Currencies[currency]
+	if !ok {
+		c, currency = Currencies[DEFAULT_CURRENCY], DEFAULT_CURRENCY
+	}
+	sign := ""
+	if price < 0 {
+		sign, price = "-", -price
+	}
+	scale := int64(1)
+	for i := 0; i < c.Decimals; i++ {
+		scale *= 10
+	}
+	// round to the smallest unit written
+	units := (price*scale + PRICE_UNIT/2) / PRICE_UNIT
+	amount := groupThousands(strconv.FormatInt(units/scale, 10), c.Thousand)
+	if c.Decimals > 0 {
+		fraction := strconv.FormatInt(units%scale, 10)
+		amount += c.Decimal + strings.Repeat("0", c.Decimals-len(fraction)) + fraction
+	}
+	if c.Prefix {
+		return sign + c.Symbol + amount
+	}
+	return sign + amount + c.Symbol
+}
+
+func groupThousands(digits string, separator string) string {
+	var b strings.Builder
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteString(separator)
+		}
+		b.WriteRune(digit)
+	}
+	return b.String()
+}
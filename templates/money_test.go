@@ -0,0 +1,32 @@
+package templates
+
+import "testing"
+
+func TestFormatPrice(t *testing.T) {
+	for _, test := range []struct {
+		price    int64
+		currency string
+		want     string
+	}{
+		{12900000000, "VND", "129.000₫"},
+		{1190000000000, "VND", "11.900.000₫"},
+		{0, "VND", "0₫"},
+		{1290000, "MYR", "RM12.90"},
+		{129950000, "THB", "฿1,299.50"},
+		{-500000000, "VND", "-5.000₫"},
+		{12900000000, "XXX", "129.000₫"},
+	} {
+		if got := FormatPrice(test.price, test.currency); got != test.want {
+			t.Errorf("FormatPrice(%d, %s) = %q, want %q", test.price, test.currency, got, test.want)
+		}
+	}
+}
+
+func TestCurrencyFromUrl(t *testing.T) {
+	if got := CurrencyFromUrl("https://shopee.co.th/product-i.1.2"); got != "THB" {
+		t.Fatalf("got %s", got)
+	}
+	if got := CurrencyFromUrl("https://example.com"); got != DEFAULT_CURRENCY {
+		t.Fatalf("got %s", got)
+	}
+}
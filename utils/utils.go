@@ -3,8 +3,6 @@ package utils
 import (
 	"crypto/rand"
 	"encoding/base64"
-	"net/smtp"
-	"os"
 	"regexp"
 	"strings"
 )
@@ -68,17 +66,6 @@ func GenerateTokenVerifyEmail() (string, error) {
 	return processedString, nil
 }
 
-func SendEmail(email, content string) error {
-	smtpServer := os.Getenv("SMTP_SERVER")
-	smtpPort := os.Getenv("SMTP_PORT")
-	smtpUser := os.Getenv("UR_MAIL")
-	smtpPass := os.Getenv("PW_MAIL")
-
-	return smtp.SendMail(smtpServer+":"+smtpPort,
-		smtp.PlainAuth("", smtpUser, smtpPass, smtpServer),
-		os.Getenv("HOST_MAIL"), []string{email}, []byte(content))
-}
-
 func ConvertFloat64ToInt64(value float64) int64 {
 	return int64(value)
 }